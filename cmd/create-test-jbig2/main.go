@@ -16,7 +16,7 @@ func createMinimalJBIG2(filename string) error {
 	// JBIG2 file header
 	header := []byte{
 		0x97, 0x4A, 0x42, 0x32, 0x0D, 0x0A, 0x1A, 0x0A, // JBIG2 magic
-		0x00, 0x00, 0x00, 0x04, // File header length (4 bytes)
+		0x01,                   // Flags (sequential organisation, page count known)
 		0x00, 0x00, 0x00, 0x01, // Number of pages
 	}
 
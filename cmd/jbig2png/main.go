@@ -3,10 +3,9 @@ package main
 import (
 	"flag"
 	"fmt"
-	"image"
-	"image/color"
 	"image/png"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 
@@ -17,6 +16,7 @@ func main() {
 	var inputFile = flag.String("input", "", "Input JBIG2 file")
 	var globalFile = flag.String("global", "", "Optional JBIG2 globals stream extracted from PDF")
 	var outputFile = flag.String("output", "", "Output PNG file (optional, defaults to input filename with .png extension)")
+	var verbose = flag.Bool("v", false, "Log decoder warnings to stderr")
 	flag.Parse()
 
 	if *inputFile == "" {
@@ -43,6 +43,9 @@ func main() {
 		SrcData:    data,
 		SrcKey:     0,
 	}
+	if *verbose {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stderr, nil))
+	}
 
 	decoder, err := jbig2.New(opts)
 	if err != nil {
@@ -108,7 +111,7 @@ func main() {
 	}
 
 	// Convert to grayscale image
-	grayImg := convertToGrayscale(img)
+	grayImg := img.ToGray()
 
 	// Determine output filename
 	output := *outputFile
@@ -133,57 +136,3 @@ func main() {
 	fmt.Printf("Successfully converted %s to %s\n", *inputFile, output)
 	fmt.Printf("Image size: %dx%d pixels\n", img.Width(), img.Height())
 }
-
-// convertToGrayscale converts a 1-bit JBIG2 image to 8-bit grayscale
-func convertToGrayscale(jbig2Img *jbig2.Image) *image.Gray {
-	width := jbig2Img.Width()
-	height := jbig2Img.Height()
-
-	// Create grayscale image
-	rect := image.Rect(0, 0, width, height)
-	grayImg := image.NewGray(rect)
-
-	// Get raw pixel data
-	data := jbig2Img.Data()
-	if len(data) == 0 {
-		// Empty image, fill with white
-		for y := 0; y < height; y++ {
-			for x := 0; x < width; x++ {
-				grayImg.SetGray(x, y, color.Gray{Y: 255})
-			}
-		}
-		return grayImg
-	}
-
-	stride := len(data) / height
-	if stride*height != len(data) {
-		stride = (width + 7) / 8
-	}
-
-	// Convert 1-bit pixels to 8-bit grayscale
-	for y := 0; y < height; y++ {
-		for x := 0; x < width; x++ {
-			// Calculate bit position within the data
-			byteIndex := y*stride + x/8
-			bitIndex := uint(7 - (x % 8))
-
-			// Extract bit value
-			bit := byte(0)
-			if byteIndex < len(data) {
-				bit = (data[byteIndex] >> bitIndex) & 1
-			}
-
-			// Convert to grayscale (0 = black, 1 = white)
-			// In JBIG2, 1 typically means "paint" (black), 0 means "no paint" (white)
-			// But for display purposes, we invert this for typical image expectations
-			pixelValue := byte(255) // White background
-			if bit != 0 {
-				pixelValue = 0 // Black pixel
-			}
-
-			grayImg.SetGray(x, y, color.Gray{Y: pixelValue})
-		}
-	}
-
-	return grayImg
-}
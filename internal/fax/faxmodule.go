@@ -20,10 +20,11 @@ func max(a, b int) int {
 type FaxModule struct{}
 
 // FaxG4Decode decodes a G4 (MMR) compressed FAX image.
-// Returns the ending bit position.
-func FaxG4Decode(srcBuf []byte, startingBitPos, width, height, pitch int, destBuf []byte) int {
+// Returns the ending bit position. When cancel is non-nil it is polled before
+// each row and a non-nil result aborts the decode.
+func FaxG4Decode(srcBuf []byte, startingBitPos, width, height, pitch int, destBuf []byte, cancel func() error) (int, error) {
 	if pitch == 0 {
-		return startingBitPos
+		return startingBitPos, nil
 	}
 
 	refBuf := make([]byte, pitch)
@@ -33,6 +34,11 @@ func FaxG4Decode(srcBuf []byte, startingBitPos, width, height, pitch int, destBu
 
 	bitPos := startingBitPos
 	for iRow := 0; iRow < height; iRow++ {
+		if cancel != nil {
+			if err := cancel(); err != nil {
+				return bitPos, err
+			}
+		}
 		lineBuf := destBuf[iRow*pitch : (iRow+1)*pitch]
 		for i := range lineBuf {
 			lineBuf[i] = 0xFF
@@ -40,7 +46,7 @@ func FaxG4Decode(srcBuf []byte, startingBitPos, width, height, pitch int, destBu
 		bitPos = faxG4GetRow(srcBuf, len(srcBuf)<<3, &bitPos, lineBuf, refBuf, width)
 		copy(refBuf, lineBuf)
 	}
-	return bitPos
+	return bitPos, nil
 }
 
 // faxG4GetRow decodes one row of G4 compressed data.
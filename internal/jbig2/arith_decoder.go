@@ -6,7 +6,7 @@ import (
 
 const defaultAValue = 0x8000
 
-var errArithDecoderComplete = errors.New("jbig2: arithmetic decoder exhausted")
+var errArithDecoderComplete = truncatedf("jbig2: arithmetic decoder exhausted")
 
 // arithQe matches the probability table entries used by the JBIG2 arithmetic decoder.
 type arithQe struct {
@@ -1,12 +1,11 @@
 package jbig2
 
-import (
-	"errors"
-	"math"
-)
+import "math"
 
 const maxSpanSize = 256 * 1024 * 1024
 
+var errBitstreamOutOfBounds = truncatedf("bitstream: out of bounds")
+
 // BitStream is the Go translation of CJBig2_BitStream.
 type BitStream struct {
 	buf    []byte
@@ -36,12 +35,12 @@ func (bs *BitStream) Key() uint64 { return bs.key }
 // error is returned.
 func (bs *BitStream) ReadNBits(count uint32) (uint32, error) {
 	if !bs.InBounds() {
-		return 0, errors.New("bitstream: out of bounds")
+		return 0, errBitstreamOutOfBounds
 	}
 
 	bitPos := bs.BitPos()
 	if bitPos > bs.lengthInBits() {
-		return 0, errors.New("bitstream: beyond length")
+		return 0, truncatedf("bitstream: beyond length")
 	}
 
 	var bitsToRead uint32
@@ -72,7 +71,7 @@ func (bs *BitStream) ReadNBitsSigned(count uint32) (int32, error) {
 // Read1Bit returns the next single bit as a uint32.
 func (bs *BitStream) Read1Bit() (uint32, error) {
 	if !bs.InBounds() {
-		return 0, errors.New("bitstream: out of bounds")
+		return 0, errBitstreamOutOfBounds
 	}
 	value := uint32((bs.buf[bs.byteIx] >> (7 - bs.bitIx)) & 0x01)
 	bs.advanceBit()
@@ -89,9 +88,9 @@ func (bs *BitStream) Read1BitBool() (bool, error) {
 }
 
 // ReadByte returns the next raw byte.
-func (bs *BitStream) ReadByte() (uint8, error) {
+func (bs *BitStream) ReadByte() (byte, error) {
 	if !bs.InBounds() {
-		return 0, errors.New("bitstream: out of bounds")
+		return 0, errBitstreamOutOfBounds
 	}
 	value := bs.buf[bs.byteIx]
 	bs.byteIx++
@@ -101,7 +100,7 @@ func (bs *BitStream) ReadByte() (uint8, error) {
 // ReadUint32 reads a big-endian 32-bit value.
 func (bs *BitStream) ReadUint32() (uint32, error) {
 	if bs.byteIx+3 >= uint32(len(bs.buf)) {
-		return 0, errors.New("bitstream: underflow reading uint32")
+		return 0, truncatedf("bitstream: underflow reading uint32")
 	}
 	v := uint32(bs.buf[bs.byteIx])<<24 |
 		uint32(bs.buf[bs.byteIx+1])<<16 |
@@ -114,7 +113,7 @@ func (bs *BitStream) ReadUint32() (uint32, error) {
 // ReadUint16 reads a big-endian 16-bit value.
 func (bs *BitStream) ReadUint16() (uint16, error) {
 	if bs.byteIx+1 >= uint32(len(bs.buf)) {
-		return 0, errors.New("bitstream: underflow reading uint16")
+		return 0, truncatedf("bitstream: underflow reading uint16")
 	}
 	v := uint16(bs.buf[bs.byteIx])<<8 | uint16(bs.buf[bs.byteIx+1])
 	bs.byteIx += 2
@@ -182,6 +181,25 @@ func (bs *BitStream) AddOffset(delta uint32) {
 	bs.SetOffset(newOffset)
 }
 
+// Append extends the buffer with data that arrived after the stream was
+// created. The stream takes ownership of its buffer once Append is used.
+func (bs *BitStream) Append(data []byte) {
+	bs.buf = append(bs.buf, data...)
+}
+
+// Discard drops the first n bytes of the buffer and rebases the current
+// position accordingly. Offsets handed out before the call become invalid.
+func (bs *BitStream) Discard(n uint32) {
+	if n > bs.byteIx {
+		n = bs.byteIx
+	}
+	rest := bs.buf[n:]
+	buf := make([]byte, len(rest), len(rest)+len(rest)/2)
+	copy(buf, rest)
+	bs.buf = buf
+	bs.byteIx -= n
+}
+
 // BitPos returns the absolute bit position from the start of the stream.
 func (bs *BitStream) BitPos() uint32 {
 	return (bs.byteIx << 3) + bs.bitIx
@@ -0,0 +1,125 @@
+package jbig2
+
+// newRegionImage allocates the bitmap a width×height region is rendered
+// into: the whole region, or only the clip rectangle of it when clip is not
+// nil.
+func newRegionImage(width, height uint32, clip *Rect) *Image {
+	if clip != nil {
+		return NewImage(int32(clip.Width()), int32(clip.Height()))
+	}
+	return NewImage(int32(width), int32(height))
+}
+
+// composeClipped composes src onto dst at (x, y) in region coordinates,
+// where dst holds the clip rectangle of the region as allocated by
+// newRegionImage. With a clip, placements that miss dst entirely are skipped
+// and reported as successful.
+func composeClipped(src, dst *Image, x, y int64, clip *Rect, op ComposeOp) bool {
+	if clip == nil {
+		return src.ComposeTo(dst, x, y, op)
+	}
+	x -= int64(clip.Left)
+	y -= int64(clip.Top)
+	if x >= int64(dst.Width()) || y >= int64(dst.Height()) ||
+		x+int64(src.Width()) <= 0 || y+int64(src.Height()) <= 0 {
+		return true
+	}
+	return src.ComposeTo(dst, x, y, op)
+}
+
+// clippedRegionInfo returns the region information of the clip rectangle of
+// ri, in page coordinates.
+func clippedRegionInfo(ri RegionInfo, clip *Rect) RegionInfo {
+	if clip == nil {
+		return ri
+	}
+	ri.X += int32(clip.Left)
+	ri.Y += int32(clip.Top)
+	ri.Width = int32(clip.Width())
+	ri.Height = int32(clip.Height())
+	return ri
+}
+
+// SetClip restricts the pages decoded from now on to rect, given in page
+// coordinates, so that only that part of each page is allocated and
+// composed. A nil rect decodes whole pages again. The clip takes effect at
+// the next page information segment and is ignored for pages emitted stripe
+// by stripe.
+func (c *Context) SetClip(rect *Rect) {
+	c.clip = rect
+}
+
+// setPageClip derives the clip of a new page from the requested clip. Pages
+// that may contain refinements of their own contents are decoded in full,
+// since the refinement reference must be complete, and cropped when done.
+func (c *Context) setPageClip(info *PageInfo) {
+	c.pageClip = nil
+	c.pageCrop = nil
+	if c.startEmitting(info) || c.clip == nil {
+		return
+	}
+	bottom := int(info.Height)
+	if info.Height == unboundedPageHeight {
+		bottom = c.clip.Bottom
+	}
+	clip := c.clip.Intersect(Rect{Right: int(info.Width), Bottom: bottom})
+	if info.MightContainRefinements {
+		c.pageCrop = &clip
+	} else {
+		c.pageClip = &clip
+	}
+}
+
+// regionClip returns the part of region ri that lies inside the page clip,
+// in region coordinates, and whether any part does. A nil rectangle stands
+// for the whole region.
+func (c *Context) regionClip(ri RegionInfo) (*Rect, bool) {
+	if c.pageClip == nil || c.emitting {
+		return nil, true
+	}
+	region := Rect{Left: int(ri.X), Top: int(ri.Y), Right: int(ri.X) + int(ri.Width), Bottom: int(ri.Y) + int(ri.Height)}
+	in := region.Intersect(*c.pageClip)
+	if in.Empty() {
+		return nil, false
+	}
+	return &Rect{Left: in.Left - region.Left, Top: in.Top - region.Top, Right: in.Right - region.Left, Bottom: in.Bottom - region.Top}, true
+}
+
+// skipRegion reports whether seg, an immediate region segment, lies wholly
+// outside the page clip and can be stepped over using its data length.
+func (c *Context) skipRegion(seg *Segment, ri RegionInfo) bool {
+	if seg.DataLength == unknownDataLength {
+		return false
+	}
+	_, ok := c.regionClip(ri)
+	return !ok
+}
+
+// chargeRegion charges the bitmap region ri is rendered into, which holds
+// only the part of the region inside the page clip.
+func (c *Context) chargeRegion(ri RegionInfo) error {
+	w, h := uint64(ri.Width), uint64(ri.Height)
+	if clip, _ := c.regionClip(ri); clip != nil {
+		w, h = uint64(clip.Width()), uint64(clip.Height())
+	}
+	return c.budget.AllocateBitmap(w, h)
+}
+
+// pageResult returns the page image to hand out, cropping pages that were
+// decoded in full despite a clip.
+func (c *Context) pageResult() (*Image, error) {
+	if c.colourPage != nil && c.page != nil && c.colourPage.Rect.Dy() < c.page.Height() {
+		if err := c.growColourPage(c.colourPage.Rect.Dy()); err != nil {
+			return nil, err
+		}
+	}
+	if c.pageCrop == nil || c.page == nil {
+		return c.page, nil
+	}
+	crop := *c.pageCrop
+	c.pageCrop = nil
+	if c.colourPage != nil {
+		c.colourPage = cropRGBA(c.colourPage, crop)
+	}
+	return c.page.SubImage(int32(crop.Left), int32(crop.Top), int32(crop.Width()), int32(crop.Height())), nil
+}
@@ -0,0 +1,97 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// clipTestFile returns a 64x48 page with three generic regions and a text
+// region that fails to decode, placed in the bottom-right corner.
+func clipTestFile() []byte {
+	textRegion := regionInfoData(8, 8, 56, 40, 0)
+	textRegion = binary.BigEndian.AppendUint16(textRegion, 0x0001)
+	textRegion = binary.BigEndian.AppendUint16(textRegion, 0x0003)
+	textRegion = binary.BigEndian.AppendUint32(textRegion, 1)
+	return sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(64, 48, 0x40, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(40, 20, 1), 3, 5, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(30, 30, 2), 20, 10, 2)}),
+		buildSegment(testSegment{number: 3, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(10, 6, 3), 50, 2, 0)}),
+		buildSegment(testSegment{number: 4, typ: segmentTypeTextRegionImmediateLossless, page: 1, data: textRegion}),
+		buildSegment(testSegment{number: 5, typ: segmentTypeEndOfPage, page: 1}),
+	)
+}
+
+func TestContextClipMatchesFullPage(t *testing.T) {
+	data := clipTestFile()
+	full, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	// The failing text region comes last, so the page still holds the
+	// generic regions afterwards.
+	if _, _, err := full.NextPage(); err == nil {
+		t.Fatal("expected the text region to fail when decoding the whole page")
+	}
+
+	for _, rect := range []Rect{
+		{Left: 0, Top: 0, Right: 32, Bottom: 24},
+		{Left: 10, Top: 7, Right: 45, Bottom: 33},
+		{Left: 33, Top: 0, Right: 50, Bottom: 40},
+	} {
+		ctx, err := CreateContext(nil, 0, data, 0, nil)
+		if err != nil {
+			t.Fatalf("CreateContext returned error: %v", err)
+		}
+		ctx.SetClip(&rect)
+		got, _, err := ctx.NextPage()
+		if err != nil {
+			t.Fatalf("%v: NextPage returned error: %v", rect, err)
+		}
+		if got.Width() != rect.Width() || got.Height() != rect.Height() {
+			t.Fatalf("%v: got %dx%d image", rect, got.Width(), got.Height())
+		}
+		if !sameBitmap(got, full.PageImage().SubImage(int32(rect.Left), int32(rect.Top), int32(rect.Width()), int32(rect.Height()))) {
+			t.Errorf("%v: clipped page differs from the full page", rect)
+		}
+	}
+}
+
+func TestContextClipOutsidePage(t *testing.T) {
+	ctx, err := CreateContext(nil, 0, clipTestFile(), 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetClip(&Rect{Left: 100, Top: 100, Right: 120, Bottom: 120})
+	got, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if got.Width() != 0 || got.Height() != 0 {
+		t.Fatalf("expected an empty page, got %dx%d", got.Width(), got.Height())
+	}
+}
+
+func TestContextClipRefinedPageIsCropped(t *testing.T) {
+	region := testPattern(16, 8, 5)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x02, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(region, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetClip(&Rect{Left: 4, Top: 2, Right: 12, Bottom: 7})
+	got, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if ctx.PageImage().Width() != 16 {
+		t.Fatal("expected the page to be decoded in full")
+	}
+	if !sameBitmap(got, region.SubImage(4, 2, 8, 5)) {
+		t.Fatal("cropped page mismatch")
+	}
+}
@@ -0,0 +1,250 @@
+package jbig2
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+)
+
+const segmentTypeColourPalette = 54
+
+// Region segment colour extension (T.88 Amendment 3). A region whose
+// information flags set regionFlagColour carries two palette indices after
+// the flags: the foreground colour of its 1 pixels and the background colour
+// of its 0 pixels, where noBackground leaves 0 pixels transparent.
+const (
+	regionFlagColour     = 0x08
+	regionColourInfoSize = 4
+	noBackground         = 0xffff
+)
+
+// Colour spaces of colour palette segments.
+const (
+	paletteRGB  = 0
+	paletteCMYK = 1
+)
+
+// regionInfoSize returns the length of the region segment information field
+// at the start of data, which must hold at least its flags byte.
+func regionInfoSize(data []byte) int {
+	if len(data) > 16 && data[16]&regionFlagColour != 0 {
+		return 17 + regionColourInfoSize
+	}
+	return 17
+}
+
+// parsePaletteSegment reads a colour palette segment: the colour space,
+// the number of entries and the entries themselves, three bytes each for
+// RGB and four for CMYK.
+func (c *Context) parsePaletteSegment(seg *Segment) (DecodeResult, error) {
+	space, err := c.stream.ReadByte()
+	if err != nil {
+		return DecodeResultFailure, err
+	}
+	count, err := c.stream.ReadUint16()
+	if err != nil {
+		return DecodeResultFailure, err
+	}
+	var size uint32
+	switch space {
+	case paletteRGB:
+		size = 3
+	case paletteCMYK:
+		size = 4
+	default:
+		return DecodeResultFailure, unsupportedf("jbig2: unsupported palette colour space %d", space)
+	}
+	if c.stream.BytesLeft() < uint32(count)*size {
+		return DecodeResultFailure, truncatedf("jbig2: colour palette of %d entries extends past end of data", count)
+	}
+	palette := make([]color.RGBA, count)
+	for i := range palette {
+		b := c.stream.Pointer()[:size]
+		if space == paletteCMYK {
+			r, g, bl := color.CMYKToRGB(b[0], b[1], b[2], b[3])
+			palette[i] = color.RGBA{R: r, G: g, B: bl, A: 0xff}
+		} else {
+			palette[i] = color.RGBA{R: b[0], G: b[1], B: b[2], A: 0xff}
+		}
+		c.stream.AddOffset(size)
+	}
+	seg.Palette = palette
+	return DecodeResultSuccess, nil
+}
+
+// ColourPage returns the colour rendering of the most recent page, or nil
+// when the page uses no colour. It is created when the page information
+// flags announce the colour extension or when the first coloured region is
+// composed, and tracks every region composed onto the page from then on.
+// Pages emitted stripe by stripe stay bilevel.
+func (c *Context) ColourPage() *image.RGBA {
+	return c.colourPage
+}
+
+var (
+	colourBlack = color.RGBA{A: 0xff}
+	colourWhite = color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}
+)
+
+// ensureColourPage creates the colour page from the bilevel page, painting
+// set pixels black and unset pixels white.
+func (c *Context) ensureColourPage() error {
+	if c.colourPage != nil || c.emitting || c.page == nil {
+		return nil
+	}
+	w, h := c.page.Width(), c.page.Height()
+	if err := c.budget.Allocate(uint64(w) * uint64(h) * 4); err != nil {
+		return err
+	}
+	c.chargedPage(uint64(w) * uint64(h) * 4)
+	c.colourPage = image.NewRGBA(image.Rect(0, 0, w, h))
+	return c.growColourPage(0)
+}
+
+// growColourPage extends the colour page to the height of the bilevel page
+// and paints the rows from top down from it. Like a slice, the pixels grow
+// into a buffer at least twice the previous height, so that a striped page
+// of unknown height growing stripe by stripe is not copied at every stripe.
+// The added capacity is charged to the budget.
+func (c *Context) growColourPage(top int) error {
+	w, h := c.page.Width(), c.page.Height()
+	if cur := c.colourPage.Rect.Dy(); cur < h {
+		stride := 4 * w
+		pix := c.colourPage.Pix
+		if h*stride > cap(pix) {
+			rows := max(h, 2*cur)
+			if err := c.budget.Allocate(uint64(rows*stride - cap(pix))); err != nil {
+				// Fall back to the exact height when doubling does not fit.
+				rows = h
+				if err := c.budget.Allocate(uint64(rows*stride - cap(pix))); err != nil {
+					return err
+				}
+			}
+			c.chargedPage(uint64(rows*stride - cap(pix)))
+			pix = append(make([]uint8, 0, rows*stride), pix...)
+		}
+		c.colourPage = &image.RGBA{Pix: pix[:h*stride], Stride: stride, Rect: image.Rect(0, 0, w, h)}
+	}
+	for y := top; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if c.page.GetPixel(int32(x), int32(y)) != 0 {
+				c.colourPage.SetRGBA(x, y, colourBlack)
+			} else {
+				c.colourPage.SetRGBA(x, y, colourWhite)
+			}
+		}
+	}
+	return nil
+}
+
+// regionColours returns the foreground and background colours of ri. The
+// background is nil for transparent 0 pixels.
+func (c *Context) regionColours(ri RegionInfo) (fg color.RGBA, bg *color.RGBA, err error) {
+	fg = colourBlack
+	if !ri.Colour {
+		return fg, nil, nil
+	}
+	palette := c.currentPalette()
+	lookup := func(index uint16) (color.RGBA, error) {
+		if int(index) >= len(palette) {
+			return color.RGBA{}, fmt.Errorf("jbig2: colour index %d outside palette of %d entries", index, len(palette))
+		}
+		return palette[index], nil
+	}
+	if fg, err = lookup(ri.Foreground); err != nil {
+		return fg, nil, err
+	}
+	if ri.Background != noBackground {
+		b, err := lookup(ri.Background)
+		if err != nil {
+			return fg, nil, err
+		}
+		bg = &b
+	}
+	return fg, bg, nil
+}
+
+// currentPalette returns the palette referred to by the segment being
+// decoded or, failing that, the most recently decoded palette.
+func (c *Context) currentPalette() []color.RGBA {
+	if seg := c.currentSegment; seg != nil {
+		for _, ref := range seg.ReferredToSegmentNumbers {
+			if target := c.findSegmentByNumber(ref); target != nil && target.Palette != nil {
+				return target.Palette
+			}
+		}
+	}
+	for _, ctx := range []*Context{c, c.globalContext} {
+		if ctx == nil {
+			continue
+		}
+		for i := len(ctx.segments) - 1; i >= 0; i-- {
+			if p := ctx.segments[i].Palette; p != nil {
+				return p
+			}
+		}
+	}
+	return nil
+}
+
+// composeColour paints the placement of the r part of img at (x, y) in
+// page-image coordinates onto the colour page. It runs before the bilevel
+// composition so that the previous page pixels are still available. Pixels
+// the operator clears take the region background, if any, or white; pixels
+// it sets take the region foreground when the region pixel is set and black
+// otherwise, unless they were set before.
+func (c *Context) composeColour(ri RegionInfo, img *Image, x, y int64, r Rect, op ComposeOp) error {
+	if c.colourPage == nil {
+		if !ri.Colour {
+			return nil
+		}
+		if err := c.ensureColourPage(); err != nil || c.colourPage == nil {
+			return err
+		}
+	}
+	if c.colourPage.Rect.Dy() < c.page.Height() {
+		if err := c.growColourPage(c.colourPage.Rect.Dy()); err != nil {
+			return err
+		}
+	}
+	fg, bg, err := c.regionColours(ri)
+	if err != nil {
+		return err
+	}
+	for sy := r.Top; sy < r.Bottom; sy++ {
+		py := int(y) + sy - r.Top
+		if py < 0 || py >= c.page.Height() {
+			continue
+		}
+		for sx := r.Left; sx < r.Right; sx++ {
+			px := int(x) + sx - r.Left
+			if px < 0 || px >= c.page.Width() {
+				continue
+			}
+			src := img.GetPixel(int32(sx), int32(sy))
+			old := c.page.GetPixel(int32(px), int32(py))
+			switch v := applyCompose(op, old, src); {
+			case v == 0 && src == 0 && bg != nil:
+				c.colourPage.SetRGBA(px, py, *bg)
+			case v == 0:
+				c.colourPage.SetRGBA(px, py, colourWhite)
+			case src != 0:
+				c.colourPage.SetRGBA(px, py, fg)
+			case old == 0:
+				c.colourPage.SetRGBA(px, py, colourBlack)
+			}
+		}
+	}
+	return nil
+}
+
+// cropRGBA copies the r part of img into a new image with its origin at
+// (0, 0).
+func cropRGBA(img *image.RGBA, r Rect) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, r.Width(), r.Height()))
+	for y := 0; y < r.Height(); y++ {
+		start := img.PixOffset(r.Left, r.Top+y)
+		copy(out.Pix[y*out.Stride:(y+1)*out.Stride], img.Pix[start:start+4*r.Width()])
+	}
+	return out
+}
@@ -0,0 +1,141 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"testing"
+)
+
+// paletteData builds the data of an RGB colour palette segment.
+func paletteData(colours ...color.RGBA) []byte {
+	data := []byte{paletteRGB, 0, 0}
+	binary.BigEndian.PutUint16(data[1:], uint16(len(colours)))
+	for _, c := range colours {
+		data = append(data, c.R, c.G, c.B)
+	}
+	return data
+}
+
+// colourRegion marks the region segment data built by the helpers above as
+// coloured with foreground fg and background bg.
+func colourRegion(data []byte, fg, bg uint16) []byte {
+	out := append([]byte(nil), data[:17]...)
+	out[16] |= regionFlagColour
+	out = binary.BigEndian.AppendUint16(out, fg)
+	out = binary.BigEndian.AppendUint16(out, bg)
+	return append(out, data[17:]...)
+}
+
+func TestContextColourRegions(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	blue := color.RGBA{B: 0xff, A: 0xff}
+	a := testPattern(8, 8, 1)
+	b := testPattern(8, 8, 2)
+	ctx, page := composeTestPage(t, 0xc0,
+		testSegment{number: 1, typ: segmentTypeColourPalette, page: 1, data: paletteData(red, blue)},
+		testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, refs: []uint32{1},
+			data: colourRegion(genericRegionData(a, 0, 0, 0), 0, noBackground)},
+		testSegment{number: 3, typ: segmentTypeGenericRegionImmediateLossless, page: 1,
+			data: colourRegion(genericRegionData(b, 8, 0, 0), 1, 0)},
+	)
+	colour := ctx.ColourPage()
+	if colour == nil {
+		t.Fatal("ColourPage returned nil for a page with coloured regions")
+	}
+	if got := colour.Bounds().Size(); got.X != 16 || got.Y != 8 {
+		t.Fatalf("colour page is %v, want 16x8", got)
+	}
+	for y := 0; y < 8; y++ {
+		for x := 0; x < 16; x++ {
+			var want color.RGBA
+			switch {
+			case x < 8 && a.GetPixel(int32(x), int32(y)) != 0:
+				want = red
+			case x < 8:
+				want = colourWhite
+			case b.GetPixel(int32(x-8), int32(y)) != 0:
+				want = blue
+			default:
+				want = red
+			}
+			if got := colour.RGBAAt(x, y); got != want {
+				t.Fatalf("colour pixel (%d,%d) = %v, want %v", x, y, got, want)
+			}
+			if (page.GetPixel(int32(x), int32(y)) != 0) != (want == red && x < 8 || want == blue) {
+				t.Fatalf("bilevel pixel (%d,%d) disagrees with colour page", x, y)
+			}
+		}
+	}
+}
+
+func TestContextBilevelPageHasNoColour(t *testing.T) {
+	ctx, _ := composeTestPage(t, 0x40,
+		testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(16, 8, 3), 0, 0, 0)},
+	)
+	if ctx.ColourPage() != nil {
+		t.Error("ColourPage returned an image for a bilevel page")
+	}
+}
+
+func TestContextColourIndexOutsidePalette(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0xc0, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeColourPalette, page: 1, data: paletteData(colourBlack)})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1,
+		data: colourRegion(genericRegionData(testPattern(8, 8, 1), 0, 0, 0), 3, noBackground)})...)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	if _, _, err := ctx.NextPage(); err == nil {
+		t.Fatal("NextPage succeeded with a colour index outside the palette")
+	}
+}
+
+func TestParsePaletteCMYK(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypeColourPalette, data: []byte{paletteCMYK, 0, 1, 0, 0xff, 0xff, 0}})
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	if _, err := ctx.DecodeSequential(nil); err != nil {
+		t.Fatalf("DecodeSequential returned error: %v", err)
+	}
+	want := color.RGBA{R: 0xff, A: 0xff}
+	if got := ctx.segments[0].Palette; len(got) != 1 || got[0] != want {
+		t.Errorf("palette = %v, want [%v]", got, want)
+	}
+}
+
+func TestContextColourPageGrowsWithinBudget(t *testing.T) {
+	data := stripedTestFile(unboundedPageHeight)
+	data[9+11+16] |= 0x80 // colour extension in the page information flags
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetLimits(Limits{MaxAllocBytes: 1 << 20})
+	page, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	colour := ctx.ColourPage()
+	if colour == nil || colour.Bounds().Dx() != page.Width() || colour.Bounds().Dy() != page.Height() {
+		t.Fatalf("colour page %v, want %dx%d", colour, page.Width(), page.Height())
+	}
+	if len(colour.Pix) == cap(colour.Pix) {
+		t.Errorf("colour page grew to exactly %d bytes, want spare capacity", cap(colour.Pix))
+	}
+	if got := ctx.Budget().Allocated(); got < uint64(cap(colour.Pix)) {
+		t.Errorf("budget charged %d bytes, less than the %d byte colour page", got, cap(colour.Pix))
+	}
+
+	ctx, err = CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetLimits(Limits{MaxAllocBytes: uint64(len(colour.Pix))})
+	if _, _, err := ctx.NextPage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("NextPage over the budget returned %v, want ErrLimitExceeded", err)
+	}
+}
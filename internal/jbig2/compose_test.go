@@ -0,0 +1,130 @@
+package jbig2
+
+import "testing"
+
+// composeTestPage decodes a single page built from segs, which follow a
+// 16x8 page information segment with the given flags.
+func composeTestPage(t *testing.T, flags uint8, segs ...testSegment) (*Context, *Image) {
+	t.Helper()
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, flags, 0)})
+	for _, seg := range segs {
+		data = append(data, buildSegment(seg)...)
+	}
+	data = append(data, buildSegment(testSegment{number: 9, typ: segmentTypeEndOfPage, page: 1})...)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	page, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	return ctx, page
+}
+
+func TestContextPageCombinationOperator(t *testing.T) {
+	// Three overlapping patterns, so that OR, AND, XOR and XNOR all compose
+	// different pages; with two, XOR and XNOR would agree.
+	a, b, c := testPattern(16, 8, 1), testPattern(16, 8, 2), testPattern(16, 8, 3)
+	regions := func(opA, opB, opC uint8) []testSegment {
+		return []testSegment{
+			{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(a, 0, 0, opA)},
+			{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(b, 0, 0, opB)},
+			{number: 3, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(c, 0, 0, opC)},
+		}
+	}
+	or := func(p, r int) int { return p | r }
+	and := func(p, r int) int { return p & r }
+	xor := func(p, r int) int { return p ^ r }
+	xnor := func(p, r int) int { return 1 ^ p ^ r }
+	// expected builds the page a, b and c give, one operator per region,
+	// on a page filled with pixel.
+	expected := func(pixel int, ops ...func(p, r int) int) *Image {
+		img := NewImage(16, 8)
+		for y := int32(0); y < 8; y++ {
+			for x := int32(0); x < 16; x++ {
+				v := pixel
+				for i, r := range []*Image{a, b, c} {
+					v = ops[i](v, r.GetPixel(x, y))
+				}
+				img.SetPixel(x, y, v)
+			}
+		}
+		return img
+	}
+	defaults := []*Image{
+		expected(0, or, or, or),
+		expected(1, and, and, and),
+		expected(0, xor, xor, xor),
+		expected(0, xnor, xnor, xnor),
+	}
+	for i := range defaults {
+		for j := i + 1; j < len(defaults); j++ {
+			if sameBitmap(defaults[i], defaults[j]) {
+				t.Fatalf("expected pages %d and %d are identical", i, j)
+			}
+		}
+	}
+
+	tests := []struct {
+		name          string
+		flags         uint8
+		opA, opB, opC uint8
+		want          *Image
+	}{
+		// Without the override bit the page default applies.
+		{"default OR ignores region", 0x00, 2, 0, 3, defaults[0]},
+		{"default AND ignores region", 0x0c, 0, 2, 0, defaults[1]},
+		{"default XOR", 0x10, 0, 0, 0, defaults[2]},
+		{"default XNOR", 0x18, 0, 0, 0, defaults[3]},
+		{"overridden", 0x50, 0, 1, 3, expected(0, or, and, xnor)},
+		{"replace", 0x40, 0, 2, 4, c},
+	}
+	for _, tt := range tests {
+		_, page := composeTestPage(t, tt.flags, regions(tt.opA, tt.opB, tt.opC)...)
+		if !sameBitmap(page, tt.want) {
+			t.Errorf("%s: unexpected page", tt.name)
+		}
+	}
+}
+
+func TestContextInvalidCombinationOperator(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x40, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(4, 4, 0), 0, 0, 5)})...)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	if _, _, err := ctx.NextPage(); err == nil {
+		t.Fatal("expected an error for combination operator 5")
+	}
+}
+
+func TestContextIntermediateRegionRefinement(t *testing.T) {
+	coarse, fine := testPattern(8, 5, 2), testPattern(8, 5, 3)
+	ctx, page := composeTestPage(t, 0x22,
+		testSegment{number: 1, typ: segmentTypeGenericRegion, page: 1, data: genericRegionData(coarse, 0, 0, 0)},
+		testSegment{number: 2, typ: segmentTypeRefinementRegionImmediateLossless, page: 1, refs: []uint32{1}, data: refinementRegionData(fine, coarse, 5, 2, 0)},
+	)
+	want := NewImage(16, 8)
+	fine.ComposeTo(want, 5, 2, ComposeOR)
+	if !sameBitmap(page, want) {
+		t.Error("page does not hold the refined intermediate region alone")
+	}
+	if seg := ctx.findSegmentByNumber(1); seg == nil || seg.Image != nil {
+		t.Error("auxiliary buffer of the refined region was not released")
+	}
+}
+
+func TestContextRefinementOfPageArea(t *testing.T) {
+	coarse, fine := testPattern(8, 5, 2), testPattern(8, 5, 3)
+	_, page := composeTestPage(t, 0x42,
+		testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(coarse, 5, 2, 0)},
+		testSegment{number: 2, typ: segmentTypeRefinementRegionImmediateLossless, page: 1, data: refinementRegionData(fine, coarse, 5, 2, 4)},
+	)
+	want := NewImage(16, 8)
+	fine.ComposeTo(want, 5, 2, ComposeOR)
+	if !sameBitmap(page, want) {
+		t.Error("refinement of the page area does not match")
+	}
+}
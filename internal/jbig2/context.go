@@ -3,7 +3,11 @@ package jbig2
 import (
 	"errors"
 	"fmt"
+	"image"
+	"io"
+	"log/slog"
 	"math"
+	"time"
 )
 
 // DecodeResult mirrors the JBig2_Result enum from the reference implementation.
@@ -38,11 +42,25 @@ const (
 	segmentTypeTables                            = 53
 )
 
+// isIntermediateRegion reports whether segments of type t decode into an
+// auxiliary buffer that a later refinement region refines, rather than
+// being composed onto the page.
+func isIntermediateRegion(t uint8) bool {
+	switch t {
+	case segmentTypeTextRegionImmediate, segmentTypeHalftoneRegion,
+		segmentTypeGenericRegion, segmentTypeRefinementRegion:
+		return true
+	}
+	return false
+}
+
 var errNotImplemented = errors.New("jbig2: context decode not yet implemented")
 
-const JBIG2MinSegmentSize = 11
+// ErrNeedMoreData reports that decoding stopped at a segment boundary because
+// the rest of the stream has not arrived yet.
+var ErrNeedMoreData = errors.New("jbig2: need more data")
 
-const symbolDictCacheMaxSize = 2
+const JBIG2MinSegmentSize = 11
 
 func huffContextSize(template uint8) int {
 	switch template {
@@ -62,23 +80,12 @@ func refAggContextSize(template bool) int {
 	return 8192
 }
 
-// CompoundKey identifies cached symbol dictionaries using the stream key and index.
-type CompoundKey struct {
-	StreamKey uint64
-	Segment   uint32
-}
-
-// CachePair pairs a compound key with a decoded symbol dictionary instance.
-type CachePair struct {
-	Key  CompoundKey
-	Dict *SymbolDict
-}
-
 // Context represents the JBIG2 decoding context responsible for orchestrating
 // segment parsing, dictionary reuse, and page assembly.
 type Context struct {
 	stream         *BitStream
 	globalContext  *Context
+	sharedGlobals  bool // globalContext belongs to a Globals
 	segments       []*Segment
 	pageInfos      []*PageInfo
 	page           *Image
@@ -86,6 +93,38 @@ type Context struct {
 	huffmanTables  []*HuffmanTable
 	isGlobal       bool
 	inPage         bool
+	pageReady      bool
+	endOfFile      bool
+	randomAccess   bool
+	headerTable    []*Segment
+	awaitingData   bool
+	needData       bool
+	pending        pendingScan // progress of nextSegmentBuffered
+	maxBuffered    uint64      // bound on a segment awaiting data, 0 for none
+	cancel         CancelIndicator
+	onRegion       func(RegionUpdate)
+	onRows         func(RowsUpdate)
+	observer       Observer
+	logger         *slog.Logger
+	trace          segmentTrace
+	onStripe       func(StripeUpdate) error
+	emitting       bool // the current page is emitted stripe by stripe
+	profiles       []uint32
+	comments       []Comment
+	colourPage     *image.RGBA // colour rendering of page, if any
+	strict         bool
+	recover        bool
+	release        bool // drop segment results once no longer referred to
+	damage         []Damage
+	partial        *partialRegion // output of a failed text or halftone region
+	stage          ErrorStage
+	baseOffset     uint64
+	budget         *Budget
+	pageCharged    uint64 // budget bytes held by page and colourPage
+	segmentMark    uint64 // budget bytes outside the page when the segment began
+	clip           *Rect  // requested page region, nil for whole pages
+	pageClip       *Rect  // part of the current page held in page
+	pageCrop       *Rect  // crop applied to a page decoded in full
 	bufSpecified   bool
 	pauseStep      int
 	processing     CodecStatus
@@ -96,7 +135,7 @@ type Context struct {
 	currentSegment *Segment
 	offset         uint32
 	ri             RegionInfo
-	cache          *[]CachePair
+	doc            *DocumentContext
 }
 
 // CreateContext instantiates a new context and optional global context tree.
@@ -109,7 +148,13 @@ func CreateContext(globalData []byte, globalKey uint64, srcData []byte, srcKey u
 	if ctx.stream == nil {
 		return nil, errors.New("jbig2: failed to initialise bitstream")
 	}
+	ctx.baseOffset = uint64(len(srcData) - len(trimmedSrc))
 	ctx.fileHeader = srcHeader
+	if srcHeader != nil && srcHeader.RandomAccess() {
+		if err := ctx.parseSegmentHeaderTable(); err != nil {
+			return nil, err
+		}
+	}
 	if len(globalData) > 0 {
 		trimmedGlobal, globalHeader, err := stripJBIG2FileHeader(globalData)
 		if err != nil {
@@ -118,21 +163,18 @@ func CreateContext(globalData []byte, globalKey uint64, srcData []byte, srcKey u
 		ctx.globalContext = newContext(trimmedGlobal, globalKey, docCtx, true)
 		if ctx.globalContext != nil {
 			ctx.globalContext.fileHeader = globalHeader
+			ctx.globalContext.baseOffset = uint64(len(globalData) - len(trimmedGlobal))
 		}
 	}
 	return ctx, nil
 }
 
 func newContext(data []byte, key uint64, docCtx *DocumentContext, isGlobal bool) *Context {
-	var cache *[]CachePair
-	if docCtx != nil {
-		cache = docCtx.SymbolDictCache()
-	}
 	return &Context{
 		stream:        NewBitStream(data, key),
 		huffmanTables: make([]*HuffmanTable, len(builtinHuffmanTables)),
 		isGlobal:      isGlobal,
-		cache:         cache,
+		doc:           docCtx,
 	}
 }
 
@@ -142,37 +184,83 @@ func HuffmanAssignCode(codes []HuffmanCode) error {
 }
 
 func (c *Context) DecodeSequential(pause PauseIndicator) (DecodeResult, error) {
-	if c.stream == nil || c.stream.BytesLeft() == 0 {
+	if c.stream == nil || c.endOfFile || (c.stream.BytesLeft() == 0 && !c.hasMoreSegments()) {
 		return DecodeResultEndReached, nil
 	}
 
-	for c.stream.BytesLeft() >= JBIG2MinSegmentSize {
+	for c.hasMoreSegments() {
+		if err := checkCancel(c.cancel); err != nil {
+			return DecodeResultFailure, err
+		}
+		start := time.Now()
 		if c.currentSegment == nil {
-			c.currentSegment = NewSegment()
-			if err := c.parseSegmentHeader(c.currentSegment); err != nil {
-				c.currentSegment = nil
+			if c.awaitingData && !c.randomAccess {
+				buffered, err := c.nextSegmentBuffered()
+				if err != nil {
+					return DecodeResultFailure, err
+				}
+				if !buffered {
+					c.needData = true
+					c.processing = CodecStatusToBeContinued
+					return DecodeResultSuccess, nil
+				}
+			}
+			headerOffset := c.stream.Offset()
+			seg, err := c.nextSegmentHeader()
+			if err != nil {
+				return DecodeResultFailure, c.segmentError(seg, StageHeader, headerOffset, err)
+			}
+			c.startSegment(seg)
+			c.markSegment()
+			if err := c.checkReferences(seg); err != nil {
+				err = c.segmentError(seg, StageHeader, headerOffset, err)
+				c.endSegment(seg, c.stream.Offset(), time.Since(start), err)
 				return DecodeResultFailure, err
 			}
+			if c.strict {
+				if err := c.checkProfiles(seg, c.stream.Pointer()); err != nil {
+					err = c.segmentError(seg, StageData, c.stream.Offset(), err)
+					c.endSegment(seg, c.stream.Offset(), time.Since(start), err)
+					return DecodeResultFailure, err
+				}
+			}
+			c.currentSegment = seg
 			c.offset = c.stream.Offset()
 		}
 
+		c.stage = StageData
 		res, err := c.parseSegmentData(c.currentSegment, pause)
 		if err != nil {
+			seg := c.currentSegment
 			c.currentSegment = nil
+			c.settleSegment(seg)
+			err = c.segmentError(seg, c.stage, c.offset, err)
+			c.endSegment(seg, c.offset, time.Since(start), err)
+			if c.recoverSegment(seg, err) {
+				continue
+			}
 			return DecodeResultFailure, err
 		}
 		if res == DecodeResultEndReached {
+			c.settleSegment(c.currentSegment)
+			c.endSegment(c.currentSegment, c.offset, time.Since(start), nil)
 			c.currentSegment = nil
 			return DecodeResultSuccess, nil
 		}
 		if c.processing == CodecStatusToBeContinued {
+			c.trace.elapsed += time.Since(start)
 			return DecodeResultSuccess, nil
 		}
 
+		dataOffset := c.offset
 		if c.currentSegment.DataLength != 0xffffffff {
 			if c.currentSegment.DataLength > math.MaxUint32-c.offset {
+				seg := c.currentSegment
 				c.currentSegment = nil
-				return DecodeResultFailure, errors.New("jbig2: segment offset overflow")
+				c.settleSegment(seg)
+				err := c.segmentError(seg, StageData, c.offset, errors.New("jbig2: segment offset overflow"))
+				c.endSegment(seg, c.offset, time.Since(start), err)
+				return DecodeResultFailure, err
 			}
 			c.offset += c.currentSegment.DataLength
 			c.stream.SetOffset(c.offset)
@@ -180,6 +268,11 @@ func (c *Context) DecodeSequential(pause PauseIndicator) (DecodeResult, error) {
 			c.stream.AddOffset(4)
 		}
 		c.segments = append(c.segments, c.currentSegment)
+		c.settleSegment(c.currentSegment)
+		if c.release {
+			c.releaseReferred(c.currentSegment)
+		}
+		c.endSegment(c.currentSegment, dataOffset, time.Since(start), nil)
 		c.currentSegment = nil
 		if c.stream.BytesLeft() > 0 && c.page != nil && pause != nil && pause.ShouldPause() {
 			c.processing = CodecStatusToBeContinued
@@ -190,10 +283,204 @@ func (c *Context) DecodeSequential(pause PauseIndicator) (DecodeResult, error) {
 	return DecodeResultSuccess, nil
 }
 
+// hasMoreSegments reports whether another segment, or the remainder of a
+// paused one, is waiting to be parsed.
+func (c *Context) hasMoreSegments() bool {
+	if c.currentSegment != nil {
+		return true
+	}
+	if c.randomAccess {
+		return len(c.headerTable) > 0
+	}
+	return c.stream.BytesLeft() >= JBIG2MinSegmentSize
+}
+
+// maxSegmentHeaderSize bounds the encoded size of a segment header: number,
+// flags, the long referred-to segment count with its retention bytes, the
+// referred-to segment numbers, page association and data length.
+const maxSegmentHeaderSize = uint32(4 + 1 + 4 + (JBig2MaxReferredSegmentCount+8)/8 + 4*JBig2MaxReferredSegmentCount + 4 + 4)
+
+// pendingScan remembers what nextSegmentBuffered learnt about the segment
+// starting at absolute offset start, so that each call after more data has
+// arrived only examines the new bytes.
+type pendingScan struct {
+	valid   bool
+	start   uint64 // absolute offset of the segment header
+	seg     *Segment
+	header  uint32 // size of the segment header
+	scanned int    // data bytes already searched for an end marker
+}
+
+// nextSegmentBuffered reports whether the header and data of the next
+// sequential segment are fully held in the stream buffer. Segments of unknown
+// length are complete once their end marker and row count have arrived. A
+// header that fails to parse despite enough bytes being buffered is reported
+// as complete so that the regular parse surfaces the error. A segment larger
+// than the buffer bound fails with ErrLimitExceeded before its data is read.
+func (c *Context) nextSegmentBuffered() (bool, error) {
+	start := c.stream.Offset()
+	p := &c.pending
+	if abs := c.baseOffset + uint64(start); !p.valid || p.start != abs {
+		seg := NewSegment()
+		err := c.parseSegmentHeader(seg)
+		header := c.stream.Offset() - start
+		c.stream.SetOffset(start)
+		if err != nil {
+			return c.stream.BytesLeft() >= maxSegmentHeaderSize, nil
+		}
+		*p = pendingScan{valid: true, start: abs, seg: seg, header: header}
+		if c.maxBuffered != 0 && seg.DataLength != unknownDataLength && uint64(header)+uint64(seg.DataLength) > c.maxBuffered {
+			return false, c.segmentError(seg, StageHeader, start, limitError("segment %d holds %d bytes, over the %d byte buffer limit", seg.Number, seg.DataLength, c.maxBuffered))
+		}
+	}
+	data := c.stream.Buf()[start+p.header:]
+	if p.seg.DataLength != unknownDataLength {
+		return uint64(len(data)) >= uint64(p.seg.DataLength), nil
+	}
+	if _, ok := unknownLengthEndFrom(data, p.scanned); ok {
+		return true, nil
+	}
+	// The marker and row count take six bytes, so a marker not yet complete
+	// starts within the last five.
+	p.scanned = max(0, len(data)-5)
+	if c.maxBuffered != 0 && uint64(p.header)+uint64(len(data)) > c.maxBuffered {
+		return false, c.segmentError(p.seg, StageData, start, limitError("segment %d of unknown length exceeds the %d byte buffer limit", p.seg.Number, c.maxBuffered))
+	}
+	return false, nil
+}
+
+// AppendData feeds further bytes of a sequential stream to the context.
+// Bytes of segments that have already been decoded are released first.
+func (c *Context) AppendData(data []byte) {
+	if c.currentSegment == nil && c.stream.Offset() > 0 {
+		c.baseOffset += uint64(c.stream.Offset())
+		c.stream.Discard(c.stream.Offset())
+	}
+	c.stream.Append(data)
+}
+
+// SetCancel installs the indicator polled by the decoding loops. Passing nil
+// removes it.
+func (c *Context) SetCancel(cancel CancelIndicator) {
+	c.cancel = cancel
+}
+
+// SetLimits makes the context enforce limits. The global context shares the
+// same budget, so its dictionaries count against the limits as well.
+func (c *Context) SetLimits(limits Limits) {
+	c.budget = NewBudget(limits)
+}
+
+// Budget returns the resource budget of the context, or nil when no limits
+// were set.
+func (c *Context) Budget() *Budget {
+	return c.budget
+}
+
+// SetBufferLimit bounds the bytes held for a segment whose data is still
+// arriving. Zero removes the bound.
+func (c *Context) SetBufferLimit(n uint64) {
+	c.maxBuffered = n
+}
+
+// SetAwaitingData marks whether more bytes may still be appended. While it is
+// set, DecodeSequential stops at a segment boundary whenever the next segment
+// has not been fully buffered.
+func (c *Context) SetAwaitingData(awaiting bool) {
+	c.awaitingData = awaiting
+}
+
+// segmentError wraps err in a DecodeError describing seg, which may be nil or
+// partially parsed. offset is relative to the stream buffer. Errors that do
+// not carry a classification are reported as ErrCorrupt, except when the
+// decode was cancelled.
+func (c *Context) segmentError(seg *Segment, stage ErrorStage, offset uint32, err error) error {
+	if !classified(err) && checkCancel(c.cancel) == nil {
+		err = withKind(ErrCorrupt, err)
+	}
+	de := &DecodeError{Offset: c.baseOffset + uint64(offset), Stage: stage, Err: err}
+	if seg != nil {
+		de.Segment = seg.Number
+		de.Type = seg.Flags.Type()
+		de.Page = seg.PageAssociation
+	}
+	return de
+}
+
+// nextSegmentHeader returns the next segment to decode with the stream
+// positioned at the start of its data. Sequential files interleave headers
+// and data, so the header is parsed in place; random-access files take the
+// segment from the header table built by parseSegmentHeaderTable.
+func (c *Context) nextSegmentHeader() (*Segment, error) {
+	if c.randomAccess {
+		seg := c.headerTable[0]
+		c.headerTable = c.headerTable[1:]
+		if err := c.budget.AddSegment(); err != nil {
+			return seg, err
+		}
+		c.stream.SetOffset(seg.DataOffset)
+		return seg, nil
+	}
+	headerOffset := c.stream.Offset()
+	seg := NewSegment()
+	if err := c.parseSegmentHeader(seg); err != nil {
+		return seg, err
+	}
+	seg.HeaderLength = c.stream.Offset() - headerOffset
+	if err := c.budget.AddSegment(); err != nil {
+		return seg, err
+	}
+	return seg, nil
+}
+
+// parseSegmentHeaderTable reads the segment headers of a random-access file.
+// All headers come first, terminated by the end-of-file segment header, and
+// the segment data follows in the same order, so each data offset is the sum
+// of the preceding data lengths.
+func (c *Context) parseSegmentHeaderTable() error {
+	var table []*Segment
+	terminated := false
+	for !terminated && c.stream.BytesLeft() >= JBIG2MinSegmentSize {
+		headerOffset := c.stream.Offset()
+		seg := NewSegment()
+		if err := c.parseSegmentHeader(seg); err != nil {
+			return c.segmentError(seg, StageHeader, headerOffset, err)
+		}
+		seg.HeaderLength = c.stream.Offset() - headerOffset
+		if seg.DataLength == 0xffffffff {
+			return c.segmentError(seg, StageHeader, headerOffset, fmt.Errorf("jbig2: segment %d has unknown data length in random-access file", seg.Number))
+		}
+		table = append(table, seg)
+		terminated = seg.Flags.Type() == segmentTypeEndOfFile
+	}
+	if !terminated {
+		return truncatedf("jbig2: random-access file lacks an end-of-file segment header")
+	}
+	offset := uint64(c.stream.Offset())
+	for _, seg := range table {
+		if !c.awaitingData && offset+uint64(seg.DataLength) > uint64(len(c.stream.Buf())) {
+			return c.segmentError(seg, StageData, uint32(offset), truncatedf("jbig2: data of segment %d extends past end of file", seg.Number))
+		}
+		if offset > 0xffffffff {
+			return c.segmentError(seg, StageData, 0xffffffff, unsupportedf("jbig2: data of segment %d starts past 4 GiB", seg.Number))
+		}
+		seg.DataOffset = uint32(offset)
+		offset += uint64(seg.DataLength)
+	}
+	c.headerTable = table
+	c.randomAccess = true
+	return nil
+}
+
 func (c *Context) decodeGlobals(pause PauseIndicator) error {
-	if c.globalContext == nil {
+	if c.globalContext == nil || c.sharedGlobals {
 		return nil
 	}
+	c.globalContext.cancel = c.cancel
+	c.globalContext.budget = c.budget
+	c.globalContext.strict = c.strict
+	c.globalContext.observer = c.observer
+	c.globalContext.logger = c.logger
 	if _, err := c.globalContext.DecodeSequential(pause); err != nil {
 		c.processing = CodecStatusError
 		return err
@@ -272,6 +559,10 @@ func (c *Context) parseSegmentHeader(seg *Segment) error {
 	return nil
 }
 
+// readReferredSegmentCount reads the referred-to segment count together
+// with the retention bits into seg. The short form packs both into one
+// byte; the long form follows the count with one retention bit per segment,
+// rounded up to whole bytes.
 func (c *Context) readReferredSegmentCount(seg *Segment) (int, error) {
 	cur := c.stream.CurByte()
 	if cur>>5 == 7 {
@@ -283,13 +574,33 @@ func (c *Context) readReferredSegmentCount(seg *Segment) (int, error) {
 		if count > int(JBig2MaxReferredSegmentCount) {
 			return 0, errors.New("jbig2: referred segment count out of range")
 		}
+		bits := make([]byte, (count+8)/8)
+		for i := range bits {
+			if bits[i], err = c.stream.ReadByte(); err != nil {
+				return 0, err
+			}
+		}
+		setRetainBits(seg, count, func(i int) bool { return bits[i/8]&(1<<(i%8)) != 0 })
 		return count, nil
 	}
 	_, err := c.stream.ReadByte()
 	if err != nil {
 		return 0, err
 	}
-	return int(cur >> 5), nil
+	count := int(cur >> 5)
+	if count > 4 {
+		return 0, errors.New("jbig2: invalid referred segment count")
+	}
+	setRetainBits(seg, count, func(i int) bool { return cur&(1<<i) != 0 })
+	return count, nil
+}
+
+func setRetainBits(seg *Segment, count int, bit func(i int) bool) {
+	seg.RetainThis = bit(0)
+	seg.RetainReferred = make([]bool, count)
+	for i := range seg.RetainReferred {
+		seg.RetainReferred[i] = bit(i + 1)
+	}
 }
 
 func (c *Context) segmentNumberSize(number uint32) int {
@@ -324,16 +635,37 @@ func (c *Context) parseSegmentData(seg *Segment, pause PauseIndicator) (DecodeRe
 		}
 		return c.parseGenericRegionSegment(seg, pause)
 	case segmentTypePageInfo:
-		return c.parsePageInfoSegment()
+		return c.parsePageInfoSegment(seg)
 	case segmentTypeEndOfPage:
-		c.inPage = false
+		if err := c.finishPage(); err != nil {
+			return DecodeResultFailure, err
+		}
 		return DecodeResultEndReached, nil
 	case segmentTypeEndOfStripe:
+		if c.emitting && c.inPage {
+			row, err := c.stream.ReadUint32()
+			if err != nil {
+				return DecodeResultFailure, err
+			}
+			if info := c.latestPageInfo(); info != nil && info.Height != unboundedPageHeight && row >= info.Height {
+				c.warn(seg, "end-of-stripe row clamped to page height", slog.Uint64("row", uint64(row)), slog.Uint64("height", uint64(info.Height)))
+			}
+			if err := c.emitRows(int(row) + 1); err != nil {
+				return DecodeResultFailure, err
+			}
+			return DecodeResultSuccess, nil
+		}
 		if seg.DataLength != 0 {
 			c.stream.AddOffset(seg.DataLength)
 		}
 		return DecodeResultSuccess, nil
 	case segmentTypeEndOfFile:
+		if c.inPage {
+			if err := c.finishPage(); err != nil {
+				return DecodeResultFailure, err
+			}
+		}
+		c.endOfFile = true
 		return DecodeResultEndReached, nil
 	case segmentTypeHalftoneRegion, segmentTypeHalftoneRegionImmediate, segmentTypeHalftoneRegionImmediateLossless:
 		if !c.inPage {
@@ -342,50 +674,103 @@ func (c *Context) parseSegmentData(seg *Segment, pause PauseIndicator) (DecodeRe
 		return c.parseHalftoneRegionSegment(seg, pause)
 	case segmentTypeTables:
 		return c.parseTablesSegment(seg)
+	case segmentTypeProfiles:
+		return c.parseProfilesSegment(seg)
+	case segmentTypeExtension:
+		return c.parseExtensionSegment(seg)
+	case segmentTypeColourPalette:
+		return c.parsePaletteSegment(seg)
 	default:
-		// For unknown segment types, log and skip the segment data
-		segmentType := seg.Flags.Type()
-		fmt.Printf("Warning: Unknown segment type %d encountered, skipping\n", segmentType)
-		if seg.DataLength > 0 {
-			// Skip the segment data
-			skipBytes := int(seg.DataLength)
-			if c.stream.BytesLeft() < uint32(skipBytes) {
-				skipBytes = int(c.stream.BytesLeft())
-			}
-			for i := 0; i < skipBytes; i++ {
-				c.stream.ReadByte()
+		c.warn(seg, "unknown segment type skipped")
+		skip := seg.DataLength
+		if left := c.stream.BytesLeft(); skip > left {
+			if skip != unknownDataLength {
+				c.warn(seg, "segment data truncated", slog.Uint64("length", uint64(skip)), slog.Uint64("available", uint64(left)))
 			}
+			skip = left
 		}
+		c.stream.AddOffset(skip)
 		return DecodeResultSuccess, nil
 	}
 }
 
-func (c *Context) parsePageInfoSegment() (DecodeResult, error) {
-	width, err := c.stream.ReadUint32()
+func (c *Context) parsePageInfoSegment(seg *Segment) (DecodeResult, error) {
+	info, err := c.readPageInfo(seg)
 	if err != nil {
 		return DecodeResultFailure, err
 	}
+	c.pageInfos = append(c.pageInfos, info)
+	c.colourPage = nil
+	c.releasePageCharge()
+	if info.Height == unboundedPageHeight && !info.Striped {
+		c.warn(seg, "page of unknown height lacks the striping flag")
+	}
+	// A caller-supplied buffer only backs the first page; later pages of a
+	// multi-page stream get their own storage.
+	if !c.bufSpecified || len(c.pageInfos) > 1 {
+		c.setPageClip(info)
+		width, heightToAlloc := info.Width, info.Height
+		if info.Height == 0xffffffff {
+			heightToAlloc = uint32(info.MaxStripeSize)
+		}
+		if c.pageClip != nil {
+			width, heightToAlloc = uint32(c.pageClip.Width()), uint32(c.pageClip.Height())
+		}
+		if err := c.budget.CheckPage(uint64(width), uint64(heightToAlloc)); err != nil {
+			c.processing = CodecStatusError
+			return DecodeResultFailure, err
+		}
+		c.chargedPage(bitmapBytes(uint64(width), uint64(heightToAlloc)))
+		c.page = NewImage(int32(width), int32(heightToAlloc))
+		if c.pageClip != nil && c.pageClip.Empty() {
+			// The clip misses the page; every region is skipped.
+			c.inPage = true
+			return DecodeResultSuccess, nil
+		}
+	}
+	if c.page == nil || c.page.data == nil {
+		c.processing = CodecStatusError
+		return DecodeResultFailure, errors.New("jbig2: failed to allocate page image")
+	}
+	c.page.Fill(info.DefaultPixelValue)
+	c.inPage = true
+	if info.ColourExtension {
+		if err := c.ensureColourPage(); err != nil {
+			return DecodeResultFailure, err
+		}
+	}
+	return DecodeResultSuccess, nil
+}
+
+// readPageInfo parses the page information segment data at the current
+// stream position.
+func (c *Context) readPageInfo(seg *Segment) (*PageInfo, error) {
+	width, err := c.stream.ReadUint32()
+	if err != nil {
+		return nil, err
+	}
 	height, err := c.stream.ReadUint32()
 	if err != nil {
-		return DecodeResultFailure, err
+		return nil, err
 	}
 	resX, err := c.stream.ReadUint32()
 	if err != nil {
-		return DecodeResultFailure, err
+		return nil, err
 	}
 	resY, err := c.stream.ReadUint32()
 	if err != nil {
-		return DecodeResultFailure, err
+		return nil, err
 	}
 	flags, err := c.stream.ReadByte()
 	if err != nil {
-		return DecodeResultFailure, err
+		return nil, err
 	}
 	strip, err := c.stream.ReadUint16()
 	if err != nil {
-		return DecodeResultFailure, err
+		return nil, err
 	}
-	info := &PageInfo{
+	return &PageInfo{
+		Number:            seg.PageAssociation,
 		Width:             width,
 		Height:            height,
 		ResolutionX:       resX,
@@ -393,22 +778,74 @@ func (c *Context) parsePageInfoSegment() (DecodeResult, error) {
 		DefaultPixelValue: flags&4 != 0,
 		Striped:           strip&0x8000 != 0,
 		MaxStripeSize:     strip & 0x7fff,
-	}
-	c.pageInfos = append(c.pageInfos, info)
-	if !c.bufSpecified {
-		heightToAlloc := info.Height
-		if info.Height == 0xffffffff {
-			heightToAlloc = uint32(info.MaxStripeSize)
+
+		EventuallyLossless:       flags&0x01 != 0,
+		MightContainRefinements:  flags&0x02 != 0,
+		DefaultCombOp:            ComposeOp((flags >> 3) & 0x03),
+		RequiresAuxiliaryBuffers: flags&0x20 != 0,
+		CombOpOverridden:         flags&0x40 != 0,
+		ColourExtension:          flags&0x80 != 0,
+	}, nil
+}
+
+// firstPageInfo walks the segment headers up to the first page information
+// segment and returns its contents without decoding any region data. For a
+// striped page of unknown height and stripes set, the walk continues to the
+// end of the page and the height is taken from the last end-of-stripe
+// segment.
+func (c *Context) firstPageInfo(stripes bool) (*PageInfo, error) {
+	var info *PageInfo
+	for c.hasMoreSegments() {
+		seg, err := c.nextSegmentHeader()
+		if err != nil {
+			return nil, err
+		}
+		start := c.stream.Offset()
+		if c.awaitingData && seg.DataLength != 0xffffffff && uint64(start)+uint64(seg.DataLength) > uint64(len(c.stream.Buf())) {
+			return nil, ErrNeedMoreData
 		}
-		c.page = NewImage(int32(info.Width), int32(heightToAlloc))
+		switch seg.Flags.Type() {
+		case segmentTypePageInfo:
+			if info != nil {
+				return info, nil
+			}
+			if info, err = c.readPageInfo(seg); err != nil {
+				return nil, err
+			}
+			if info.Height != unboundedPageHeight || !stripes {
+				return info, nil
+			}
+		case segmentTypeEndOfStripe:
+			if info != nil {
+				row, err := c.stream.ReadUint32()
+				if err != nil {
+					return nil, err
+				}
+				info.Height = row + 1
+			}
+		case segmentTypeEndOfPage, segmentTypeEndOfFile:
+			if info != nil {
+				return info, nil
+			}
+		}
+		if seg.DataLength == 0xffffffff {
+			if info != nil {
+				return info, nil
+			}
+			return nil, fmt.Errorf("jbig2: segment %d of unknown length precedes page information", seg.Number)
+		}
+		c.stream.SetOffset(start + seg.DataLength)
 	}
-	if c.page == nil || c.page.data == nil {
-		c.processing = CodecStatusError
-		return DecodeResultFailure, errors.New("jbig2: failed to allocate page image")
+	if c.awaitingData && !c.randomAccess {
+		return nil, ErrNeedMoreData
 	}
-	c.page.Fill(info.DefaultPixelValue)
-	c.inPage = true
-	return DecodeResultSuccess, nil
+	if info == nil && c.stream.BytesLeft() > 0 {
+		return nil, truncatedf("jbig2: truncated segment header before page information")
+	}
+	if info == nil {
+		return nil, errors.New("jbig2: no page information segment found")
+	}
+	return info, nil
 }
 
 func (c *Context) parseSymbolDictSegment(seg *Segment, pause PauseIndicator) (DecodeResult, error) {
@@ -417,6 +854,8 @@ func (c *Context) parseSymbolDictSegment(seg *Segment, pause PauseIndicator) (De
 		return DecodeResultFailure, err
 	}
 	proc := NewSDDProc()
+	proc.Cancel = c.cancel
+	proc.Budget = c.budget
 	proc.SDHUFF = flags&0x0001 != 0
 	proc.SDREFAGG = flags>>1&0x0001 != 0
 	proc.SDTEMPLATE = uint8((flags >> 10) & 0x0003)
@@ -523,7 +962,10 @@ func (c *Context) parseSymbolDictSegment(seg *Segment, pause PauseIndicator) (De
 		}
 	}
 	if err != nil || dict == nil {
-		return DecodeResultFailure, errors.New("jbig2: failed to decode symbol dictionary")
+		if err == nil {
+			err = errors.New("jbig2: failed to decode symbol dictionary")
+		}
+		return DecodeResultFailure, err
 	}
 	if flags&0x0200 != 0 {
 		if useGbContext {
@@ -562,6 +1004,8 @@ func (c *Context) parsePatternDictSegment(seg *Segment, pause PauseIndicator) (D
 	}
 
 	proc := NewPDDProc()
+	proc.Cancel = c.cancel
+	proc.Budget = c.budget
 	proc.HDMMR = flagByte&0x01 != 0
 	proc.HDTemplate = uint8((flagByte >> 1) & 0x03)
 	proc.HDPW = widthByte
@@ -604,6 +1048,12 @@ func (c *Context) parseGenericRegionSegment(seg *Segment, pause PauseIndicator)
 		if !IsValidImageSize(c.ri.Width, c.ri.Height) {
 			return DecodeResultFailure, errors.New("jbig2: invalid generic region dimensions")
 		}
+		if seg.Flags.Type() != segmentTypeGenericRegion && c.skipRegion(seg, c.ri) {
+			return DecodeResultSuccess, nil
+		}
+		if err := c.chargeRegion(c.ri); err != nil {
+			return DecodeResultFailure, err
+		}
 
 		flagByte, err := c.stream.ReadByte()
 		if err != nil {
@@ -665,13 +1115,18 @@ func (c *Context) parseGenericRegionSegment(seg *Segment, pause PauseIndicator)
 	if proc == nil {
 		return DecodeResultFailure, errors.New("jbig2: missing generic region state")
 	}
+	proc.Cancel = c.cancel
+	proc.OnRows = c.rowsHandler(seg, c.ri)
 
 	seg.ResultType = ResultTypeImage
 
 	if proc.MMR {
 		if seg.Image == nil {
 			status, err := proc.StartDecodeMMR(&seg.Image, c.stream)
-			if err != nil || status != CodecStatusFinished {
+			if err != nil {
+				return DecodeResultFailure, err
+			}
+			if status != CodecStatusFinished {
 				return DecodeResultFailure, errors.New("jbig2: failed to decode MMR generic region")
 			}
 			c.stream.AlignByte()
@@ -770,6 +1225,12 @@ func (c *Context) parseRefinementRegionSegment(seg *Segment, pause PauseIndicato
 	if !IsValidImageSize(ri.Width, ri.Height) {
 		return DecodeResultFailure, errors.New("jbig2: invalid refinement region dimensions")
 	}
+	if seg.Flags.Type() != segmentTypeRefinementRegion && c.skipRegion(seg, ri) {
+		return DecodeResultSuccess, nil
+	}
+	if err := c.chargeRegion(ri); err != nil {
+		return DecodeResultFailure, err
+	}
 
 	flags, err := c.stream.ReadUint16()
 	if err != nil {
@@ -777,6 +1238,7 @@ func (c *Context) parseRefinementRegionSegment(seg *Segment, pause PauseIndicato
 	}
 
 	proc := NewGRRDProc()
+	proc.Cancel = c.cancel
 	proc.Template = flags&0x0001 != 0
 	proc.TPGRON = flags&0x0002 != 0
 	proc.Width = uint32(ri.Width)
@@ -792,6 +1254,8 @@ func (c *Context) parseRefinementRegionSegment(seg *Segment, pause PauseIndicato
 		}
 	}
 
+	// The reference is the auxiliary buffer of the intermediate region this
+	// segment refers to, or else the page area under the region.
 	var referenceSeg *Segment
 	if seg.ReferredToSegmentCount > 0 {
 		for _, ref := range seg.ReferredToSegmentNumbers {
@@ -799,14 +1263,8 @@ func (c *Context) parseRefinementRegionSegment(seg *Segment, pause PauseIndicato
 			if candidate == nil {
 				return DecodeResultFailure, fmt.Errorf("jbig2: missing referenced segment %d", ref)
 			}
-			switch candidate.Flags.Type() {
-			case segmentTypeTextRegionImmediate,
-				segmentTypeHalftoneRegion,
-				segmentTypeGenericRegion,
-				segmentTypeRefinementRegion:
+			if isIntermediateRegion(candidate.Flags.Type()) {
 				referenceSeg = candidate
-			}
-			if referenceSeg != nil {
 				break
 			}
 		}
@@ -816,15 +1274,25 @@ func (c *Context) parseRefinementRegionSegment(seg *Segment, pause PauseIndicato
 		if referenceSeg.Image == nil {
 			return DecodeResultFailure, errors.New("jbig2: referenced segment lacks image data for refinement region")
 		}
+		if referenceSeg.Image.Width() != int(ri.Width) || referenceSeg.Image.Height() != int(ri.Height) {
+			return DecodeResultFailure, fmt.Errorf("jbig2: refinement region size differs from referenced segment %d", referenceSeg.Number)
+		}
 		proc.Reference = referenceSeg.Image
 	} else {
 		if c.page == nil {
 			return DecodeResultFailure, errors.New("jbig2: refinement region missing page image")
 		}
+		if err := c.ensurePageHeight(int(ri.Y) + int(ri.Height)); err != nil {
+			return DecodeResultFailure, err
+		}
 		proc.Reference = c.page
+		proc.ReferenceDX = -ri.X
+		proc.ReferenceDY = -ri.Y
+		if c.pageClip != nil {
+			proc.ReferenceDX += int32(c.pageClip.Left)
+			proc.ReferenceDY += int32(c.pageClip.Top)
+		}
 	}
-	proc.ReferenceDX = 0
-	proc.ReferenceDY = 0
 
 	var grContexts []ArithContext
 	if c.grContexts != nil {
@@ -845,6 +1313,11 @@ func (c *Context) parseRefinementRegionSegment(seg *Segment, pause PauseIndicato
 	c.stream.AlignByte()
 	c.stream.AddOffset(2)
 
+	// An intermediate region is referred to by at most one refinement, so
+	// its auxiliary buffer is no longer needed.
+	if referenceSeg != nil {
+		referenceSeg.Image = nil
+	}
 	seg.ResultType = ResultTypeImage
 	seg.Image = img
 	if seg.Flags.Type() != segmentTypeRefinementRegion {
@@ -864,6 +1337,13 @@ func (c *Context) parseHalftoneRegionSegment(seg *Segment, pause PauseIndicator)
 	if !IsValidImageSize(ri.Width, ri.Height) {
 		return DecodeResultFailure, errors.New("jbig2: invalid halftone region dimensions")
 	}
+	immediate := seg.Flags.Type() != segmentTypeHalftoneRegion
+	if immediate && c.skipRegion(seg, ri) {
+		return DecodeResultSuccess, nil
+	}
+	if err := c.chargeRegion(ri); err != nil {
+		return DecodeResultFailure, err
+	}
 
 	flags, err := c.stream.ReadUint16()
 	if err != nil {
@@ -871,16 +1351,21 @@ func (c *Context) parseHalftoneRegionSegment(seg *Segment, pause PauseIndicator)
 	}
 
 	proc := NewHTRDProc()
+	proc.Cancel = c.cancel
+	proc.Budget = c.budget
 	proc.HMMR = flags&0x0001 != 0
 	proc.HTemplate = uint8((flags >> 1) & 0x0003)
 	proc.HEnableSkip = flags&0x0008 != 0
 	combOp := (flags >> 4) & 0x0007
 	if combOp > uint16(ComposeReplace) {
-		return DecodeResultFailure, fmt.Errorf("jbig2: unsupported halftone compose op %d", combOp)
+		return DecodeResultFailure, unsupportedf("jbig2: unsupported halftone compose op %d", combOp)
 	}
 	proc.HCombOp = ComposeOp(combOp)
 	proc.HDefPixel = flags&0x0080 != 0
 	proc.HBWidth = uint32(ri.Width)
+	if immediate {
+		proc.Clip, _ = c.regionClip(ri)
+	}
 	proc.HBHeight = uint32(ri.Height)
 
 	// Read halftone parameters
@@ -963,13 +1448,19 @@ func (c *Context) parseHalftoneRegionSegment(seg *Segment, pause PauseIndicator)
 	}
 
 	if err != nil || img == nil {
-		return DecodeResultFailure, errors.New("jbig2: failed to decode halftone region")
+		if err == nil {
+			err = errors.New("jbig2: failed to decode halftone region")
+		}
+		if immediate {
+			c.keepPartial(clippedRegionInfo(ri, proc.Clip), proc.PartialImage)
+		}
+		return DecodeResultFailure, err
 	}
 
 	seg.ResultType = ResultTypeImage
 	seg.Image = img
-	if seg.Flags.Type() != segmentTypeHalftoneRegion {
-		if err := c.composeRegion(ri, img, nil); err != nil {
+	if immediate {
+		if err := c.composeRegion(clippedRegionInfo(ri, proc.Clip), img, nil); err != nil {
 			return DecodeResultFailure, err
 		}
 		seg.Image = nil
@@ -985,6 +1476,13 @@ func (c *Context) parseTextRegionSegment(seg *Segment, pause PauseIndicator) (De
 	if !IsValidImageSize(ri.Width, ri.Height) {
 		return DecodeResultFailure, errors.New("jbig2: invalid text region dimensions")
 	}
+	immediate := seg.Flags.Type() != segmentTypeTextRegionImmediate
+	if immediate && c.skipRegion(seg, ri) {
+		return DecodeResultSuccess, nil
+	}
+	if err := c.chargeRegion(ri); err != nil {
+		return DecodeResultFailure, err
+	}
 
 	flags, err := c.stream.ReadUint16()
 	if err != nil {
@@ -992,8 +1490,13 @@ func (c *Context) parseTextRegionSegment(seg *Segment, pause PauseIndicator) (De
 	}
 
 	proc := NewTRDProc()
+	proc.Cancel = c.cancel
+	proc.Budget = c.budget
 	proc.SBWidth = uint32(ri.Width)
 	proc.SBHeight = uint32(ri.Height)
+	if immediate {
+		proc.Clip, _ = c.regionClip(ri)
+	}
 	proc.SBHUFF = flags&0x0001 != 0
 	proc.SBREFINE = flags&0x0002 != 0
 	proc.SBStrips = 1 << ((flags >> 2) & 0x0003)
@@ -1058,7 +1561,7 @@ func (c *Context) parseTextRegionSegment(seg *Segment, pause PauseIndicator) (De
 		cSBHUFFRDY := (huffFlags >> 12) & 0x0003
 		cSBHUFFRSIZE := (huffFlags >> 14) & 0x0001
 		if cSBHUFFFS == 2 || cSBHUFFRDW == 2 || cSBHUFFRDH == 2 || cSBHUFFRDX == 2 || cSBHUFFRDY == 2 {
-			return DecodeResultFailure, errors.New("jbig2: unsupported text region Huffman selector")
+			return DecodeResultFailure, unsupportedf("jbig2: unsupported text region Huffman selector")
 		}
 
 		index := 0
@@ -1293,13 +1796,19 @@ func (c *Context) parseTextRegionSegment(seg *Segment, pause PauseIndicator) (De
 	}
 
 	if err != nil || img == nil {
-		return DecodeResultFailure, errors.New("jbig2: failed to decode text region")
+		if err == nil {
+			err = errors.New("jbig2: failed to decode text region")
+		}
+		if immediate {
+			c.keepPartial(clippedRegionInfo(ri, proc.Clip), proc.PartialImage)
+		}
+		return DecodeResultFailure, err
 	}
 
 	seg.ResultType = ResultTypeImage
 	seg.Image = img
-	if seg.Flags.Type() != segmentTypeTextRegionImmediate {
-		if err := c.composeRegion(ri, img, nil); err != nil {
+	if immediate {
+		if err := c.composeRegion(clippedRegionInfo(ri, proc.Clip), img, nil); err != nil {
 			return DecodeResultFailure, err
 		}
 		seg.Image = nil
@@ -1332,14 +1841,53 @@ func (c *Context) parseRegionInfo(ri *RegionInfo) error {
 		return err
 	}
 
+	if err := c.budget.CheckRegion(uint64(width), uint64(height)); err != nil {
+		return err
+	}
+
 	ri.Width = int32(width)
 	ri.Height = int32(height)
 	ri.X = int32(x)
 	ri.Y = int32(y)
 	ri.Flags = flags
+	ri.Colour = flags&regionFlagColour != 0
+	if ri.Colour {
+		if ri.Foreground, err = c.stream.ReadUint16(); err != nil {
+			return err
+		}
+		if ri.Background, err = c.stream.ReadUint16(); err != nil {
+			return err
+		}
+	}
+	if c.logger != nil {
+		c.checkRegionInfo(*ri)
+	}
 	return nil
 }
 
+// checkRegionInfo reports region information that the decoder tolerates
+// but that points at an encoder problem.
+func (c *Context) checkRegionInfo(ri RegionInfo) {
+	seg := c.currentSegment
+	if reserved := ri.Flags &^ (0x07 | regionFlagColour); reserved != 0 {
+		c.warn(seg, "reserved region flags ignored", slog.Int("flags", int(ri.Flags)))
+	}
+	info := c.latestPageInfo()
+	if info == nil || !c.inPage {
+		return
+	}
+	if op := ComposeOp(ri.Flags & 0x07); !info.CombOpOverridden && op != info.DefaultCombOp && op <= ComposeReplace &&
+		seg != nil && !isIntermediateRegion(seg.Flags.Type()) {
+		c.warn(seg, "region combination operator ignored without page override", slog.Int("operator", int(op)), slog.Int("page_operator", int(info.DefaultCombOp)))
+	}
+	right := uint64(uint32(ri.X)) + uint64(uint32(ri.Width))
+	bottom := uint64(uint32(ri.Y)) + uint64(uint32(ri.Height))
+	if right > uint64(info.Width) || (info.Height != unboundedPageHeight && bottom > uint64(info.Height)) {
+		c.warn(seg, "region clipped to page bounds",
+			slog.Int("x", int(ri.X)), slog.Int("y", int(ri.Y)), slog.Int("width", int(ri.Width)), slog.Int("height", int(ri.Height)))
+	}
+}
+
 func (c *Context) decodeSymbolIDHuffmanTable(numSyms uint32) ([]HuffmanCode, error) {
 	const runCodesSize = 35
 	runCodes := make([]HuffmanCode, runCodesSize)
@@ -1496,7 +2044,7 @@ func (c *Context) configureSymbolDictHuffman(flags uint16, proc *SDDProc, seg *S
 		proc.SDHUFFDH = ref.HuffmanTable
 		index++
 	default:
-		return fmt.Errorf("jbig2: unsupported SDHUFFDH value %d", cSDHUFFDH)
+		return unsupportedf("jbig2: unsupported SDHUFFDH value %d", cSDHUFFDH)
 	}
 
 	switch cSDHUFFDW {
@@ -1520,7 +2068,7 @@ func (c *Context) configureSymbolDictHuffman(flags uint16, proc *SDDProc, seg *S
 		proc.SDHUFFDW = ref.HuffmanTable
 		index++
 	default:
-		return fmt.Errorf("jbig2: unsupported SDHUFFDW value %d", cSDHUFFDW)
+		return unsupportedf("jbig2: unsupported SDHUFFDW value %d", cSDHUFFDW)
 	}
 
 	if cSDHUFFBMSIZE == 0 {
@@ -1642,6 +2190,53 @@ func (c *Context) Continue(pause PauseIndicator) (bool, error) {
 	return true, nil
 }
 
+// NextPage decodes segments until the next page is complete and returns its
+// image and page information. Segments associated with page 0 (and those of
+// the global context) stay available to every page. A page that is still
+// open when the stream runs out is returned as complete, which matches the
+// layout of streams embedded in PDF files. io.EOF is returned once no further
+// pages remain. While the context is awaiting data, ErrNeedMoreData is
+// returned when the buffered bytes end before the next page is complete.
+func (c *Context) NextPage() (*Image, *PageInfo, error) {
+	for {
+		if c.pageReady {
+			c.pageReady = false
+			img, err := c.pageResult()
+			if err != nil {
+				return nil, nil, err
+			}
+			return img, c.latestPageInfo(), nil
+		}
+		if c.needData {
+			c.needData = false
+			return nil, nil, ErrNeedMoreData
+		}
+		if c.awaitingData && c.stream != nil && !c.endOfFile && !c.hasMoreSegments() {
+			return nil, nil, ErrNeedMoreData
+		}
+		if c.stream == nil || c.endOfFile || !c.hasMoreSegments() {
+			if c.inPage {
+				if err := c.finishPage(); err != nil {
+					return nil, nil, err
+				}
+				c.pageReady = false
+				img, err := c.pageResult()
+				if err != nil {
+					return nil, nil, err
+				}
+				return img, c.latestPageInfo(), nil
+			}
+			return nil, nil, io.EOF
+		}
+		c.processing = CodecStatusReady
+		if _, err := c.DecodeSequential(nil); err != nil {
+			c.processing = CodecStatusError
+			return nil, nil, err
+		}
+		c.processing = CodecStatusFinished
+	}
+}
+
 // ProcessingStatus reports the current codec status for the context.
 func (c *Context) ProcessingStatus() CodecStatus {
 	return c.processing
@@ -1652,43 +2247,21 @@ func (c *Context) PageImage() *Image {
 	return c.page
 }
 
-// LookupSymbolDict attempts to find a cached symbol dictionary using the
-// provided key. The cache acts as an LRU with capacity two, matching the
-// reference implementation.
+// LookupSymbolDict attempts to find a symbol dictionary cached by the
+// document context. The result is shared and must not be modified.
 func (c *Context) LookupSymbolDict(key CompoundKey) (*SymbolDict, bool) {
-	if c.cache == nil {
+	if c.doc == nil {
 		return nil, false
 	}
-	entries := *c.cache
-	for i, entry := range entries {
-		if entry.Key == key {
-			if i > 0 {
-				entries = append([]CachePair{entry}, append(entries[:i], entries[i+1:]...)...)
-				*c.cache = entries
-			}
-			return entry.Dict, true
-		}
-	}
-	return nil, false
+	return c.doc.LookupSymbolDict(key)
 }
 
-// StoreSymbolDict inserts or updates a symbol dictionary entry in the LRU cache.
+// StoreSymbolDict caches a symbol dictionary in the document context. The
+// caller must not modify dict afterwards.
 func (c *Context) StoreSymbolDict(key CompoundKey, dict *SymbolDict) {
-	if c.cache == nil || dict == nil {
-		return
-	}
-	entries := *c.cache
-	filtered := entries[:0]
-	for _, entry := range entries {
-		if entry.Key != key {
-			filtered = append(filtered, entry)
-		}
+	if c.doc != nil {
+		c.doc.StoreSymbolDict(key, dict)
 	}
-	filtered = append([]CachePair{{Key: key, Dict: dict}}, filtered...)
-	if len(filtered) > symbolDictCacheMaxSize {
-		filtered = filtered[:symbolDictCacheMaxSize]
-	}
-	*c.cache = filtered
 }
 
 // CurrentSegment exposes the segment currently being processed.
@@ -1725,6 +2298,12 @@ func (c *Context) PageInfos() []*PageInfo {
 	return c.pageInfos
 }
 
+// FileHeader returns the parsed file header, or nil when the stream was
+// embedded without one.
+func (c *Context) FileHeader() *FileHeader {
+	return c.fileHeader
+}
+
 // Offset returns the current byte offset within the bitstream.
 func (c *Context) Offset() uint32 {
 	return c.offset
@@ -1740,10 +2319,29 @@ func (c *Context) SetProcessingStatus(status CodecStatus) {
 	c.processing = status
 }
 
+// combinationOp returns the operator used to compose region ri onto the
+// page. Regions use the page's default operator unless the page information
+// flags allow them to override it; only an overriding region can select
+// REPLACE.
+func (c *Context) combinationOp(ri RegionInfo) (ComposeOp, error) {
+	op := ComposeOp(ri.Flags & 0x07)
+	if op > ComposeReplace {
+		return 0, fmt.Errorf("jbig2: invalid region combination operator %d", op)
+	}
+	if info := c.latestPageInfo(); info != nil && !info.CombOpOverridden {
+		return info.DefaultCombOp, nil
+	}
+	return op, nil
+}
+
 func (c *Context) composeRegion(ri RegionInfo, img *Image, rect *Rect) error {
+	c.stage = StageCompose
 	if img == nil || img.data == nil {
 		return errors.New("jbig2: compose requires a decoded image")
 	}
+	if c.pageClip != nil && c.pageClip.Empty() {
+		return nil
+	}
 	if c.page == nil || c.page.data == nil {
 		return errors.New("jbig2: compose requires an active page image")
 	}
@@ -1758,29 +2356,66 @@ func (c *Context) composeRegion(ri RegionInfo, img *Image, rect *Rect) error {
 	}
 
 	bottom := int(ri.Y) + r.Bottom
-	c.ensurePageHeight(bottom)
+	if err := c.ensurePageHeight(bottom); err != nil {
+		return err
+	}
 
+	op, err := c.combinationOp(ri)
+	if err != nil {
+		return err
+	}
 	x := int64(ri.X) + int64(r.Left)
 	y := int64(ri.Y) + int64(r.Top)
-	op := ComposeOp(ri.Flags & 0x03)
+	if c.pageClip != nil {
+		x -= int64(c.pageClip.Left)
+		y -= int64(c.pageClip.Top)
+		if x >= int64(c.page.Width()) || y >= int64(c.page.Height()) ||
+			x+int64(r.Width()) <= 0 || y+int64(r.Height()) <= 0 {
+			return nil
+		}
+	}
+	if err := c.composeColour(ri, img, x, y, *r, op); err != nil {
+		return err
+	}
 	if !img.ComposeToWithRect(c.page, x, y, *r, op) {
 		return errors.New("jbig2: failed to compose region")
 	}
+	if c.onRegion != nil && c.currentSegment != nil {
+		c.onRegion(RegionUpdate{Segment: c.currentSegment, Rect: c.pageRect(ri, *r), Page: c.page})
+	}
 	return nil
 }
 
-func (c *Context) ensurePageHeight(target int) {
-	if c.page == nil || target <= c.page.Height() {
-		return
+func (c *Context) ensurePageHeight(target int) error {
+	if c.page == nil || (c.pageClip != nil && !c.emitting) {
+		return nil
+	}
+	if c.emitting {
+		// The page image is a window starting at pageClip.Top.
+		if info := c.latestPageInfo(); info != nil && info.Height != unboundedPageHeight {
+			target = min(target, int(info.Height))
+		}
+		target -= c.pageClip.Top
+	}
+	if target <= c.page.Height() {
+		return nil
 	}
 	if target <= 0 || c.bufSpecified {
-		return
+		return nil
 	}
 	info := c.latestPageInfo()
 	if info == nil || !info.ShouldTreatAsStriped() {
-		return
+		return nil
 	}
+	if err := c.budget.GrowPage(uint64(c.page.Width()), uint64(c.page.Height()), uint64(target)); err != nil {
+		return err
+	}
+	c.chargedPage(bitmapBytes(uint64(c.page.Width()), uint64(target-c.page.Height())))
 	c.page.Expand(int32(target), info.DefaultPixelValue)
+	if c.emitting {
+		c.pageClip.Bottom = c.pageClip.Top + c.page.Height()
+	}
+	return nil
 }
 
 func (c *Context) latestPageInfo() *PageInfo {
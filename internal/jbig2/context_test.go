@@ -1,6 +1,9 @@
 package jbig2
 
-import "testing"
+import (
+	"io"
+	"testing"
+)
 
 func TestComposeRegionExpandsStripedPage(t *testing.T) {
 	ctx := &Context{
@@ -38,8 +41,7 @@ func TestParseSymbolDictSegmentUsesCache(t *testing.T) {
 	img := NewImage(1, 1)
 	img.SetPixel(0, 0, 1)
 	baseDict.AddImage(img)
-	slice := doc.SymbolDictCache()
-	*slice = append(*slice, CachePair{Key: cacheKey, Dict: baseDict})
+	doc.StoreSymbolDict(cacheKey, baseDict)
 
 	streamData := []byte{
 		0x00, 0x01, // flags: SDHUFF only
@@ -75,7 +77,7 @@ func TestParseSymbolDictSegmentUsesCache(t *testing.T) {
 	}
 
 	seg.SymbolDict.GetImage(0).SetPixel(0, 0, 0)
-	cached := (*doc.SymbolDictCache())[0].Dict
+	cached, _ := doc.LookupSymbolDict(cacheKey)
 	if pix := cached.GetImage(0).GetPixel(0, 0); pix != 1 {
 		t.Fatal("cache dictionary mutated by consumer")
 	}
@@ -110,3 +112,121 @@ func TestParseTablesSegmentMinimal(t *testing.T) {
 		t.Fatal("expected Huffman table on segment")
 	}
 }
+
+func TestNextPageDecodesEveryPage(t *testing.T) {
+	first := testPattern(16, 6, 0)
+	second := testPattern(9, 13, 4)
+	var data []byte
+	data = append(data, buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(20, 10, 0, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(first, 2, 3, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+	data = append(data, buildSegment(testSegment{number: 3, typ: segmentTypePageInfo, page: 2, data: pageInfoData(9, 13, 0, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 4, typ: segmentTypeGenericRegionImmediateLossless, page: 2, data: genericRegionData(second, 0, 0, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 5, typ: segmentTypeEndOfPage, page: 2})...)
+	data = append(data, buildSegment(testSegment{number: 6, typ: segmentTypeEndOfFile})...)
+
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+
+	page, info, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("first NextPage returned error: %v", err)
+	}
+	if info.Number != 1 || page.Width() != 20 || page.Height() != 10 {
+		t.Fatalf("unexpected first page %d: %dx%d", info.Number, page.Width(), page.Height())
+	}
+	if !sameBitmap(page.SubImage(2, 3, 16, 6), first) {
+		t.Fatal("first page region mismatch")
+	}
+
+	page, info, err = ctx.NextPage()
+	if err != nil {
+		t.Fatalf("second NextPage returned error: %v", err)
+	}
+	if info.Number != 2 || !sameBitmap(page, second) {
+		t.Fatalf("unexpected second page %d", info.Number)
+	}
+
+	if _, _, err := ctx.NextPage(); err != io.EOF {
+		t.Fatalf("expected io.EOF after last page, got %v", err)
+	}
+}
+
+func TestNextPageWithoutEndOfPage(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 8, 0x04, 0)})
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	page, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if page.GetPixel(7, 7) != 1 {
+		t.Fatal("expected page filled with the default pixel value")
+	}
+	if _, _, err := ctx.NextPage(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestDecodeRandomAccessFile(t *testing.T) {
+	region := testPattern(12, 5, 1)
+	segments := []testSegment{
+		{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(12, 5, 0, 0)},
+		{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(region, 0, 0, 0)},
+		{number: 2, typ: segmentTypeEndOfPage, page: 1},
+		{number: 3, typ: segmentTypeEndOfFile},
+	}
+	data := append([]byte{}, jbig2FileSignature...)
+	data = append(data, 0x00, 0x00, 0x00, 0x00, 0x01)
+	for _, seg := range segments {
+		data = append(data, buildSegmentHeader(seg)...)
+	}
+	for _, seg := range segments {
+		data = append(data, seg.data...)
+	}
+
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	page, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if !sameBitmap(page, region) {
+		t.Fatal("random-access page mismatch")
+	}
+	if _, _, err := ctx.NextPage(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestRandomAccessFileRequiresEndOfFile(t *testing.T) {
+	data := append([]byte{}, jbig2FileSignature...)
+	data = append(data, 0x02)
+	data = append(data, buildSegmentHeader(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(1, 1, 0, 0)})...)
+	if _, err := CreateContext(nil, 0, data, 0, nil); err == nil {
+		t.Fatal("expected error for random-access file without end-of-file segment")
+	}
+}
+
+func TestFirstPageInfoStripedUnknownHeight(t *testing.T) {
+	var data []byte
+	data = append(data, buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(30, 0xffffffff, 0, 0x8000|16)})...)
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeEndOfStripe, page: 1, data: []byte{0, 0, 0, 15}})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediate, page: 1, data: []byte{0xde, 0xad}})...)
+	data = append(data, buildSegment(testSegment{number: 3, typ: segmentTypeEndOfStripe, page: 1, data: []byte{0, 0, 0, 40}})...)
+	data = append(data, buildSegment(testSegment{number: 4, typ: segmentTypeEndOfPage, page: 1})...)
+
+	info, err := FirstPageInfo(data)
+	if err != nil {
+		t.Fatalf("FirstPageInfo returned error: %v", err)
+	}
+	if info.Width != 30 || info.Height != 41 {
+		t.Fatalf("unexpected page size %dx%d", info.Width, info.Height)
+	}
+}
@@ -1,6 +1,11 @@
 package jbig2
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"image"
+	"log/slog"
+)
 
 // DecoderOptions configures JBIG2 decoding behavior.
 type DecoderOptions struct {
@@ -12,11 +17,69 @@ type DecoderOptions struct {
 	SrcData []byte
 	// SrcKey identifies the source data stream.
 	SrcKey uint64
+	// Limits bounds the resources the decode may use.
+	Limits Limits
+	// OnRegion is called after each region segment is composed onto the
+	// page.
+	OnRegion func(RegionUpdate)
+	// OnRows is called as rows of immediate generic regions finish.
+	OnRows func(RowsUpdate)
+	// OnStripe, when set, receives the rows of striped pages at each
+	// end-of-stripe segment; see Context.SetOnStripe.
+	OnStripe func(StripeUpdate) error
+	// Strict checks the stream against the profiles it declares; see
+	// Context.SetStrict.
+	Strict bool
+	// Observer receives per-segment tracing hooks; see Observer.
+	Observer Observer
+	// Logger receives warnings about non-fatal anomalies; see
+	// Context.SetLogger.
+	Logger *slog.Logger
+	// Globals provides global segments decoded by ParseGlobals, in place of
+	// GlobalData. The decoder holds a reference to them until it is closed,
+	// and their results count against Limits like those of GlobalData.
+	Globals *Globals
+	// DocumentContext caches the symbol dictionaries of global data streams
+	// with a nonzero GlobalKey across the decoders sharing it. A private
+	// context is used when it is nil.
+	DocumentContext *DocumentContext
+	// Recover decodes past failed region segments; see Context.SetRecover.
+	Recover bool
+	// Release drops segment results no longer referred to; see
+	// Context.SetRelease.
+	Release bool
+	// Pause, when set, is polled by GetFirstPage and Continue after every
+	// segment and every generic region row of a page; decoding stops with
+	// the status CodecStatusToBeContinued once it reports true.
+	Pause PauseIndicator
+}
+
+// documentContext returns the document context the options select.
+func (opts DecoderOptions) documentContext() *DocumentContext {
+	if opts.DocumentContext != nil {
+		return opts.DocumentContext
+	}
+	return NewDocumentContext()
+}
+
+// apply configures ctx according to the options.
+func (opts DecoderOptions) apply(ctx *Context) {
+	ctx.SetLimits(opts.Limits)
+	ctx.SetOnRegion(opts.OnRegion)
+	ctx.SetOnRows(opts.OnRows)
+	ctx.SetOnStripe(opts.OnStripe)
+	ctx.SetStrict(opts.Strict)
+	ctx.SetObserver(opts.Observer)
+	ctx.SetLogger(opts.Logger)
+	ctx.SetRecover(opts.Recover)
+	ctx.SetRelease(opts.Release)
 }
 
 // Decoder manages the JBIG2 decoding process.
 type Decoder struct {
-	ctx *Context
+	ctx     *Context
+	globals *Globals
+	pause   PauseIndicator
 }
 
 // NewDecoder creates a new JBIG2 decoder with the provided options.
@@ -25,13 +88,92 @@ func NewDecoder(opts DecoderOptions) (*Decoder, error) {
 		return nil, errors.New("jbig2: empty source data")
 	}
 
-	docCtx := NewDocumentContext()
-	ctx, err := CreateContext(opts.GlobalData, opts.GlobalKey, opts.SrcData, opts.SrcKey, docCtx)
+	if opts.Globals != nil && len(opts.GlobalData) > 0 {
+		return nil, errors.New("jbig2: both GlobalData and Globals are set")
+	}
+
+	ctx, err := CreateContext(opts.GlobalData, opts.GlobalKey, opts.SrcData, opts.SrcKey, opts.documentContext())
 	if err != nil {
 		return nil, err
 	}
+	opts.apply(ctx)
+	if opts.Globals != nil {
+		if err := opts.Globals.Acquire(); err != nil {
+			return nil, err
+		}
+		if err := ctx.UseGlobals(opts.Globals); err != nil {
+			opts.Globals.Release()
+			return nil, err
+		}
+	}
+
+	return &Decoder{ctx: ctx, globals: opts.Globals, pause: opts.Pause}, nil
+}
+
+// ResumeDecoder creates a decoder that continues from state, produced by
+// MarshalState of a decoder created with the same SrcData and global
+// segments. OnStripe must be set if it was set on that decoder, and a state
+// taken within DecodeRegion must be resumed with DecodeRegion and the same
+// rect. The remaining options need not match.
+func ResumeDecoder(state []byte, opts DecoderOptions) (*Decoder, error) {
+	d, err := NewDecoder(opts)
+	if err != nil {
+		return nil, err
+	}
+	if err := d.ctx.UnmarshalState(state); err != nil {
+		d.Close()
+		return nil, err
+	}
+	return d, nil
+}
+
+// MarshalState serializes the decoding state so that ResumeDecoder can
+// continue from it, possibly in another process; see Context.MarshalState.
+func (d *Decoder) MarshalState() ([]byte, error) {
+	return d.ctx.MarshalState()
+}
 
-	return &Decoder{ctx: ctx}, nil
+// Close releases the reference the decoder holds to shared Globals. The
+// decoder must not be used afterwards. Closing a decoder without shared
+// Globals, or closing it again, does nothing.
+func (d *Decoder) Close() {
+	if d.globals != nil {
+		d.globals.Release()
+		d.globals = nil
+	}
+}
+
+// FirstPageInfo returns the page information of the first page in data
+// without decoding any region segments. The height of a striped page of
+// unknown height is taken from its last end-of-stripe segment.
+func FirstPageInfo(data []byte) (*PageInfo, error) {
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ctx.firstPageInfo(true)
+}
+
+// DeclaredPageInfo returns the page information segment of the first page
+// in data as declared, reading nothing after it: a striped page of unknown
+// height reports a Height of 0xffffffff. Unless complete is set, data may hold
+// only the start of a file, and it fails with an error matching
+// ErrTruncated or ErrNeedMoreData when the page information depends on
+// bytes past the end of data.
+func DeclaredPageInfo(data []byte, complete bool) (*PageInfo, error) {
+	trimmed, header, err := stripJBIG2FileHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	ctx := newContext(trimmed, 0, nil, false)
+	ctx.fileHeader = header
+	ctx.awaitingData = !complete
+	if header != nil && header.RandomAccess() {
+		if err := ctx.parseSegmentHeaderTable(); err != nil {
+			return nil, err
+		}
+	}
+	return ctx.firstPageInfo(false)
 }
 
 // DecodeAll processes all segments in the JBIG2 stream.
@@ -43,14 +185,66 @@ func (d *Decoder) DecodeAll() error {
 	return err
 }
 
+// DecodeAllContext is like DecodeAll but stops once ctx is done, with an
+// error satisfying errors.Is(err, ctx.Err()); inside a segment it is wrapped
+// in a *DecodeError. Cancellation is checked between segments and inside the row,
+// instance and grid loops of the region decoders.
+func (d *Decoder) DecodeAllContext(ctx context.Context) error {
+	d.ctx.SetCancel(ctx)
+	defer d.ctx.SetCancel(nil)
+	return d.DecodeAll()
+}
+
+// NextPage decodes and returns the next complete page, or io.EOF once the
+// stream holds no further pages.
+func (d *Decoder) NextPage() (*Image, *PageInfo, error) {
+	if err := d.ctx.decodeGlobals(nil); err != nil {
+		return nil, nil, err
+	}
+	return d.ctx.NextPage()
+}
+
+// DecodeRegion is like NextPage but decodes only rect, in page coordinates,
+// of the next page. The returned image covers the part of rect inside the
+// page, with its origin at the top-left corner of that part.
+func (d *Decoder) DecodeRegion(rect Rect) (*Image, *PageInfo, error) {
+	d.ctx.SetClip(&rect)
+	defer d.ctx.SetClip(nil)
+	return d.NextPage()
+}
+
+// NextPageContext is like NextPage but stops once ctx is done; see
+// DecodeAllContext.
+func (d *Decoder) NextPageContext(ctx context.Context) (*Image, *PageInfo, error) {
+	d.ctx.SetCancel(ctx)
+	defer d.ctx.SetCancel(nil)
+	return d.NextPage()
+}
+
 // GetFirstPage prepares the first page for rendering.
 func (d *Decoder) GetFirstPage(buf []byte, width, height, stride int) (bool, error) {
-	return d.ctx.GetFirstPage(buf, width, height, stride, nil)
+	return d.ctx.GetFirstPage(buf, width, height, stride, d.pause)
+}
+
+// GetFirstPageContext is like GetFirstPage but stops once ctx is done; see
+// DecodeAllContext.
+func (d *Decoder) GetFirstPageContext(ctx context.Context, buf []byte, width, height, stride int) (bool, error) {
+	d.ctx.SetCancel(ctx)
+	defer d.ctx.SetCancel(nil)
+	return d.GetFirstPage(buf, width, height, stride)
 }
 
 // Continue resumes decoding after a pause.
 func (d *Decoder) Continue() (bool, error) {
-	return d.ctx.Continue(nil)
+	return d.ctx.Continue(d.pause)
+}
+
+// ContinueContext is like Continue but stops once ctx is done; see
+// DecodeAllContext.
+func (d *Decoder) ContinueContext(ctx context.Context) (bool, error) {
+	d.ctx.SetCancel(ctx)
+	defer d.ctx.SetCancel(nil)
+	return d.Continue()
 }
 
 // GetPageImage returns the current decoded page image.
@@ -63,7 +257,44 @@ func (d *Decoder) GetProcessingStatus() CodecStatus {
 	return d.ctx.ProcessingStatus()
 }
 
-// GetSegments returns all decoded segments.
+// GetSegments returns all decoded segments. Unless release is enabled they
+// keep their results.
 func (d *Decoder) GetSegments() []*Segment {
 	return d.ctx.Segments()
 }
+
+// FileHeader returns the parsed file header, or nil for an embedded stream.
+func (d *Decoder) FileHeader() *FileHeader {
+	return d.ctx.FileHeader()
+}
+
+// ColourPage returns the colour rendering of the most recent page, or nil
+// for a bilevel page.
+func (d *Decoder) ColourPage() *image.RGBA {
+	return d.ctx.ColourPage()
+}
+
+// Damage returns the region segments skipped so far in recovery mode.
+func (d *Decoder) Damage() []Damage {
+	return d.ctx.Damage()
+}
+
+// Comments returns the comment extensions decoded so far.
+func (d *Decoder) Comments() []Comment {
+	return d.ctx.Comments()
+}
+
+// Profiles returns the profiles declared by the stream so far.
+func (d *Decoder) Profiles() []uint32 {
+	return d.ctx.Profiles()
+}
+
+// LiveBytes returns the bitmap storage the decoder currently holds.
+func (d *Decoder) LiveBytes() uint64 {
+	return d.ctx.LiveBytes()
+}
+
+// PageInfos returns the page information segments parsed so far.
+func (d *Decoder) PageInfos() []*PageInfo {
+	return d.ctx.PageInfos()
+}
@@ -8,6 +8,12 @@ type RegionInfo struct {
 	X      int32
 	Y      int32
 	Flags  uint8
+
+	// Colour extension: palette indices of the foreground and background,
+	// present when Colour is set.
+	Colour     bool
+	Foreground uint16
+	Background uint16
 }
 
 // HuffmanCode represents a single code entry in a JBIG2 Huffman table.
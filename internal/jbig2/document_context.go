@@ -1,17 +1,136 @@
 package jbig2
 
+import (
+	"container/list"
+	"sync"
+)
+
+// defaultSymbolDictCacheEntries is the cache capacity of the reference
+// implementation.
+const defaultSymbolDictCacheEntries = 2
+
+// arithContextBytes is the storage of one ArithContext.
+const arithContextBytes = 2
+
+// CompoundKey identifies cached symbol dictionaries using the stream key and index.
+type CompoundKey struct {
+	StreamKey uint64
+	Segment   uint32
+}
+
 // DocumentContext holds per-document JBIG2 state, primarily the LRU cache of
-// symbol dictionaries shared across page contexts.
+// symbol dictionaries shared across page contexts. It is safe for
+// concurrent use, so decoders running in parallel may share it. Cached
+// dictionaries are private copies that are never modified; lookups hand out
+// further copies.
 type DocumentContext struct {
-	symbolDictCache []CachePair
+	mu         sync.Mutex
+	maxEntries int
+	maxBytes   uint64
+	bytes      uint64
+	lru        *list.List // of *cacheEntry, most recently used first
+	entries    map[CompoundKey]*list.Element
+	stats      CacheStats
 }
 
-// NewDocumentContext creates an empty document context.
+type cacheEntry struct {
+	key   CompoundKey
+	dict  *SymbolDict
+	bytes uint64
+}
+
+// CacheStats reports the activity of a DocumentContext cache.
+type CacheStats struct {
+	Hits      uint64
+	Misses    uint64
+	Evictions uint64
+	Entries   int
+	Bytes     uint64
+}
+
+// NewDocumentContext creates an empty document context caching up to two
+// symbol dictionaries, like the reference implementation.
 func NewDocumentContext() *DocumentContext {
-	return &DocumentContext{symbolDictCache: make([]CachePair, 0, symbolDictCacheMaxSize)}
+	return NewDocumentContextWithLimits(defaultSymbolDictCacheEntries, 0)
+}
+
+// NewDocumentContextWithLimits creates an empty document context caching up
+// to maxEntries symbol dictionaries taking up to maxBytes of storage. A
+// maxEntries of zero or less selects the default of two entries and a
+// maxBytes of zero imposes no byte bound.
+func NewDocumentContextWithLimits(maxEntries int, maxBytes uint64) *DocumentContext {
+	if maxEntries <= 0 {
+		maxEntries = defaultSymbolDictCacheEntries
+	}
+	return &DocumentContext{
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+		lru:        list.New(),
+		entries:    make(map[CompoundKey]*list.Element),
+	}
+}
+
+// LookupSymbolDict returns the dictionary cached under key and marks it as
+// the most recently used. The result is shared and must not be modified.
+func (dc *DocumentContext) LookupSymbolDict(key CompoundKey) (*SymbolDict, bool) {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	elem, ok := dc.entries[key]
+	if !ok {
+		dc.stats.Misses++
+		return nil, false
+	}
+	dc.stats.Hits++
+	dc.lru.MoveToFront(elem)
+	return elem.Value.(*cacheEntry).dict, true
+}
+
+// StoreSymbolDict caches dict under key, which the caller must no longer
+// modify, evicting the least recently used entries beyond the limits. A
+// dictionary larger than the byte limit is not cached.
+func (dc *DocumentContext) StoreSymbolDict(key CompoundKey, dict *SymbolDict) {
+	if dict == nil {
+		return
+	}
+	size := symbolDictBytes(dict)
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	if elem, ok := dc.entries[key]; ok {
+		dc.remove(elem)
+	}
+	if dc.maxBytes != 0 && size > dc.maxBytes {
+		return
+	}
+	dc.entries[key] = dc.lru.PushFront(&cacheEntry{key: key, dict: dict, bytes: size})
+	dc.bytes += size
+	for dc.lru.Len() > dc.maxEntries || (dc.maxBytes != 0 && dc.bytes > dc.maxBytes) {
+		dc.remove(dc.lru.Back())
+		dc.stats.Evictions++
+	}
+}
+
+// Stats returns the cache statistics accumulated so far.
+func (dc *DocumentContext) Stats() CacheStats {
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+	stats := dc.stats
+	stats.Entries = dc.lru.Len()
+	stats.Bytes = dc.bytes
+	return stats
+}
+
+func (dc *DocumentContext) remove(elem *list.Element) {
+	entry := dc.lru.Remove(elem).(*cacheEntry)
+	delete(dc.entries, entry.key)
+	dc.bytes -= entry.bytes
 }
 
-// SymbolDictCache returns a pointer to the LRU cache slice used by decoding contexts.
-func (dc *DocumentContext) SymbolDictCache() *[]CachePair {
-	return &dc.symbolDictCache
+// symbolDictBytes returns the storage of the symbol bitmaps and retained
+// arithmetic contexts of d.
+func symbolDictBytes(d *SymbolDict) uint64 {
+	n := uint64(len(d.gbContexts)+len(d.grContexts)) * arithContextBytes
+	for _, sym := range d.symbols {
+		n += imageBytes(sym)
+	}
+	return n
 }
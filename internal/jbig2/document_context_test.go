@@ -0,0 +1,81 @@
+package jbig2
+
+import (
+	"sync"
+	"testing"
+)
+
+// testDict returns a dictionary of one w×h symbol.
+func testDict(w, h int32) *SymbolDict {
+	d := NewSymbolDict()
+	d.AddImage(NewImage(w, h))
+	return d
+}
+
+func TestDocumentContextLRU(t *testing.T) {
+	doc := NewDocumentContextWithLimits(2, 0)
+	a, b, c := CompoundKey{1, 0}, CompoundKey{1, 10}, CompoundKey{1, 20}
+	doc.StoreSymbolDict(a, testDict(8, 1))
+	doc.StoreSymbolDict(b, testDict(8, 1))
+	if _, ok := doc.LookupSymbolDict(a); !ok {
+		t.Fatal("dictionary a missing")
+	}
+	doc.StoreSymbolDict(c, testDict(8, 1))
+	if _, ok := doc.LookupSymbolDict(b); ok {
+		t.Error("least recently used dictionary b was not evicted")
+	}
+	for _, key := range []CompoundKey{a, c} {
+		if _, ok := doc.LookupSymbolDict(key); !ok {
+			t.Errorf("dictionary %v missing", key)
+		}
+	}
+	want := CacheStats{Hits: 3, Misses: 1, Evictions: 1, Entries: 2, Bytes: 8}
+	if got := doc.Stats(); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestDocumentContextByteLimit(t *testing.T) {
+	// Each 32x4 symbol takes 16 bytes.
+	doc := NewDocumentContextWithLimits(10, 40)
+	for i := uint32(0); i < 3; i++ {
+		doc.StoreSymbolDict(CompoundKey{1, i}, testDict(32, 4))
+	}
+	if got := doc.Stats(); got.Entries != 2 || got.Bytes != 32 || got.Evictions != 1 {
+		t.Errorf("Stats = %+v, want 2 entries of 32 bytes after 1 eviction", got)
+	}
+	if _, ok := doc.LookupSymbolDict(CompoundKey{1, 0}); ok {
+		t.Error("oldest dictionary was not evicted")
+	}
+	doc.StoreSymbolDict(CompoundKey{2, 0}, testDict(32, 12))
+	if _, ok := doc.LookupSymbolDict(CompoundKey{2, 0}); ok {
+		t.Error("dictionary larger than the byte limit was cached")
+	}
+	if got := doc.Stats(); got.Entries != 2 {
+		t.Errorf("oversized dictionary evicted others: %+v", got)
+	}
+}
+
+func TestDocumentContextConcurrent(t *testing.T) {
+	doc := NewDocumentContextWithLimits(4, 0)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 100 {
+				key := CompoundKey{uint64(g % 3), uint32(i % 6)}
+				if d, ok := doc.LookupSymbolDict(key); ok {
+					d.DeepCopy()
+				} else {
+					doc.StoreSymbolDict(key, testDict(8, 2))
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	s := doc.Stats()
+	if s.Hits+s.Misses != 800 || s.Entries > 4 {
+		t.Errorf("unexpected stats %+v", s)
+	}
+}
@@ -0,0 +1,120 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Sentinel errors classifying decode failures. Errors returned by the
+// decoder match at most one of them with errors.Is.
+var (
+	// ErrTruncated reports that the data ended before a structure was
+	// complete.
+	ErrTruncated = errors.New("jbig2: truncated data")
+	// ErrCorrupt reports data that violates the format.
+	ErrCorrupt = errors.New("jbig2: corrupt data")
+	// ErrUnsupported reports a valid feature the decoder does not implement.
+	ErrUnsupported = errors.New("jbig2: unsupported feature")
+	// ErrLimitExceeded reports that the stream asked for more resources
+	// than the configured Limits allow.
+	ErrLimitExceeded = errors.New("jbig2: resource limit exceeded")
+	// ErrProfileViolation reports, in strict mode, a stream that breaks the
+	// restrictions of a profile it declares.
+	ErrProfileViolation = errors.New("jbig2: profile violation")
+)
+
+// errorKinds lists the sentinels in a fixed order, which serialized decoder
+// states rely on.
+var errorKinds = []error{ErrTruncated, ErrCorrupt, ErrUnsupported, ErrLimitExceeded, ErrProfileViolation}
+
+// kindError tags an error with one of the sentinels without changing its
+// message.
+type kindError struct {
+	kind error
+	err  error
+}
+
+func (e *kindError) Error() string   { return e.err.Error() }
+func (e *kindError) Unwrap() []error { return []error{e.kind, e.err} }
+
+// withKind tags err with kind.
+func withKind(kind, err error) error {
+	return &kindError{kind: kind, err: err}
+}
+
+// truncatedf returns an ErrTruncated error with the formatted message.
+func truncatedf(format string, args ...any) error {
+	return withKind(ErrTruncated, fmt.Errorf(format, args...))
+}
+
+// unsupportedf returns an ErrUnsupported error with the formatted message.
+func unsupportedf(format string, args ...any) error {
+	return withKind(ErrUnsupported, fmt.Errorf(format, args...))
+}
+
+// classified reports whether err already matches one of the sentinels.
+func classified(err error) bool {
+	return errorKind(err) != nil
+}
+
+// errorKind returns the sentinel err matches, or nil.
+func errorKind(err error) error {
+	for _, kind := range errorKinds {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
+
+// ErrorStage identifies the step of segment processing that failed.
+type ErrorStage int
+
+const (
+	// StageHeader covers parsing the segment header.
+	StageHeader ErrorStage = iota
+	// StageData covers decoding the segment data.
+	StageData
+	// StageCompose covers composing a decoded region onto the page.
+	StageCompose
+)
+
+func (s ErrorStage) String() string {
+	switch s {
+	case StageHeader:
+		return "header"
+	case StageData:
+		return "data"
+	case StageCompose:
+		return "compose"
+	default:
+		return fmt.Sprintf("ErrorStage(%d)", int(s))
+	}
+}
+
+// DecodeError describes a failure while processing a segment. It unwraps to
+// the underlying error, which matches one of ErrTruncated, ErrCorrupt,
+// ErrUnsupported, ErrLimitExceeded or ErrProfileViolation unless decoding
+// was cancelled.
+type DecodeError struct {
+	// Segment is the segment number, if the header was read far enough.
+	Segment uint32
+	// Type is the segment type, if the header was read far enough.
+	Type uint8
+	// Page is the page association of the segment.
+	Page uint32
+	// Offset is the byte offset in the input of the segment header for
+	// header errors and of the segment data otherwise.
+	Offset uint64
+	// Stage is the processing step that failed.
+	Stage ErrorStage
+	// Err is the underlying error.
+	Err error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("jbig2: segment %d (type %d, page %d) at offset %d: %s: %v",
+		e.Segment, e.Type, e.Page, e.Offset, e.Stage, e.Err)
+}
+
+func (e *DecodeError) Unwrap() error { return e.Err }
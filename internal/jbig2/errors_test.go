@@ -0,0 +1,126 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func decodeFirstPageError(t *testing.T, data []byte) error {
+	t.Helper()
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	_, _, err = ctx.NextPage()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	return err
+}
+
+func TestDecodeErrorTruncatedSegment(t *testing.T) {
+	pageInfo := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 16, 0, 0)})
+	region := buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(16, 16, 0), 0, 0, 0)})
+	data := sequentialFile(pageInfo, region[:len(region)-8])
+
+	err := decodeFirstPageError(t, data)
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected ErrTruncated, got %v", err)
+	}
+	if errors.Is(err, ErrCorrupt) {
+		t.Fatalf("truncated data also matched ErrCorrupt: %v", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("expected a *DecodeError, got %T", err)
+	}
+	wantOffset := uint64(len(jbig2FileSignature) + 1 + len(pageInfo) + 11)
+	if de.Segment != 1 || de.Type != segmentTypeGenericRegionImmediateLossless || de.Page != 1 {
+		t.Fatalf("unexpected segment in %+v", de)
+	}
+	if de.Stage != StageData || de.Offset != wantOffset {
+		t.Fatalf("expected data stage at offset %d, got %s at %d", wantOffset, de.Stage, de.Offset)
+	}
+}
+
+func TestDecodeErrorCorruptHeader(t *testing.T) {
+	pageInfo := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 16, 0, 0)})
+	data := sequentialFile(pageInfo, buildSegment(testSegment{number: 1, typ: segmentTypeEndOfPage, page: 1, refs: []uint32{1}}))
+
+	err := decodeFirstPageError(t, data)
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected a corrupt *DecodeError, got %v", err)
+	}
+	if de.Segment != 1 || de.Stage != StageHeader || de.Offset != uint64(len(jbig2FileSignature)+1+len(pageInfo)) {
+		t.Fatalf("unexpected segment, stage or offset in %+v", de)
+	}
+}
+
+func TestDecodeErrorCorruptSegment(t *testing.T) {
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(8, 8, 0), 0, 0, 0)}),
+	)
+
+	err := decodeFirstPageError(t, data)
+	if !errors.Is(err, ErrCorrupt) || errors.Is(err, ErrTruncated) {
+		t.Fatalf("expected only ErrCorrupt, got %v", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Segment != 0 || de.Stage != StageData {
+		t.Fatalf("expected a data-stage *DecodeError for segment 0, got %v", err)
+	}
+}
+
+func TestDecodeErrorUnsupported(t *testing.T) {
+	pageInfo := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 16, 0, 0)})
+	symbolDict := func(flags uint16) []byte {
+		return binary.BigEndian.AppendUint16(nil, flags)
+	}
+	tests := []struct {
+		name    string
+		segment testSegment
+	}{
+		{"halftone combination operator", testSegment{number: 1, typ: segmentTypeHalftoneRegionImmediateLossless, page: 1,
+			data: binary.BigEndian.AppendUint16(regionInfoData(8, 8, 0, 0, 0), 5<<4)}},
+		{"SDHUFFDH", testSegment{number: 1, typ: segmentTypeSymbolDict, page: 1,
+			data: append(symbolDict(0x0001|2<<2), make([]byte, 8)...)}},
+		{"SDHUFFDW", testSegment{number: 1, typ: segmentTypeSymbolDict, page: 1,
+			data: append(symbolDict(0x0001|2<<4), make([]byte, 8)...)}},
+	}
+	for _, tt := range tests {
+		err := decodeFirstPageError(t, sequentialFile(pageInfo, buildSegment(tt.segment)))
+		if !errors.Is(err, ErrUnsupported) || errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected only ErrUnsupported, got %v", tt.name, err)
+		}
+		var de *DecodeError
+		if !errors.As(err, &de) || de.Segment != 1 {
+			t.Errorf("%s: expected a *DecodeError for segment 1, got %v", tt.name, err)
+		}
+	}
+
+	if _, err := NewGRDProc().ContinueDecode(nil); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("progressive decode type: expected ErrUnsupported, got %v", err)
+	}
+}
+
+func TestDecodeErrorLimitExceeded(t *testing.T) {
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 16, 0, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(16, 16, 0), 0, 0, 0)}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetLimits(Limits{MaxRegionPixels: 255})
+	_, _, err = ctx.NextPage()
+	if !errors.Is(err, ErrLimitExceeded) || errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected only ErrLimitExceeded, got %v", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Segment != 1 || de.Stage != StageData {
+		t.Fatalf("expected a data-stage *DecodeError for segment 1, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+	"unicode/utf16"
+)
+
+const segmentTypeExtension = 62
+
+// Extension types. The necessary bit marks extensions a decoder must
+// understand to decode the stream correctly.
+const (
+	extensionNecessary    = 0x80000000
+	extensionCommentASCII = 0x20000000
+	extensionCommentUCS2  = 0x20000002
+)
+
+// Comment is a name/value pair from a comment extension segment.
+type Comment struct {
+	Segment uint32 // number of the extension segment
+	Page    uint32 // page association of the extension segment
+	Name    string
+	Value   string
+}
+
+// Comments returns the comments of the extension segments decoded so far,
+// those of the global context first.
+func (c *Context) Comments() []Comment {
+	var out []Comment
+	if c.globalContext != nil {
+		out = append(out, c.globalContext.comments...)
+	}
+	return append(out, c.comments...)
+}
+
+func (c *Context) parseExtensionSegment(seg *Segment) (DecodeResult, error) {
+	if seg.DataLength < 4 || seg.DataLength == unknownDataLength {
+		return DecodeResultFailure, fmt.Errorf("jbig2: extension segment of %d bytes", seg.DataLength)
+	}
+	typ, err := c.stream.ReadUint32()
+	if err != nil {
+		return DecodeResultFailure, err
+	}
+	data := c.stream.Pointer()
+	if uint64(len(data)) < uint64(seg.DataLength-4) {
+		return DecodeResultFailure, truncatedf("jbig2: extension segment extends past end of data")
+	}
+	data = data[:seg.DataLength-4]
+
+	var (
+		pairs    [][2]string
+		complete = true
+	)
+	switch typ {
+	case extensionCommentASCII:
+		pairs, complete = parseComments(data, 1, func(b []byte) string { return string(b) })
+	case extensionCommentUCS2:
+		pairs, complete = parseComments(data, 2, decodeUCS2)
+	default:
+		if typ&extensionNecessary != 0 {
+			return DecodeResultFailure, unsupportedf("jbig2: unsupported necessary extension 0x%08x", typ)
+		}
+		c.warn(seg, "unknown extension skipped", slog.String("extension", fmt.Sprintf("0x%08x", typ)))
+	}
+	if !complete {
+		c.warn(seg, "comment list truncated", slog.Int("comments", len(pairs)))
+	}
+	for _, p := range pairs {
+		c.comments = append(c.comments, Comment{Segment: seg.Number, Page: seg.PageAssociation, Name: p[0], Value: p[1]})
+	}
+	c.stream.AddOffset(seg.DataLength - 4)
+	return DecodeResultSuccess, nil
+}
+
+// parseComments splits comment data into name/value pairs. Each string is
+// terminated by a zero character of size bytes and the list by an empty
+// name. A truncated trailing pair is dropped and reported by complete.
+func parseComments(data []byte, size int, decode func([]byte) string) (pairs [][2]string, complete bool) {
+	next := func() (string, bool) {
+		for i := 0; i+size <= len(data); i += size {
+			if isZero(data[i : i+size]) {
+				s := decode(data[:i])
+				data = data[i+size:]
+				return s, true
+			}
+		}
+		return "", false
+	}
+	for {
+		name, ok := next()
+		if !ok || name == "" {
+			return pairs, ok
+		}
+		value, ok := next()
+		if !ok {
+			return pairs, false
+		}
+		pairs = append(pairs, [2]string{name, value})
+	}
+}
+
+func isZero(b []byte) bool {
+	for _, v := range b {
+		if v != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeUCS2 decodes big-endian UCS-2 text. Surrogate pairs, which UCS-2
+// does not define but encoders may emit, are combined.
+func decodeUCS2(b []byte) string {
+	units := make([]uint16, len(b)/2)
+	for i := range units {
+		units[i] = binary.BigEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(units))
+}
@@ -0,0 +1,62 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func extensionData(typ uint32, body ...byte) []byte {
+	return append(binary.BigEndian.AppendUint32(nil, typ), body...)
+}
+
+func TestContextCommentExtensions(t *testing.T) {
+	ascii := extensionData(extensionCommentASCII, []byte("Scanner\x00XY-200\x00Software\x00scan 1.2\x00\x00")...)
+	ucs2 := extensionData(extensionCommentUCS2,
+		0, 'T', 0, 'i', 0, 't', 0, 'l', 0, 'e', 0, 0,
+		0x00, 0xe9, 0x00, 't', 0x00, 0xe9, 0, 0,
+		0, 0)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypeExtension, data: ascii}),
+		buildSegment(testSegment{number: 1, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 8, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeExtension, page: 1, data: ucs2}),
+		buildSegment(testSegment{number: 3, typ: segmentTypeExtension, page: 1, data: extensionData(0x12345678, 1, 2, 3)}),
+		buildSegment(testSegment{number: 4, typ: segmentTypeEndOfPage, page: 1}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	if _, _, err := ctx.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	want := []Comment{
+		{Segment: 0, Name: "Scanner", Value: "XY-200"},
+		{Segment: 0, Name: "Software", Value: "scan 1.2"},
+		{Segment: 2, Page: 1, Name: "Title", Value: "été"},
+	}
+	got := ctx.Comments()
+	if len(got) != len(want) {
+		t.Fatalf("got comments %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("comment %d: got %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestContextNecessaryExtension(t *testing.T) {
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypeExtension, data: extensionData(extensionNecessary | 0x42)}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	_, err = ctx.DecodeSequential(nil)
+	var de *DecodeError
+	if !errors.Is(err, ErrUnsupported) || !errors.As(err, &de) || de.Segment != 0 || de.Type != segmentTypeExtension {
+		t.Fatalf("expected ErrUnsupported for segment 0, got %v", err)
+	}
+}
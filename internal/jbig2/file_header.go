@@ -3,10 +3,12 @@ package jbig2
 import (
 	"bytes"
 	"encoding/binary"
-	"fmt"
 )
 
-var jbig2FileSignature = []byte{0x97, 0x4a, 0x42, 0x32, 0x0d, 0x0a, 0x1a, 0x0a}
+// FileSignature is the ID string that opens every standalone JBIG2 file.
+const FileSignature = "\x97JB2\r\n\x1a\n"
+
+var jbig2FileSignature = []byte(FileSignature)
 
 // FileHeader captures the parsed JBIG2 file header fields.
 type FileHeader struct {
@@ -15,6 +17,14 @@ type FileHeader struct {
 	HasNumPage bool
 }
 
+// Sequential reports whether the file uses the sequential organisation, in
+// which each segment header is immediately followed by its data.
+func (h *FileHeader) Sequential() bool { return h.Flags&0x01 != 0 }
+
+// RandomAccess reports whether the file uses the random-access organisation,
+// in which all segment headers precede all segment data.
+func (h *FileHeader) RandomAccess() bool { return !h.Sequential() }
+
 // stripJBIG2FileHeader removes the JBIG2 file header if present. JBIG2 files
 // begin with an 8-byte signature followed by a little-endian flags field and a
 // little-endian number-of-pages field. The decoder expects to consume raw
@@ -29,14 +39,14 @@ func stripJBIG2FileHeader(data []byte) ([]byte, *FileHeader, error) {
 	}
 	// Signature (8 bytes) + 1 byte flags + optional 4 byte page count when known.
 	if len(data) < len(jbig2FileSignature)+1 {
-		return nil, nil, fmt.Errorf("jbig2: truncated file header, need at least %d bytes", len(jbig2FileSignature)+1)
+		return nil, nil, truncatedf("jbig2: truncated file header, need at least %d bytes", len(jbig2FileSignature)+1)
 	}
 	flags := data[8]
 	offset := len(jbig2FileSignature) + 1
 	header := &FileHeader{Flags: flags}
 	if flags&0x02 == 0 {
 		if len(data) < offset+4 {
-			return nil, nil, fmt.Errorf("jbig2: truncated file header, missing page count")
+			return nil, nil, truncatedf("jbig2: truncated file header, missing page count")
 		}
 		header.NumPages = binary.BigEndian.Uint32(data[offset : offset+4])
 		header.HasNumPage = true
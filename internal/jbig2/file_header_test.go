@@ -53,3 +53,12 @@ func TestStripJBIG2FileHeader_Truncated(t *testing.T) {
 		t.Fatal("expected error for truncated header")
 	}
 }
+
+func TestFileHeaderOrganisation(t *testing.T) {
+	if h := (&FileHeader{Flags: 0x01}); !h.Sequential() || h.RandomAccess() {
+		t.Fatal("flags 0x01 should select the sequential organisation")
+	}
+	if h := (&FileHeader{Flags: 0x02}); h.Sequential() || !h.RandomAccess() {
+		t.Fatal("flags 0x02 should select the random-access organisation")
+	}
+}
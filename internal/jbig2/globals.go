@@ -0,0 +1,138 @@
+package jbig2
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+)
+
+var errGlobalsReleased = errors.New("jbig2: globals have been released")
+
+// Globals is a global data stream decoded once and shared, read-only, by any
+// number of decoders, which may run concurrently. Decoders refer to its
+// dictionaries and tables without copying them.
+//
+// Globals are reference counted: ParseGlobals returns them holding one
+// reference for the caller, and every decoder using them holds another
+// until it is closed. Once the last reference is released the decoded
+// results are dropped and further decoders cannot be created from them.
+type Globals struct {
+	ctx  *Context
+	refs atomic.Int64
+}
+
+// GlobalsOptions configures ParseGlobals.
+type GlobalsOptions struct {
+	// Limits bounds the resources decoding the global data stream may use.
+	// The decoded results stay charged to this budget until the last
+	// reference is released.
+	Limits Limits
+	// Logger receives warnings about non-fatal anomalies; see
+	// Context.SetLogger.
+	Logger *slog.Logger
+}
+
+// ParseGlobals decodes every segment of the global data stream data. The
+// segments may be preceded by a file header.
+func ParseGlobals(data []byte, opts GlobalsOptions) (*Globals, error) {
+	return parseGlobals(data, opts, nil)
+}
+
+// ParseGlobalsContext is like ParseGlobals but stops once ctx is done, with
+// an error satisfying errors.Is(err, ctx.Err()); inside a segment it is
+// wrapped in a *DecodeError.
+func ParseGlobalsContext(ctx context.Context, data []byte, opts GlobalsOptions) (*Globals, error) {
+	return parseGlobals(data, opts, ctx)
+}
+
+func parseGlobals(data []byte, opts GlobalsOptions, cancel CancelIndicator) (*Globals, error) {
+	if len(data) == 0 {
+		return nil, errors.New("jbig2: empty global data")
+	}
+	trimmed, header, err := stripJBIG2FileHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	ctx := newContext(trimmed, 0, nil, true)
+	ctx.fileHeader = header
+	ctx.baseOffset = uint64(len(data) - len(trimmed))
+	ctx.SetLimits(opts.Limits)
+	ctx.SetLogger(opts.Logger)
+	if cancel != nil {
+		ctx.SetCancel(cancel)
+	}
+	_, err = ctx.DecodeSequential(nil)
+	ctx.SetCancel(nil)
+	if err != nil {
+		return nil, err
+	}
+	g := &Globals{ctx: ctx}
+	g.refs.Store(1)
+	return g, nil
+}
+
+// Acquire adds a reference to g. It fails once the last reference has been
+// released.
+func (g *Globals) Acquire() error {
+	for {
+		n := g.refs.Load()
+		if n <= 0 {
+			return errGlobalsReleased
+		}
+		if g.refs.CompareAndSwap(n, n+1) {
+			return nil
+		}
+	}
+}
+
+// Release drops a reference to g. Releasing the last reference drops the
+// decoded results; releasing more references than were taken is a no-op.
+func (g *Globals) Release() {
+	for {
+		n := g.refs.Load()
+		if n <= 0 {
+			return
+		}
+		if g.refs.CompareAndSwap(n, n-1) {
+			if n == 1 {
+				for _, seg := range g.ctx.segments {
+					seg.release(g.ctx.budget)
+				}
+			}
+			return
+		}
+	}
+}
+
+// Refs returns the number of references currently held.
+func (g *Globals) Refs() int {
+	return int(g.refs.Load())
+}
+
+// LiveBytes returns the bitmap storage held by the decoded results.
+func (g *Globals) LiveBytes() uint64 {
+	if g.refs.Load() <= 0 {
+		return 0
+	}
+	return g.ctx.segmentBytes()
+}
+
+// Segments returns the decoded global segments. They must not be modified.
+func (g *Globals) Segments() []*Segment {
+	return g.ctx.segments
+}
+
+// UseGlobals makes c resolve global segments in g instead of a global data
+// stream of its own. The caller must hold a reference to g for as long as c
+// is in use. The results of g are charged to the budget of c, as the
+// results of a private global data stream would be, and an error is
+// returned when they do not fit.
+func (c *Context) UseGlobals(g *Globals) error {
+	if err := c.budget.Allocate(g.LiveBytes()); err != nil {
+		return err
+	}
+	c.globalContext = g.ctx
+	c.sharedGlobals = true
+	return nil
+}
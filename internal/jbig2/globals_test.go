@@ -0,0 +1,142 @@
+package jbig2
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image/color"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestGlobalsSharedByConcurrentDecoders(t *testing.T) {
+	red := color.RGBA{R: 0xff, A: 0xff}
+	comment := binary.BigEndian.AppendUint32(nil, extensionCommentASCII)
+	comment = append(comment, "Title\x00shared\x00\x00"...)
+	globals, err := ParseGlobals(append(
+		buildSegment(testSegment{number: 0, typ: segmentTypeColourPalette, data: paletteData(colourBlack, red)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeExtension, data: comment})...,
+	), GlobalsOptions{})
+	if err != nil {
+		t.Fatalf("ParseGlobals returned error: %v", err)
+	}
+	palette := globals.Segments()[0]
+
+	pattern := testPattern(8, 8, 2)
+	data := buildSegment(testSegment{number: 2, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 8, 0xc0, 0)})
+	data = append(data, buildSegment(testSegment{number: 3, typ: segmentTypeGenericRegionImmediateLossless, page: 1, refs: []uint32{0},
+		data: colourRegion(genericRegionData(pattern, 0, 0, 0), 1, noBackground)})...)
+	data = append(data, buildSegment(testSegment{number: 4, typ: segmentTypeEndOfPage, page: 1})...)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			dec, err := NewDecoder(DecoderOptions{SrcData: data, Globals: globals})
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer dec.Close()
+			if _, _, err := dec.NextPage(); err != nil {
+				errs <- err
+				return
+			}
+			if dec.ctx.findSegmentByNumber(0) != palette {
+				errs <- errors.New("decoder does not share the global segment")
+			}
+			for y := int32(0); y < 8; y++ {
+				for x := int32(0); x < 8; x++ {
+					if pattern.GetPixel(x, y) != 0 && dec.ColourPage().RGBAAt(int(x), int(y)) != red {
+						errs <- errors.New("global palette not applied")
+						return
+					}
+				}
+			}
+			if got := dec.Comments(); len(got) != 1 || got[0].Value != "shared" {
+				errs <- errors.New("global comment missing")
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if got := globals.Refs(); got != 1 {
+		t.Errorf("Refs = %d after closing the decoders, want 1", got)
+	}
+	globals.Release()
+	if globals.Refs() != 0 || palette.Palette != nil {
+		t.Error("releasing the last reference kept the decoded results")
+	}
+	if _, err := NewDecoder(DecoderOptions{SrcData: data, Globals: globals}); !errors.Is(err, errGlobalsReleased) {
+		t.Errorf("NewDecoder with released globals returned %v", err)
+	}
+}
+
+func TestGlobalsExclusiveWithGlobalData(t *testing.T) {
+	globals, err := ParseGlobals(buildSegment(testSegment{number: 0, typ: segmentTypeColourPalette, data: paletteData(colourBlack)}), GlobalsOptions{})
+	if err != nil {
+		t.Fatalf("ParseGlobals returned error: %v", err)
+	}
+	src := buildSegment(testSegment{number: 1, typ: segmentTypeEndOfFile})
+	if _, err := NewDecoder(DecoderOptions{SrcData: src, GlobalData: src, Globals: globals}); err == nil {
+		t.Error("NewDecoder accepted both GlobalData and Globals")
+	}
+	if _, err := ParseGlobals(buildSegment(testSegment{number: 0, typ: segmentTypeColourPalette, data: []byte{paletteRGB, 0, 2, 1}}), GlobalsOptions{}); err == nil {
+		t.Error("ParseGlobals accepted a truncated palette")
+	}
+}
+
+func TestParseGlobalsOptions(t *testing.T) {
+	data := append(
+		buildSegment(testSegment{number: 0, typ: segmentTypeColourPalette, data: paletteData(colourBlack)}),
+		buildSegment(testSegment{number: 1, typ: 33, data: []byte{1, 2, 3}})...,
+	)
+	if _, err := ParseGlobals(data, GlobalsOptions{Limits: Limits{MaxSegments: 1}}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("ParseGlobals over the segment limit returned %v, want ErrLimitExceeded", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseGlobalsContext(ctx, data, GlobalsOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("ParseGlobalsContext with a cancelled context returned %v", err)
+	}
+
+	var buf bytes.Buffer
+	globals, err := ParseGlobals(data, GlobalsOptions{
+		Limits: Limits{MaxAllocBytes: 1 << 20},
+		Logger: slog.New(slog.NewTextHandler(&buf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("ParseGlobals returned error: %v", err)
+	}
+	defer globals.Release()
+	if !strings.Contains(buf.String(), "unknown segment type skipped") {
+		t.Errorf("unknown global segment not logged: %q", buf.String())
+	}
+
+	// The shared results count against the limits of every decoder.
+	globals.Segments()[0].SymbolDict = testDict(64, 16)
+	src := buildSegment(testSegment{number: 2, typ: segmentTypeEndOfFile})
+	if _, err := NewDecoder(DecoderOptions{SrcData: src, Globals: globals, Limits: Limits{MaxAllocBytes: 100}}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("NewDecoder with globals over its limit returned %v, want ErrLimitExceeded", err)
+	}
+	if got := globals.Refs(); got != 1 {
+		t.Errorf("Refs = %d after a failed NewDecoder, want 1", got)
+	}
+	dec, err := NewDecoder(DecoderOptions{SrcData: src, Globals: globals, Limits: Limits{MaxAllocBytes: 200}})
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	defer dec.Close()
+	if got := dec.ctx.Budget().Allocated(); got != 8*16 {
+		t.Errorf("decoder budget charged %d bytes, want 128", got)
+	}
+}
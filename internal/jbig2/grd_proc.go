@@ -19,14 +19,18 @@ const (
 
 // GRDProc implements the JBIG2 generic region decoding parameters.
 type GRDProc struct {
-	MMR         bool
-	TPGDON      bool
-	UseSkip     bool
-	GBTemplate  uint8
-	GBWidth     uint32
-	GBHeight    uint32
-	Skip        *Image
-	GBAt        [8]int32
+	MMR        bool
+	TPGDON     bool
+	UseSkip    bool
+	GBTemplate uint8
+	GBWidth    uint32
+	GBHeight   uint32
+	Skip       *Image
+	GBAt       [8]int32
+	Cancel     CancelIndicator
+	// OnRows, when set, is called with the half-open range of rows that have
+	// finished decoding.
+	OnRows      func(top, bottom int)
 	replaceRect Rect
 
 	progressiveStatus CodecStatus
@@ -41,6 +45,10 @@ func NewGRDProc() *GRDProc { return &GRDProc{} }
 // ReplaceRect returns the rectangle within the page that should be replaced by the decoded image.
 func (p *GRDProc) ReplaceRect() Rect { return p.replaceRect }
 
+// DecodedRows returns the number of rows a progressive arithmetic decode
+// has finished.
+func (p *GRDProc) DecodedRows() int { return p.loopIndex }
+
 // DecodeArith decodes a generic region using arithmetic coding (non-progressive path).
 func (p *GRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext) (*Image, error) {
 	if decoder == nil {
@@ -105,7 +113,14 @@ func (p *GRDProc) StartDecodeMMR(img **Image, stream *BitStream) (CodecStatus, e
 
 	// Use FaxModule for MMR (G4) decoding
 	bitPos := int(stream.BitPos())
-	endBitPos := fax.FaxG4Decode(stream.Buf(), bitPos, int(p.GBWidth), int(p.GBHeight), image.stride, image.data)
+	var cancel func() error
+	if p.Cancel != nil {
+		cancel = p.Cancel.Err
+	}
+	endBitPos, err := fax.FaxG4Decode(stream.Buf(), bitPos, int(p.GBWidth), int(p.GBHeight), image.stride, image.data, cancel)
+	if err != nil {
+		return CodecStatusError, err
+	}
 
 	// Update stream position
 	stream.SetBitPos(uint32(endBitPos))
@@ -118,13 +133,16 @@ func (p *GRDProc) StartDecodeMMR(img **Image, stream *BitStream) (CodecStatus, e
 	p.replaceRect = Rect{Left: 0, Top: 0, Right: image.Width(), Bottom: image.Height()}
 
 	*img = image
+	if p.OnRows != nil {
+		p.OnRows(0, image.Height())
+	}
 	return CodecStatusFinished, nil
 }
 
 // ContinueDecode advances a progressive decode.
 func (p *GRDProc) ContinueDecode(state *GRDProgressiveState) (CodecStatus, error) {
 	if p.decodeType != 1 {
-		return CodecStatusError, errors.New("jbig2: unsupported progressive decode type")
+		return CodecStatusError, unsupportedf("jbig2: unsupported progressive decode type")
 	}
 	return p.continueArithmetic(state)
 }
@@ -142,6 +160,21 @@ type PauseIndicator interface {
 	ShouldPause() bool
 }
 
+// CancelIndicator reports whether decoding has been abandoned. Decoders poll
+// it once per row, text instance or halftone grid row and stop with the
+// returned error. A context.Context satisfies the interface.
+type CancelIndicator interface {
+	Err() error
+}
+
+// checkCancel returns the cancellation error of cancel, if any.
+func checkCancel(cancel CancelIndicator) error {
+	if cancel == nil {
+		return nil
+	}
+	return cancel.Err()
+}
+
 var (
 	optConstant1  = [...]uint16{0x9b25, 0x0795, 0x00e5}
 	optConstant9  = [...]uint32{0x000c, 0x0009, 0x0007}
@@ -175,6 +208,9 @@ func (p *GRDProc) decodeArithTemplateUnopt(decoder *ArithDecoder, contexts []Ari
 	useSkip := p.UseSkip && skipImage != nil
 
 	for h := uint32(0); h < p.GBHeight; h++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return nil, err
+		}
 		if p.TPGDON {
 			if decoder.IsComplete() {
 				return nil, errArithDecoderComplete
@@ -256,6 +292,9 @@ func (p *GRDProc) decodeArithTemplate3Unopt(decoder *ArithDecoder, contexts []Ar
 	useSkip := p.UseSkip && skipImage != nil
 
 	for h := uint32(0); h < p.GBHeight; h++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return nil, err
+		}
 		if p.TPGDON {
 			if decoder.IsComplete() {
 				return nil, errArithDecoderComplete
@@ -533,6 +572,10 @@ func (p *GRDProc) continueArithmetic(state *GRDProgressiveState) (CodecStatus, e
 	img := *state.Image
 	startLine := p.loopIndex
 	for p.loopIndex < int(p.GBHeight) {
+		if err := checkCancel(p.Cancel); err != nil {
+			p.progressiveStatus = CodecStatusError
+			return CodecStatusError, err
+		}
 		var err error
 		switch p.GBTemplate {
 		case 0, 1, 2:
@@ -555,6 +598,9 @@ func (p *GRDProc) continueArithmetic(state *GRDProgressiveState) (CodecStatus, e
 			return CodecStatusError, err
 		}
 		p.loopIndex++
+		if p.OnRows != nil {
+			p.OnRows(p.loopIndex-1, p.loopIndex)
+		}
 		if state.Pause != nil && state.Pause.ShouldPause() {
 			p.progressiveStatus = CodecStatusToBeContinued
 			p.replaceRect = Rect{Left: 0, Top: startLine, Right: img.Width(), Bottom: p.loopIndex}
@@ -753,6 +799,9 @@ func (p *GRDProc) decodeArithOpt3(decoder *ArithDecoder, contexts []ArithContext
 
 func (p *GRDProc) decodeOptLoops(decoder *ArithDecoder, contexts []ArithContext, img *Image, line []byte, stride, lineBytes, lastByte, bitsLeft, opt int, height int, ltp *int) error {
 	for h := 0; h < height; h++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return err
+		}
 		if p.TPGDON {
 			ctx, err := getArithContext(contexts, optConstant1[opt])
 			if err != nil {
@@ -892,6 +941,9 @@ func (p *GRDProc) decodeArithTemplate3Opt(decoder *ArithDecoder, contexts []Arit
 	bitsLeft := int(p.GBWidth) - lastByte*8
 
 	for h := uint32(0); h < p.GBHeight; h++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return nil, err
+		}
 		if p.TPGDON {
 			ctx, err := getArithContext(contexts, 0x0195)
 			if err != nil {
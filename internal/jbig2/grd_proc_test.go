@@ -0,0 +1,44 @@
+package jbig2
+
+import "testing"
+
+func TestGRDProcDecodeArithCancelled(t *testing.T) {
+	region := testPattern(40, 30, 5)
+	data := encodeGenericTemplate0(region)
+	for _, progressive := range []bool{false, true} {
+		proc := NewGRDProc()
+		proc.GBWidth = 40
+		proc.GBHeight = 30
+		proc.GBAt = [8]int32{3, -1, -3, -1, 2, -2, -2, -2}
+		cancel := &countingCancel{after: 7, err: errTestCancelled}
+		proc.Cancel = cancel
+		decoder := NewArithDecoder(NewBitStream(data, 0))
+		contexts := make([]ArithContext, huffContextSize(0))
+
+		var err error
+		if progressive {
+			var img *Image
+			_, err = proc.StartDecodeArith(&GRDProgressiveState{Image: &img, Decoder: decoder, Contexts: contexts})
+		} else {
+			_, err = proc.DecodeArith(decoder, contexts)
+		}
+		if err != errTestCancelled {
+			t.Fatalf("progressive=%v: expected cancellation error, got %v", progressive, err)
+		}
+		if cancel.polls != 8 {
+			t.Fatalf("progressive=%v: expected decoding to stop at row 7, polled %d times", progressive, cancel.polls)
+		}
+	}
+}
+
+func TestGRDProcDecodeMMRCancelled(t *testing.T) {
+	proc := NewGRDProc()
+	proc.MMR = true
+	proc.GBWidth = 16
+	proc.GBHeight = 16
+	proc.Cancel = &countingCancel{after: 3, err: errTestCancelled}
+	var img *Image
+	if _, err := proc.StartDecodeMMR(&img, NewBitStream(make([]byte, 64), 0)); err != errTestCancelled {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+}
@@ -12,6 +12,7 @@ type GRRDProc struct {
 	ReferenceDY int32
 	Reference   *Image
 	GRAT        [4]int8
+	Cancel      CancelIndicator
 }
 
 // NewGRRDProc constructs an empty refinement region descriptor.
@@ -50,6 +51,9 @@ func (p *GRRDProc) decodeTemplate0(decoder *ArithDecoder, contexts []ArithContex
 	refDX := p.ReferenceDX
 	refDY := p.ReferenceDY
 	for y := uint32(0); y < p.Height; y++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return err
+		}
 		if p.TPGRON {
 			if _, err := p.decodeContextBit(decoder, contexts, 0x0010); err != nil {
 				return err
@@ -99,6 +103,9 @@ func (p *GRRDProc) decodeTemplate1(decoder *ArithDecoder, contexts []ArithContex
 	refDX := p.ReferenceDX
 	refDY := p.ReferenceDY
 	for y := uint32(0); y < p.Height; y++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return err
+		}
 		if p.TPGRON {
 			if _, err := p.decodeContextBit(decoder, contexts, 0x0004); err != nil {
 				return err
@@ -24,6 +24,13 @@ type HTRDProc struct {
 	HRY         uint16
 	HPW         uint8
 	HPH         uint8
+	Cancel      CancelIndicator
+	Budget      *Budget
+	// Clip, when set, restricts rendering to a rectangle of the region; the
+	// decoded image then covers only that rectangle.
+	Clip *Rect
+
+	planes []*Image // gray-scale planes decoded so far, for PartialImage
 }
 
 // NewHTRDProc constructs a halftone region decoder configuration.
@@ -40,6 +47,9 @@ func (p *HTRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext, p
 	if expected := huffContextSize(p.HTemplate); expected != len(contexts) {
 		return nil, fmt.Errorf("jbig2: unexpected halftone context size %d, want %d", len(contexts), expected)
 	}
+	if err := p.chargeGrid(); err != nil {
+		return nil, err
+	}
 
 	var hskip *Image
 	if p.HEnableSkip {
@@ -48,6 +58,9 @@ func (p *HTRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext, p
 			return nil, errors.New("jbig2: failed to allocate halftone skip image")
 		}
 		for mg := uint32(0); mg < p.HGHeight; mg++ {
+			if err := checkCancel(p.Cancel); err != nil {
+				return nil, err
+			}
 			for ng := uint32(0); ng < p.HGWidth; ng++ {
 				mgInt := int64(mg)
 				ngInt := int64(ng)
@@ -72,6 +85,7 @@ func (p *HTRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext, p
 	}
 
 	grd := NewGRDProc()
+	grd.Cancel = p.Cancel
 	grd.GBTemplate = p.HTemplate
 	grd.TPGDON = false
 	grd.UseSkip = p.HEnableSkip
@@ -95,6 +109,7 @@ func (p *HTRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext, p
 	}
 
 	gsplanes := make([]*Image, gsbpp)
+	p.planes = gsplanes
 	for idx := int(gsbpp) - 1; idx >= 0; idx-- {
 		var plane *Image
 		state := &GRDProgressiveState{
@@ -116,12 +131,12 @@ func (p *HTRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext, p
 		if status != CodecStatusFinished || plane == nil || plane.data == nil {
 			return nil, errors.New("jbig2: failed to decode halftone plane")
 		}
-		gsplanes[idx] = plane
 		if idx < int(gsbpp)-1 {
-			if !gsplanes[idx].ComposeFrom(0, 0, gsplanes[idx+1], ComposeXOR) {
+			if !plane.ComposeFrom(0, 0, gsplanes[idx+1], ComposeXOR) {
 				return nil, errors.New("jbig2: failed to combine halftone planes")
 			}
 		}
+		gsplanes[idx] = plane
 	}
 
 	return p.decodeImage(gsplanes)
@@ -132,6 +147,9 @@ func (p *HTRDProc) DecodeMMR(stream *BitStream) (*Image, error) {
 	if stream == nil {
 		return nil, errors.New("jbig2: nil bitstream for halftone region")
 	}
+	if err := p.chargeGrid(); err != nil {
+		return nil, err
+	}
 
 	// Calculate bits per pattern
 	hbpp := uint32(1)
@@ -143,57 +161,114 @@ func (p *HTRDProc) DecodeMMR(stream *BitStream) (*Image, error) {
 
 	// Create GRD processor for halftone region
 	grd := NewGRDProc()
+	grd.Cancel = p.Cancel
 	grd.MMR = p.HMMR
 	grd.GBWidth = p.HGWidth
 	grd.GBHeight = p.HGHeight
 
 	// Create planes
 	gsplanes := make([]*Image, gsbpp)
+	p.planes = gsplanes
 
 	// Decode first plane
-	status, err := grd.StartDecodeMMR(&gsplanes[gsbpp-1], stream)
-	if err != nil || status != CodecStatusFinished {
+	var plane *Image
+	status, err := grd.StartDecodeMMR(&plane, stream)
+	if err != nil {
+		return nil, err
+	}
+	if status != CodecStatusFinished {
 		return nil, errors.New("jbig2: failed to decode MMR halftone plane")
 	}
-	if gsplanes[gsbpp-1] == nil {
+	if plane == nil {
 		return nil, errors.New("jbig2: failed to decode MMR halftone plane")
 	}
+	gsplanes[gsbpp-1] = plane
 
 	stream.AlignByte()
 	stream.AddOffset(3)
 
 	// Decode remaining planes
 	for j := int(gsbpp) - 2; j >= 0; j-- {
-		status, err := grd.StartDecodeMMR(&gsplanes[j], stream)
-		if err != nil || status != CodecStatusFinished {
+		var plane *Image
+		status, err := grd.StartDecodeMMR(&plane, stream)
+		if err != nil {
+			return nil, err
+		}
+		if status != CodecStatusFinished {
 			return nil, errors.New("jbig2: failed to decode MMR halftone plane")
 		}
-		if gsplanes[j] == nil {
+		if plane == nil {
 			return nil, errors.New("jbig2: failed to decode MMR halftone plane")
 		}
 
 		stream.AlignByte()
 		stream.AddOffset(3)
 
-		if !gsplanes[j].ComposeFrom(0, 0, gsplanes[j+1], ComposeXOR) {
+		if !plane.ComposeFrom(0, 0, gsplanes[j+1], ComposeXOR) {
 			return nil, errors.New("jbig2: failed to combine MMR halftone planes")
 		}
+		gsplanes[j] = plane
 	}
 
 	return p.decodeImage(gsplanes)
 }
 
+// PartialImage renders the region from the gray-scale planes decoded before
+// a failure, taking the missing low-order planes as zero, so that the grid
+// still shows with coarser gray levels. It returns nil when not even the
+// most significant plane was decoded.
+func (p *HTRDProc) PartialImage() *Image {
+	if len(p.planes) == 0 || p.planes[len(p.planes)-1] == nil {
+		return nil
+	}
+	planes := make([]*Image, len(p.planes))
+	var blank *Image
+	for i, plane := range p.planes {
+		if plane == nil {
+			if blank == nil {
+				blank = NewImage(int32(p.HGWidth), int32(p.HGHeight))
+			}
+			plane = blank
+		}
+		planes[i] = plane
+	}
+	img, err := p.decodeImage(planes)
+	if err != nil {
+		return nil
+	}
+	return img
+}
+
+// chargeGrid validates the grid size against the region pixel limit and
+// charges the gray-scale planes and skip bitmap to the budget.
+func (p *HTRDProc) chargeGrid() error {
+	if err := p.Budget.CheckRegion(uint64(p.HGWidth), uint64(p.HGHeight)); err != nil {
+		return err
+	}
+	planes := uint64(1)
+	for (uint32(1) << planes) < p.HNumPats {
+		planes++
+	}
+	if p.HEnableSkip {
+		planes++
+	}
+	return p.Budget.Allocate(planes * bitmapBytes(uint64(p.HGWidth), uint64(p.HGHeight)))
+}
+
 func (p *HTRDProc) decodeImage(gsplanes []*Image) (*Image, error) {
 	if p.HNumPats == 0 {
 		return nil, errors.New("jbig2: halftone pattern dictionary is empty")
 	}
-	htreg := NewImage(int32(p.HBWidth), int32(p.HBHeight))
+	htreg := newRegionImage(p.HBWidth, p.HBHeight, p.Clip)
 	if htreg == nil || htreg.data == nil {
 		return nil, errors.New("jbig2: failed to allocate halftone region image")
 	}
 	htreg.Fill(p.HDefPixel)
 
 	for mg := uint32(0); mg < p.HGHeight; mg++ {
+		if err := checkCancel(p.Cancel); err != nil {
+			return nil, err
+		}
 		for ng := uint32(0); ng < p.HGWidth; ng++ {
 			patternIndex := uint32(0)
 			for plane := 0; plane < len(gsplanes); plane++ {
@@ -214,7 +289,7 @@ func (p *HTRDProc) decodeImage(gsplanes []*Image) (*Image, error) {
 			ngInt := int64(ng)
 			x := (int64(p.HGX) + mgInt*int64(p.HRY) + ngInt*int64(p.HRX)) >> 8
 			y := (int64(p.HGY) + mgInt*int64(p.HRX) - ngInt*int64(p.HRY)) >> 8
-			pattern.ComposeTo(htreg, x, y, p.HCombOp)
+			composeClipped(pattern, htreg, x, y, p.Clip, p.HCombOp)
 		}
 	}
 
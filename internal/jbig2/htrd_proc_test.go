@@ -59,3 +59,57 @@ func TestHTRDProcDecodeImageClampsPatternIndex(t *testing.T) {
 		t.Errorf("pixel (0,0) = %d, want 0", got)
 	}
 }
+
+func TestHTRDProcDecodeImageCancelled(t *testing.T) {
+	proc := NewHTRDProc()
+	proc.HBWidth = 8
+	proc.HBHeight = 8
+	proc.HGWidth = 8
+	proc.HGHeight = 8
+	proc.HRX = 256
+	proc.HPW = 1
+	proc.HPH = 1
+	proc.HNumPats = 2
+	proc.HPats = []*Image{NewImage(1, 1), NewImage(1, 1)}
+	cancel := &countingCancel{after: 2, err: errTestCancelled}
+	proc.Cancel = cancel
+
+	if _, err := proc.decodeImage([]*Image{NewImage(8, 8)}); err != errTestCancelled {
+		t.Fatalf("expected cancellation error, got %v", err)
+	}
+	if cancel.polls != 3 {
+		t.Fatalf("expected to stop at grid row 2, polled %d times", cancel.polls)
+	}
+}
+
+func TestHTRDProcDecodeImageClip(t *testing.T) {
+	newProc := func() *HTRDProc {
+		proc := NewHTRDProc()
+		proc.HBWidth = 20
+		proc.HBHeight = 14
+		proc.HGWidth = 6
+		proc.HGHeight = 5
+		proc.HGX = 256
+		proc.HRX = 3 * 256
+		proc.HPW = 4
+		proc.HPH = 3
+		proc.HNumPats = 4
+		proc.HPats = []*Image{testPattern(4, 3, 1), testPattern(4, 3, 2), testPattern(4, 3, 3), testPattern(4, 3, 4)}
+		return proc
+	}
+	planes := []*Image{testPattern(6, 5, 7), testPattern(6, 5, 8)}
+
+	full, err := newProc().decodeImage(planes)
+	if err != nil {
+		t.Fatalf("decodeImage returned error: %v", err)
+	}
+	proc := newProc()
+	proc.Clip = &Rect{Left: 5, Top: 2, Right: 13, Bottom: 11}
+	clipped, err := proc.decodeImage(planes)
+	if err != nil {
+		t.Fatalf("decodeImage returned error: %v", err)
+	}
+	if !sameBitmap(clipped, full.SubImage(5, 2, 8, 9)) {
+		t.Fatal("clipped halftone region differs from the full region")
+	}
+}
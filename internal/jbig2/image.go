@@ -29,6 +29,22 @@ func (r Rect) Width() int { return r.Right - r.Left }
 // Height returns the span of the rectangle on the Y axis.
 func (r Rect) Height() int { return r.Bottom - r.Top }
 
+// Empty reports whether the rectangle contains no pixels.
+func (r Rect) Empty() bool { return r.Left >= r.Right || r.Top >= r.Bottom }
+
+// Intersect returns the largest rectangle contained in both r and s, or the
+// zero Rect when they do not overlap.
+func (r Rect) Intersect(s Rect) Rect {
+	r.Left = max(r.Left, s.Left)
+	r.Top = max(r.Top, s.Top)
+	r.Right = min(r.Right, s.Right)
+	r.Bottom = min(r.Bottom, s.Bottom)
+	if r.Empty() {
+		return Rect{}
+	}
+	return r
+}
+
 // Image is the Go translation of CJBig2_Image.
 type Image struct {
 	width  int
@@ -210,6 +226,9 @@ func (img *Image) ComposeToWithRect(dst *Image, x, y int64, rect Rect, op Compos
 	return img.composeToInternal(dst, x, y, op, rect)
 }
 
+// Clone returns an owned copy of the image.
+func (img *Image) Clone() *Image { return cloneImage(img) }
+
 // SubImage returns a newly allocated Image cropped to the requested rectangle.
 func (img *Image) SubImage(x, y, w, h int32) *Image {
 	result := NewImage(w, h)
@@ -0,0 +1,191 @@
+package jbig2
+
+import "fmt"
+
+// Limits bounds the resources a decode may use. A zero field imposes no
+// limit beyond the decoder's built-in sanity checks.
+type Limits struct {
+	// MaxPagePixels bounds the pixel count of a page, including the growth
+	// of striped pages of unknown height.
+	MaxPagePixels uint64
+	// MaxRegionPixels bounds the pixel count of a single region segment and
+	// of the grid of a halftone region.
+	MaxRegionPixels uint64
+	// MaxSymbolsPerDict bounds the new and exported symbols of one symbol
+	// dictionary.
+	MaxSymbolsPerDict uint32
+	// MaxSymbolBytes bounds the bitmap storage of all decoded symbols.
+	MaxSymbolBytes uint64
+	// MaxTextInstances bounds the symbol instances of one text region.
+	MaxTextInstances uint32
+	// MaxSegments bounds the number of segments parsed.
+	MaxSegments uint32
+	// MaxAllocBytes bounds the bitmap storage held at once: pages, regions,
+	// symbols, patterns and halftone planes. Storage is returned when the
+	// decoder drops it: immediate regions once composed onto the page,
+	// retained results when their segment is released, a page when the next
+	// one starts and rows of striped pages handed over in emitting mode.
+	MaxAllocBytes uint64
+	// MaxBufferBytes bounds the bytes a StreamDecoder holds while a segment,
+	// or a random-access file, has not fully arrived. StreamDecoder uses
+	// DefaultMaxBufferBytes when it is zero.
+	MaxBufferBytes uint64
+}
+
+// DefaultMaxBufferBytes is the buffer bound of a StreamDecoder whose limits
+// leave MaxBufferBytes zero.
+const DefaultMaxBufferBytes = 256 << 20
+
+// Budget tracks resource use against Limits. Methods on a nil *Budget
+// always succeed, so decoders can consult it unconditionally.
+type Budget struct {
+	limits      Limits
+	allocated   uint64
+	symbolBytes uint64
+	segments    uint32
+}
+
+// NewBudget returns a budget enforcing limits.
+func NewBudget(limits Limits) *Budget {
+	return &Budget{limits: limits}
+}
+
+// Limits returns the limits enforced by the budget.
+func (b *Budget) Limits() Limits {
+	if b == nil {
+		return Limits{}
+	}
+	return b.limits
+}
+
+// Allocated returns the bitmap bytes charged so far.
+func (b *Budget) Allocated() uint64 {
+	if b == nil {
+		return 0
+	}
+	return b.allocated
+}
+
+func limitError(format string, args ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{ErrLimitExceeded}, args...)...)
+}
+
+// bitmapBytes returns the storage needed for a w×h bitmap with rows padded
+// to 32 bits, matching NewImage.
+func bitmapBytes(w, h uint64) uint64 {
+	return (w + 31) / 32 * 4 * h
+}
+
+// Allocate charges n bytes of bitmap storage.
+func (b *Budget) Allocate(n uint64) error {
+	if b == nil {
+		return nil
+	}
+	if limit := b.limits.MaxAllocBytes; limit != 0 && b.allocated+n > limit {
+		return limitError("allocating %d bytes would exceed %d allocated bytes", n, limit)
+	}
+	b.allocated += n
+	return nil
+}
+
+// Release returns n bytes of bitmap storage that the decoder has dropped,
+// such as the rows of a striped page handed over in emitting mode.
+func (b *Budget) Release(n uint64) {
+	if b == nil {
+		return
+	}
+	if n > b.allocated {
+		n = b.allocated
+	}
+	b.allocated -= n
+}
+
+// AllocateBitmap charges the storage of a w×h bitmap.
+func (b *Budget) AllocateBitmap(w, h uint64) error {
+	return b.Allocate(bitmapBytes(w, h))
+}
+
+// CheckPage validates the size of a page and charges its storage.
+func (b *Budget) CheckPage(w, h uint64) error {
+	if b == nil {
+		return nil
+	}
+	if limit := b.limits.MaxPagePixels; limit != 0 && w*h > limit {
+		return limitError("page of %dx%d pixels exceeds %d pixels", w, h, limit)
+	}
+	return b.AllocateBitmap(w, h)
+}
+
+// GrowPage validates a page growing from oldH to newH rows and charges the
+// additional storage.
+func (b *Budget) GrowPage(w, oldH, newH uint64) error {
+	if b == nil || newH <= oldH {
+		return nil
+	}
+	if limit := b.limits.MaxPagePixels; limit != 0 && w*newH > limit {
+		return limitError("page of %dx%d pixels exceeds %d pixels", w, newH, limit)
+	}
+	return b.AllocateBitmap(w, newH-oldH)
+}
+
+// CheckRegion validates the size of a region. Its storage is charged
+// separately, once the region is known to be decoded.
+func (b *Budget) CheckRegion(w, h uint64) error {
+	if b == nil {
+		return nil
+	}
+	if limit := b.limits.MaxRegionPixels; limit != 0 && w*h > limit {
+		return limitError("region of %dx%d pixels exceeds %d pixels", w, h, limit)
+	}
+	return nil
+}
+
+// CheckSymbolCount validates the number of symbols of a dictionary.
+func (b *Budget) CheckSymbolCount(n uint32) error {
+	if b == nil {
+		return nil
+	}
+	if limit := b.limits.MaxSymbolsPerDict; limit != 0 && n > limit {
+		return limitError("dictionary of %d symbols exceeds %d symbols", n, limit)
+	}
+	return nil
+}
+
+// AddSymbol charges the storage of a w×h symbol bitmap.
+func (b *Budget) AddSymbol(w, h uint64) error {
+	if b == nil {
+		return nil
+	}
+	n := bitmapBytes(w, h)
+	if limit := b.limits.MaxSymbolBytes; limit != 0 && b.symbolBytes+n > limit {
+		return limitError("symbol bitmaps would exceed %d bytes", limit)
+	}
+	if err := b.Allocate(n); err != nil {
+		return err
+	}
+	b.symbolBytes += n
+	return nil
+}
+
+// CheckTextInstances validates the instance count of a text region.
+func (b *Budget) CheckTextInstances(n uint32) error {
+	if b == nil {
+		return nil
+	}
+	if limit := b.limits.MaxTextInstances; limit != 0 && n > limit {
+		return limitError("text region of %d instances exceeds %d instances", n, limit)
+	}
+	return nil
+}
+
+// AddSegment counts one parsed segment.
+func (b *Budget) AddSegment() error {
+	if b == nil {
+		return nil
+	}
+	if limit := b.limits.MaxSegments; limit != 0 && b.segments >= limit {
+		return limitError("stream has more than %d segments", limit)
+	}
+	b.segments++
+	return nil
+}
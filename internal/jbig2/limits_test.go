@@ -0,0 +1,132 @@
+package jbig2
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBudgetNilIsUnlimited(t *testing.T) {
+	var b *Budget
+	if err := b.CheckPage(1<<20, 1<<20); err != nil {
+		t.Fatalf("nil budget rejected page: %v", err)
+	}
+	if err := b.AddSegment(); err != nil {
+		t.Fatalf("nil budget rejected segment: %v", err)
+	}
+}
+
+func TestBudgetLimits(t *testing.T) {
+	b := NewBudget(Limits{MaxSymbolBytes: 64, MaxAllocBytes: 100})
+	if err := b.AddSymbol(32, 16); err != nil {
+		t.Fatalf("AddSymbol within limits returned error: %v", err)
+	}
+	if err := b.AddSymbol(1, 1); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected symbol byte limit, got %v", err)
+	}
+	if err := b.Allocate(36); err != nil {
+		t.Fatalf("Allocate within limits returned error: %v", err)
+	}
+	if err := b.Allocate(1); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected allocation limit, got %v", err)
+	}
+	if got := b.Allocated(); got != 100 {
+		t.Fatalf("expected 100 bytes charged, got %d", got)
+	}
+}
+
+func TestContextLimits(t *testing.T) {
+	region := testPattern(16, 16, 0)
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(64, 64, 0, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(region, 0, 0, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+
+	tests := []struct {
+		name   string
+		limits Limits
+		ok     bool
+	}{
+		{"unlimited", Limits{}, true},
+		{"page pixels", Limits{MaxPagePixels: 64*64 - 1}, false},
+		{"region pixels", Limits{MaxRegionPixels: 255}, false},
+		{"segments", Limits{MaxSegments: 2}, false},
+		{"allocated bytes", Limits{MaxAllocBytes: 8 * 64}, false},
+		{"generous", Limits{MaxPagePixels: 64 * 64, MaxRegionPixels: 256, MaxSegments: 3, MaxAllocBytes: 8*64 + 4*16}, true},
+	}
+	for _, tt := range tests {
+		ctx, err := CreateContext(nil, 0, data, 0, nil)
+		if err != nil {
+			t.Fatalf("%s: CreateContext returned error: %v", tt.name, err)
+		}
+		ctx.SetLimits(tt.limits)
+		_, _, err = ctx.NextPage()
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrLimitExceeded) {
+			t.Errorf("%s: expected ErrLimitExceeded, got %v", tt.name, err)
+		}
+	}
+}
+
+func TestTextRegionInstanceLimit(t *testing.T) {
+	proc := NewTRDProc()
+	proc.SBWidth = 4
+	proc.SBHeight = 4
+	proc.SBNumInstances = 1000
+	proc.Budget = NewBudget(Limits{MaxTextInstances: 999})
+	decoder := NewArithDecoder(NewBitStream([]byte{0, 0, 0xff, 0xac}, 0))
+	if _, err := proc.DecodeArith(decoder, nil, nil); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestSymbolDictCountLimit(t *testing.T) {
+	proc := NewSDDProc()
+	proc.SDNUMNEWSYMS = 10
+	proc.SDNUMEXSYMS = 10
+	proc.Budget = NewBudget(Limits{MaxSymbolsPerDict: 9})
+	decoder := NewArithDecoder(NewBitStream([]byte{0, 0, 0xff, 0xac}, 0))
+	if _, err := proc.DecodeArith(decoder, nil, nil); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestContextBudgetReleased(t *testing.T) {
+	var data []byte
+	for page := uint32(1); page <= 3; page++ {
+		n := 3 * (page - 1)
+		data = append(data, buildSegment(testSegment{number: n, typ: segmentTypePageInfo, page: page, data: pageInfoData(64, 64, 0, 0)})...)
+		data = append(data, buildSegment(testSegment{number: n + 1, typ: segmentTypeGenericRegionImmediateLossless, page: page, data: genericRegionData(testPattern(16, 16, int(page)), 0, 0, 0)})...)
+		data = append(data, buildSegment(testSegment{number: n + 2, typ: segmentTypeEndOfPage, page: page})...)
+	}
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	// Room for one page and one region at a time, not for the whole document.
+	ctx.SetLimits(Limits{MaxAllocBytes: 8*64 + 4*16})
+	for page := 1; page <= 3; page++ {
+		if _, _, err := ctx.NextPage(); err != nil {
+			t.Fatalf("page %d: NextPage returned error: %v", page, err)
+		}
+		if got := ctx.Budget().Allocated(); got != 8*64 {
+			t.Errorf("page %d: %d bytes charged after the page, want the page's %d", page, got, 8*64)
+		}
+	}
+}
+
+func TestContextClipSkipsCharge(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(64, 64, 0, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(32, 32, 1), 32, 32, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	// The clip holds a 32x32 page; the region lies wholly outside it.
+	ctx.SetClip(&Rect{Right: 32, Bottom: 32})
+	ctx.SetLimits(Limits{MaxAllocBytes: 4 * 32})
+	if _, _, err := ctx.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+}
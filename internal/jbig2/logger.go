@@ -0,0 +1,30 @@
+package jbig2
+
+import (
+	"context"
+	"log/slog"
+)
+
+// SetLogger installs the logger that non-fatal anomalies are reported to at
+// warning level: skipped segments, clipped regions, truncated data and
+// ignored flags. The global context reports to the same logger. Passing nil,
+// the default, discards them.
+func (c *Context) SetLogger(l *slog.Logger) {
+	c.logger = l
+}
+
+// warn reports an anomaly in seg, which may be nil, with the segment number,
+// type and data offset followed by attrs.
+func (c *Context) warn(seg *Segment, msg string, attrs ...slog.Attr) {
+	if c.logger == nil {
+		return
+	}
+	if seg != nil {
+		attrs = append([]slog.Attr{
+			slog.Uint64("segment", uint64(seg.Number)),
+			slog.Int("type", int(seg.Flags.Type())),
+			slog.Uint64("offset", c.baseOffset+uint64(c.offset)),
+		}, attrs...)
+	}
+	c.logger.LogAttrs(context.Background(), slog.LevelWarn, msg, attrs...)
+}
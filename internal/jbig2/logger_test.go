@@ -0,0 +1,104 @@
+package jbig2
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"testing"
+)
+
+// decodeWithLogger decodes the first page of data and returns the warnings
+// logged on the way.
+func decodeWithLogger(t *testing.T, data []byte) []map[string]any {
+	t.Helper()
+	var buf bytes.Buffer
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetLogger(slog.New(slog.NewJSONHandler(&buf, nil)))
+	if _, _, err := ctx.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	var records []map[string]any
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var rec map[string]any
+		if err := dec.Decode(&rec); err != nil {
+			t.Fatalf("decoding log record: %v", err)
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func TestLoggerUnknownSegment(t *testing.T) {
+	page := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 4, 0, 0)})
+	data := append(page, buildSegment(testSegment{number: 1, typ: 33, page: 1, data: []byte{1, 2, 3}})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+
+	records := decodeWithLogger(t, data)
+	if len(records) != 1 {
+		t.Fatalf("got %d warnings, want 1: %v", len(records), records)
+	}
+	rec := records[0]
+	if rec["level"] != "WARN" || rec["msg"] != "unknown segment type skipped" {
+		t.Errorf("unexpected record %v", rec)
+	}
+	wantOffset := float64(len(page) + len(buildSegmentHeader(testSegment{number: 1, typ: 33, page: 1, data: []byte{1, 2, 3}})))
+	if rec["segment"] != 1.0 || rec["type"] != 33.0 || rec["offset"] != wantOffset {
+		t.Errorf("unexpected attributes %v, want offset %v", rec, wantOffset)
+	}
+}
+
+func TestLoggerRegionAnomalies(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 4, 0, 0)})
+	region := genericRegionData(testPattern(8, 4, 1), 4, 2, 2)
+	region[16] |= 0x40
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: region})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+
+	var msgs []any
+	for _, rec := range decodeWithLogger(t, data) {
+		msgs = append(msgs, rec["msg"])
+	}
+	want := []any{
+		"reserved region flags ignored",
+		"region combination operator ignored without page override",
+		"region clipped to page bounds",
+	}
+	if len(msgs) != len(want) {
+		t.Fatalf("got warnings %v, want %v", msgs, want)
+	}
+	for i := range want {
+		if msgs[i] != want[i] {
+			t.Errorf("warning %d = %v, want %v", i, msgs[i], want[i])
+		}
+	}
+}
+
+func TestLoggerSilentByDefault(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: 33, data: []byte{1}})
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	_, decodeErr := ctx.DecodeSequential(nil)
+	os.Stdout = stdout
+	w.Close()
+	out, _ := io.ReadAll(r)
+	if decodeErr != nil {
+		t.Fatalf("DecodeSequential returned error: %v", decodeErr)
+	}
+	if len(out) != 0 {
+		t.Errorf("decoding wrote %q to stdout", out)
+	}
+}
@@ -0,0 +1,108 @@
+package jbig2
+
+import (
+	"fmt"
+	"time"
+)
+
+// Observer receives tracing hooks from DecodeSequential. Every segment whose
+// header parses is reported by SegmentStart and, once its data has been
+// decoded or has failed, by exactly one SegmentEnd. The hooks run on the
+// decoding goroutine and should return quickly.
+type Observer interface {
+	// SegmentStart is called after the header of seg has been parsed.
+	SegmentStart(seg *Segment)
+	// SegmentEnd is called when seg has been decoded or has failed with
+	// err. The duration is the time spent decoding the segment, excluding
+	// pauses, and bytesConsumed counts its header and data bytes.
+	SegmentEnd(seg *Segment, duration time.Duration, bytesConsumed uint64, err error)
+	// PageComplete is called when the page described by info is finished.
+	PageComplete(info *PageInfo)
+}
+
+// SetObserver installs the tracing hooks of the context. The global context
+// reports its segments to the same observer. Passing nil removes it.
+func (c *Context) SetObserver(o Observer) {
+	c.observer = o
+}
+
+// segmentTrace accumulates the decoding time and the header size of the
+// segment being decoded across pauses.
+type segmentTrace struct {
+	elapsed    time.Duration
+	headerSize uint64
+}
+
+// startSegment reports seg to the observer and starts tracing it.
+func (c *Context) startSegment(seg *Segment) {
+	if c.observer == nil {
+		return
+	}
+	c.trace = segmentTrace{headerSize: uint64(seg.HeaderLength)}
+	c.observer.SegmentStart(seg)
+}
+
+// endSegment reports the end of seg, whose data started at dataOffset and
+// whose decoding took elapsed in the current call, to the observer.
+func (c *Context) endSegment(seg *Segment, dataOffset uint32, elapsed time.Duration, err error) {
+	if c.observer == nil || seg == nil {
+		return
+	}
+	consumed := c.trace.headerSize
+	if end := c.stream.Offset(); end > dataOffset {
+		consumed += uint64(end - dataOffset)
+	}
+	c.observer.SegmentEnd(seg, c.trace.elapsed+elapsed, consumed, err)
+	c.trace = segmentTrace{}
+}
+
+// SegmentTypeName returns the name T.88 gives segment type t.
+func SegmentTypeName(t uint8) string {
+	switch t {
+	case segmentTypeSymbolDict:
+		return "symbol dictionary"
+	case 4:
+		return "intermediate text region"
+	case 6:
+		return "immediate text region"
+	case 7:
+		return "immediate lossless text region"
+	case segmentTypePatternDict:
+		return "pattern dictionary"
+	case segmentTypeHalftoneRegion:
+		return "intermediate halftone region"
+	case segmentTypeHalftoneRegionImmediate:
+		return "immediate halftone region"
+	case segmentTypeHalftoneRegionImmediateLossless:
+		return "immediate lossless halftone region"
+	case segmentTypeGenericRegion:
+		return "intermediate generic region"
+	case segmentTypeGenericRegionImmediate:
+		return "immediate generic region"
+	case segmentTypeGenericRegionImmediateLossless:
+		return "immediate lossless generic region"
+	case segmentTypeRefinementRegion:
+		return "intermediate generic refinement region"
+	case segmentTypeRefinementRegionImmediate:
+		return "immediate generic refinement region"
+	case segmentTypeRefinementRegionImmediateLossless:
+		return "immediate lossless generic refinement region"
+	case segmentTypePageInfo:
+		return "page information"
+	case segmentTypeEndOfPage:
+		return "end of page"
+	case segmentTypeEndOfStripe:
+		return "end of stripe"
+	case segmentTypeEndOfFile:
+		return "end of file"
+	case segmentTypeProfiles:
+		return "profiles"
+	case segmentTypeTables:
+		return "tables"
+	case segmentTypeColourPalette:
+		return "colour palette"
+	case segmentTypeExtension:
+		return "extension"
+	}
+	return fmt.Sprintf("type %d", t)
+}
@@ -0,0 +1,153 @@
+package jbig2
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+	"time"
+)
+
+// recordingObserver records the hooks it receives.
+type recordingObserver struct {
+	started []uint32
+	ended   []uint32
+	bytes   uint64
+	errs    []error
+	pages   []uint32
+}
+
+func (o *recordingObserver) SegmentStart(seg *Segment) {
+	o.started = append(o.started, seg.Number)
+}
+
+func (o *recordingObserver) SegmentEnd(seg *Segment, d time.Duration, n uint64, err error) {
+	o.ended = append(o.ended, seg.Number)
+	o.bytes += n
+	if err != nil {
+		o.errs = append(o.errs, err)
+	}
+}
+
+func (o *recordingObserver) PageComplete(info *PageInfo) {
+	o.pages = append(o.pages, info.Number)
+}
+
+func TestObserverStreamHooks(t *testing.T) {
+	segments := [][]byte{
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 6, 0, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(16, 6, 0), 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+		buildSegment(testSegment{number: 3, typ: segmentTypePageInfo, page: 2, data: pageInfoData(9, 13, 0, 0)}),
+		buildSegment(testSegment{number: 4, typ: segmentTypeEndOfPage, page: 2}),
+		buildSegment(testSegment{number: 5, typ: segmentTypeEndOfFile}),
+	}
+	var total uint64
+	for _, seg := range segments {
+		total += uint64(len(seg))
+	}
+	obs := &recordingObserver{}
+	r := iotest.OneByteReader(&chunkReader{chunks: [][]byte{sequentialFile(segments...)}, closed: true})
+	dec := NewStreamDecoder(r, DecoderOptions{Observer: obs})
+	for {
+		_, _, err := dec.NextPage()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPage returned error: %v", err)
+		}
+	}
+
+	want := []uint32{0, 1, 2, 3, 4, 5}
+	if !equalNumbers(obs.started, want) || !equalNumbers(obs.ended, want) {
+		t.Errorf("started %v and ended %v, want %v", obs.started, obs.ended, want)
+	}
+	if obs.bytes != total {
+		t.Errorf("segments consumed %d bytes, want %d", obs.bytes, total)
+	}
+	if len(obs.errs) != 0 {
+		t.Errorf("unexpected segment errors %v", obs.errs)
+	}
+	if !equalNumbers(obs.pages, []uint32{1, 2}) {
+		t.Errorf("completed pages %v, want [1 2]", obs.pages)
+	}
+}
+
+func TestObserverRandomAccessHeaders(t *testing.T) {
+	segments := []testSegment{
+		{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 6, 0, 0)},
+		{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(16, 6, 0), 0, 0, 0)},
+		{number: 2, typ: segmentTypeEndOfPage, page: 1},
+		{number: 3, typ: segmentTypeEndOfFile},
+	}
+	data := append([]byte{}, jbig2FileSignature...)
+	data = append(data, 0x02)
+	var total uint64
+	for _, seg := range segments {
+		header := buildSegmentHeader(seg)
+		data = append(data, header...)
+		// Decoding stops at the end of the data, before the end-of-file
+		// segment is reported.
+		if seg.typ != segmentTypeEndOfFile {
+			total += uint64(len(header) + len(seg.data))
+		}
+	}
+	for _, seg := range segments {
+		data = append(data, seg.data...)
+	}
+	obs := &recordingObserver{}
+	dec, err := NewDecoder(DecoderOptions{SrcData: data, Observer: obs})
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	if err := dec.DecodeAll(); err != nil {
+		t.Fatalf("DecodeAll returned error: %v", err)
+	}
+	// Headers are read ahead of the data, but each still counts towards the
+	// bytes its segment consumed.
+	if obs.bytes != total {
+		t.Errorf("segments consumed %d bytes, want %d", obs.bytes, total)
+	}
+}
+
+func TestObserverSegmentError(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 6, 0, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: regionInfoData(16, 6, 0, 0, 0)})...)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	obs := &recordingObserver{}
+	ctx.SetObserver(obs)
+	if _, _, err := ctx.NextPage(); err == nil {
+		t.Fatal("NextPage succeeded with truncated region data")
+	}
+	if !equalNumbers(obs.started, []uint32{0, 1}) || !equalNumbers(obs.ended, []uint32{0, 1}) {
+		t.Errorf("started %v and ended %v, want [0 1]", obs.started, obs.ended)
+	}
+	if len(obs.errs) != 1 {
+		t.Errorf("got %d segment errors, want 1", len(obs.errs))
+	}
+}
+
+func equalNumbers(a, b []uint32) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSegmentTypeName(t *testing.T) {
+	if got := SegmentTypeName(segmentTypeGenericRegionImmediateLossless); got != "immediate lossless generic region" {
+		t.Errorf("SegmentTypeName(39) = %q", got)
+	}
+	if got := SegmentTypeName(99); got != "type 99" {
+		t.Errorf("SegmentTypeName(99) = %q", got)
+	}
+}
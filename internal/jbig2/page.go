@@ -4,6 +4,7 @@ const unboundedPageHeight = ^uint32(0)
 
 // PageInfo mirrors the PDFium JBig2PageInfo struct and captures per-page metadata.
 type PageInfo struct {
+	Number            uint32 // page association of the page information segment
 	Width             uint32
 	Height            uint32
 	ResolutionX       uint32
@@ -11,6 +12,14 @@ type PageInfo struct {
 	DefaultPixelValue bool
 	Striped           bool
 	MaxStripeSize     uint16
+
+	// Page information flag bits.
+	EventuallyLossless       bool      // bit 0: the page is refined to lossless
+	MightContainRefinements  bool      // bit 1: refinement regions may be present
+	DefaultCombOp            ComposeOp // bits 3-4: default combination operator
+	RequiresAuxiliaryBuffers bool      // bit 5: auxiliary buffers are needed
+	CombOpOverridden         bool      // bit 6: regions may override the operator
+	ColourExtension          bool      // bit 7: the page uses colour regions
 }
 
 // EffectiveHeight reports the height to allocate for striped pages.
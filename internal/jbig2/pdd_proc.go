@@ -12,6 +12,8 @@ type PDDProc struct {
 	HDPH       uint8
 	GrayMax    uint32
 	HDTemplate uint8
+	Cancel     CancelIndicator
+	Budget     *Budget
 }
 
 // NewPDDProc constructs a halftone pattern decoder configuration.
@@ -90,7 +92,10 @@ func (p *PDDProc) DecodeMMR(stream *BitStream) (*PatternDict, error) {
 	}
 	var bhdc *Image
 	status, err := grd.StartDecodeMMR(&bhdc, stream)
-	if err != nil || status != CodecStatusFinished {
+	if err != nil {
+		return nil, err
+	}
+	if status != CodecStatusFinished {
 		return nil, errors.New("jbig2: failed to decode MMR pattern dictionary")
 	}
 	if bhdc == nil || bhdc.data == nil {
@@ -113,8 +118,12 @@ func (p *PDDProc) createGRDProc() (*GRDProc, error) {
 	if width > uint64(JBig2MaxImageSize) || height > uint64(JBig2MaxImageSize) {
 		return nil, fmt.Errorf("jbig2: pattern dictionary dimensions %dx%d exceed limits", width, height)
 	}
+	if err := p.Budget.AllocateBitmap(width, height); err != nil {
+		return nil, err
+	}
 
 	grd := NewGRDProc()
+	grd.Cancel = p.Cancel
 	grd.MMR = p.HDMMR
 	grd.GBWidth = uint32(width)
 	grd.GBHeight = uint32(height)
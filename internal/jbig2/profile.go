@@ -0,0 +1,269 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"fmt"
+	"log/slog"
+)
+
+const segmentTypeProfiles = 52
+
+// Profile numbers defined by T.88 Annex A, Table A.1.
+const (
+	ProfileAllCapabilities                   uint32 = 1 // all JBIG2 capabilities
+	ProfileMaximumCompression                uint32 = 2 // maximum compression
+	ProfileMediumComplexityMediumCompression uint32 = 3 // medium complexity and medium compression
+	ProfileLowComplexityProgressiveLossless  uint32 = 4 // low complexity with progressive lossless capability
+	ProfileLowComplexity                     uint32 = 5 // low complexity
+)
+
+// profileRule lists the restrictions a profile places on a stream, after
+// T.88 Annex A, Table A.2.
+type profileRule struct {
+	name              string
+	arithmetic        bool // arithmetic coding outside refinement region segments
+	mmr               bool // MMR, HDMMR and HMMR set
+	huffman           bool // SDHUFF and SBHUFF set, and tables segments
+	refinement        bool // SDREFAGG and SBREFINE set
+	refinementRegions bool // generic refinement region segments
+	nominalAT         bool // AT pixels must sit at their nominal positions
+}
+
+var profileRules = map[uint32]profileRule{
+	ProfileAllCapabilities: {
+		name:              "all JBIG2 capabilities",
+		arithmetic:        true,
+		mmr:               true,
+		huffman:           true,
+		refinement:        true,
+		refinementRegions: true,
+	},
+	ProfileMaximumCompression: {
+		name:              "maximum compression",
+		arithmetic:        true,
+		refinement:        true,
+		refinementRegions: true,
+	},
+	ProfileMediumComplexityMediumCompression: {
+		name:       "medium complexity and medium compression",
+		arithmetic: true,
+		nominalAT:  true,
+	},
+	ProfileLowComplexityProgressiveLossless: {
+		name:              "low complexity with progressive lossless capability",
+		mmr:               true,
+		huffman:           true,
+		refinementRegions: true,
+	},
+	ProfileLowComplexity: {
+		name:    "low complexity",
+		mmr:     true,
+		huffman: true,
+	},
+}
+
+// ProfileName returns a short description of profile, or "" for a profile
+// the decoder does not know.
+func ProfileName(profile uint32) string {
+	return profileRules[profile].name
+}
+
+// Profiles returns the profiles declared by the profiles segments decoded
+// so far, those of the global context first.
+func (c *Context) Profiles() []uint32 {
+	var out []uint32
+	if c.globalContext != nil {
+		out = append(out, c.globalContext.profiles...)
+	}
+	return append(out, c.profiles...)
+}
+
+// SetStrict makes the context check every segment that follows a profiles
+// segment against the restrictions of each declared profile. A segment that
+// breaks one fails with ErrProfileViolation; so does a declared profile the
+// decoder does not know, since conformance to it cannot be confirmed.
+func (c *Context) SetStrict(strict bool) {
+	c.strict = strict
+}
+
+func (c *Context) parseProfilesSegment(seg *Segment) (DecodeResult, error) {
+	count, err := c.stream.ReadUint32()
+	if err != nil {
+		return DecodeResultFailure, err
+	}
+	if uint64(count)*4 > uint64(seg.DataLength) {
+		return DecodeResultFailure, fmt.Errorf("jbig2: profiles segment lists %d profiles in %d bytes", count, seg.DataLength)
+	}
+	for i := uint32(0); i < count; i++ {
+		profile, err := c.stream.ReadUint32()
+		if err != nil {
+			return DecodeResultFailure, err
+		}
+		c.profiles = append(c.profiles, profile)
+		if _, ok := profileRules[profile]; !ok {
+			if c.strict {
+				return DecodeResultFailure, profileErrorf("jbig2: profile %d is not known", profile)
+			}
+			c.warn(seg, "unknown profile declared", slog.Uint64("profile", uint64(profile)))
+		}
+	}
+	return DecodeResultSuccess, nil
+}
+
+// checkProfiles validates seg, whose data starts at data, against the
+// declared profiles.
+func (c *Context) checkProfiles(seg *Segment, data []byte) error {
+	profiles := c.Profiles()
+	if len(profiles) == 0 {
+		return nil
+	}
+	f, ok := segmentCodingFeatures(seg.Flags.Type(), data)
+	if !ok {
+		return nil
+	}
+	for _, profile := range profiles {
+		rule, known := profileRules[profile]
+		if !known {
+			continue
+		}
+		if reason := rule.violation(seg.Flags.Type(), f); reason != "" {
+			return profileErrorf("jbig2: segment %d violates profile %d (%s): %s", seg.Number, profile, rule.name, reason)
+		}
+	}
+	return nil
+}
+
+func profileErrorf(format string, args ...any) error {
+	return withKind(ErrProfileViolation, fmt.Errorf(format, args...))
+}
+
+// codingFeatures records the coding choices made by a segment.
+type codingFeatures struct {
+	arithmetic       bool
+	mmr              bool
+	huffman          bool
+	refinement       bool
+	refinementRegion bool
+	nominalAT        bool
+}
+
+func (r profileRule) violation(typ uint8, f codingFeatures) string {
+	switch {
+	case f.refinementRegion && !r.refinementRegions:
+		return fmt.Sprintf("segment type %d is not allowed", typ)
+	case f.arithmetic && !r.arithmetic:
+		return "arithmetic coding is not allowed"
+	case f.mmr && !r.mmr:
+		return "MMR coding is not allowed"
+	case f.huffman && !r.huffman:
+		return "Huffman coding is not allowed"
+	case f.refinement && !r.refinement:
+		return "refinement coding is not allowed"
+	case r.nominalAT && !f.nominalAT:
+		return "AT pixels are not at their nominal positions"
+	}
+	return ""
+}
+
+// nominalGenericAT holds the nominal AT pixel bytes of each generic
+// template.
+var nominalGenericAT = [4][]byte{
+	{3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe},
+	{3, 0xff},
+	{2, 0xff},
+	{2, 0xff},
+}
+
+// nominalRefinementAT holds the nominal AT pixel bytes of refinement
+// template 0.
+var nominalRefinementAT = []byte{0xff, 0xff, 0xff, 0xff}
+
+func atBytesNominal(data []byte, nominal []byte) bool {
+	return len(data) >= len(nominal) && string(data[:len(nominal)]) == string(nominal)
+}
+
+// segmentCodingFeatures reads the coding flags at the start of the data of
+// a segment of type typ. It reports false for segments without coding
+// choices and for data too short to hold the flags, which decoding rejects.
+func segmentCodingFeatures(typ uint8, data []byte) (codingFeatures, bool) {
+	f := codingFeatures{nominalAT: true}
+	ri := regionInfoSize(data)
+	switch typ {
+	case segmentTypeGenericRegion, segmentTypeGenericRegionImmediate, segmentTypeGenericRegionImmediateLossless:
+		if len(data) < ri+1 {
+			return f, false
+		}
+		flags := data[ri]
+		f.mmr = flags&0x01 != 0
+		if !f.mmr {
+			f.arithmetic = true
+			f.nominalAT = atBytesNominal(data[ri+1:], nominalGenericAT[flags>>1&0x03])
+		}
+	case segmentTypeRefinementRegion, segmentTypeRefinementRegionImmediate, segmentTypeRefinementRegionImmediateLossless:
+		if len(data) < ri+2 {
+			return f, false
+		}
+		flags := binary.BigEndian.Uint16(data[ri:])
+		f.refinementRegion = true
+		if flags&0x0001 == 0 {
+			f.nominalAT = atBytesNominal(data[ri+2:], nominalRefinementAT)
+		}
+	case segmentTypeTextRegionImmediate, segmentTypeTextRegionImmediateLossless, segmentTypeTextRegionRefine:
+		if len(data) < ri+2 {
+			return f, false
+		}
+		flags := binary.BigEndian.Uint16(data[ri:])
+		f.huffman = flags&0x0001 != 0
+		f.arithmetic = !f.huffman
+		f.refinement = flags&0x0002 != 0
+		if f.refinement {
+			f.arithmetic = true
+			if flags&0x8000 == 0 {
+				at := ri + 2
+				if f.huffman {
+					at += 2
+				}
+				if len(data) >= at {
+					f.nominalAT = atBytesNominal(data[at:], nominalRefinementAT)
+				}
+			}
+		}
+	case segmentTypeHalftoneRegion, segmentTypeHalftoneRegionImmediate, segmentTypeHalftoneRegionImmediateLossless:
+		if len(data) < ri+1 {
+			return f, false
+		}
+		f.mmr = data[ri]&0x01 != 0
+		f.arithmetic = !f.mmr
+	case segmentTypeSymbolDict:
+		if len(data) < 2 {
+			return f, false
+		}
+		flags := binary.BigEndian.Uint16(data)
+		f.huffman = flags&0x0001 != 0
+		f.refinement = flags&0x0002 != 0
+		at := 2
+		if !f.huffman {
+			f.arithmetic = true
+			nominal := nominalGenericAT[flags>>10&0x03]
+			f.nominalAT = atBytesNominal(data[at:], nominal)
+			at += len(nominal)
+		}
+		if f.refinement {
+			f.arithmetic = true
+			if flags&0x1000 == 0 && len(data) >= at {
+				f.nominalAT = f.nominalAT && atBytesNominal(data[at:], nominalRefinementAT)
+			}
+		}
+	case segmentTypePatternDict:
+		if len(data) < 1 {
+			return f, false
+		}
+		f.mmr = data[0]&0x01 != 0
+		f.arithmetic = !f.mmr
+	case segmentTypeTables:
+		f.huffman = true
+	default:
+		return f, false
+	}
+	return f, true
+}
@@ -0,0 +1,132 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func profilesData(profiles ...uint32) []byte {
+	out := binary.BigEndian.AppendUint32(nil, uint32(len(profiles)))
+	for _, p := range profiles {
+		out = binary.BigEndian.AppendUint32(out, p)
+	}
+	return out
+}
+
+// profileTestFile returns a page holding the region segments regions,
+// preceded by a profiles segment declaring profiles.
+func profileTestFile(profiles []uint32, regions ...testSegment) []byte {
+	segs := [][]byte{
+		buildSegment(testSegment{number: 0, typ: segmentTypeProfiles, data: profilesData(profiles...)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x02, 0)}),
+	}
+	for i, region := range regions {
+		region.number = uint32(2 + i)
+		region.page = 1
+		segs = append(segs, buildSegment(region))
+	}
+	segs = append(segs, buildSegment(testSegment{number: uint32(2 + len(regions)), typ: segmentTypeEndOfPage, page: 1}))
+	return sequentialFile(segs...)
+}
+
+// profileTestRegions holds one region segment for each coding choice the
+// profiles restrict.
+var profileTestRegions = func() map[string]testSegment {
+	arithmetic := genericRegionData(testPattern(16, 8, 1), 0, 0, 0)
+	// On a blank region every context is 0, wherever the AT pixels sit.
+	movedAT := genericRegionData(NewImage(16, 8), 0, 0, 0)
+	movedAT[18] = 2
+	// An all-white MMR region: each row is a single V0 code.
+	mmr := append(regionInfoData(16, 8, 0, 0, 0), 0x01, 0xff)
+	refine := refinementRegionData(testPattern(16, 8, 2), NewImage(16, 8), 0, 0, 0)
+	// A Huffman text region; the profile check fails before it is read.
+	huffman := append(regionInfoData(16, 8, 0, 0, 0), 0x00, 0x01)
+	return map[string]testSegment{
+		"arithmetic": {typ: segmentTypeGenericRegionImmediateLossless, data: arithmetic},
+		"moved AT":   {typ: segmentTypeGenericRegionImmediateLossless, data: movedAT},
+		"MMR":        {typ: segmentTypeGenericRegionImmediateLossless, data: mmr},
+		"refinement": {typ: segmentTypeRefinementRegionImmediateLossless, data: refine},
+		"Huffman":    {typ: segmentTypeTextRegionImmediateLossless, data: huffman},
+	}
+}()
+
+// testProfile checks that, in strict mode, the regions named in allowed
+// decode under profile and those named in denied fail with
+// ErrProfileViolation.
+func testProfile(t *testing.T, profile uint32, allowed, denied []string) {
+	t.Helper()
+	for _, name := range append(allowed, denied...) {
+		region, ok := profileTestRegions[name]
+		if !ok {
+			t.Fatalf("no test region %q", name)
+		}
+		ctx, err := CreateContext(nil, 0, profileTestFile([]uint32{profile}, region), 0, nil)
+		if err != nil {
+			t.Fatalf("CreateContext returned error: %v", err)
+		}
+		ctx.SetStrict(true)
+		_, _, err = ctx.NextPage()
+		if slices.Contains(allowed, name) {
+			if err != nil {
+				t.Errorf("%s region: unexpected error %v", name, err)
+			}
+		} else if !errors.Is(err, ErrProfileViolation) {
+			t.Errorf("%s region: expected ErrProfileViolation, got %v", name, err)
+		}
+	}
+}
+
+func TestProfileAllCapabilities(t *testing.T) {
+	testProfile(t, ProfileAllCapabilities, []string{"arithmetic", "moved AT", "MMR", "refinement"}, nil)
+}
+
+func TestProfileMaximumCompression(t *testing.T) {
+	testProfile(t, ProfileMaximumCompression, []string{"arithmetic", "moved AT", "refinement"}, []string{"MMR", "Huffman"})
+}
+
+func TestProfileMediumComplexityMediumCompression(t *testing.T) {
+	testProfile(t, ProfileMediumComplexityMediumCompression, []string{"arithmetic"}, []string{"moved AT", "MMR", "refinement", "Huffman"})
+}
+
+func TestProfileLowComplexityProgressiveLossless(t *testing.T) {
+	testProfile(t, ProfileLowComplexityProgressiveLossless, []string{"MMR", "refinement"}, []string{"arithmetic", "moved AT"})
+}
+
+func TestProfileLowComplexity(t *testing.T) {
+	testProfile(t, ProfileLowComplexity, []string{"MMR"}, []string{"arithmetic", "refinement"})
+}
+
+func TestContextProfiles(t *testing.T) {
+	regions := profileTestRegions
+	tests := []struct {
+		name     string
+		region   testSegment
+		profiles []uint32
+		strict   bool
+		ok       bool
+	}{
+		{"conforming", regions["arithmetic"], []uint32{ProfileAllCapabilities, ProfileMaximumCompression}, true, true},
+		{"lenient", regions["arithmetic"], []uint32{ProfileLowComplexity}, false, true},
+		{"any profile", regions["arithmetic"], []uint32{ProfileMaximumCompression, ProfileLowComplexity}, true, false},
+		{"unknown profile", regions["arithmetic"], []uint32{99}, true, false},
+	}
+	for _, tt := range tests {
+		ctx, err := CreateContext(nil, 0, profileTestFile(tt.profiles, tt.region), 0, nil)
+		if err != nil {
+			t.Fatalf("CreateContext returned error: %v", err)
+		}
+		ctx.SetStrict(tt.strict)
+		_, _, err = ctx.NextPage()
+		if tt.ok && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrProfileViolation) {
+			t.Errorf("%s: expected ErrProfileViolation, got %v", tt.name, err)
+		}
+		if got := ctx.Profiles(); !slices.Equal(got, tt.profiles) {
+			t.Errorf("%s: Profiles() = %v, want %v", tt.name, got, tt.profiles)
+		}
+	}
+}
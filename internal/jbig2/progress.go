@@ -0,0 +1,67 @@
+package jbig2
+
+// RegionUpdate reports a region segment that has been composed onto the
+// page.
+type RegionUpdate struct {
+	Segment *Segment
+	// Rect is the page area the region affected, in the coordinates of Page.
+	Rect Rect
+	Page *Image
+}
+
+// RowsUpdate reports generic region rows that have finished decoding.
+type RowsUpdate struct {
+	Segment *Segment
+	// Rect is the page area covered by the finished rows, in the
+	// coordinates of the page image.
+	Rect Rect
+	// Region is the region bitmap; rows above Rect.Bottom, relative to the
+	// region, are final.
+	Region *Image
+}
+
+// SetOnRegion installs fn to be called after each region segment is
+// composed onto the page. A region decoded progressively is reported once
+// per composed part. Passing nil removes it.
+func (c *Context) SetOnRegion(fn func(RegionUpdate)) {
+	c.onRegion = fn
+}
+
+// SetOnRows installs fn to be called as rows of immediate generic regions
+// finish decoding. Passing nil removes it.
+func (c *Context) SetOnRows(fn func(RowsUpdate)) {
+	c.onRows = fn
+}
+
+// pageRect translates a rectangle of region ri into page image coordinates
+// and clips it to the page image.
+func (c *Context) pageRect(ri RegionInfo, r Rect) Rect {
+	r.Left += int(ri.X)
+	r.Right += int(ri.X)
+	r.Top += int(ri.Y)
+	r.Bottom += int(ri.Y)
+	if c.pageClip != nil {
+		r.Left -= c.pageClip.Left
+		r.Right -= c.pageClip.Left
+		r.Top -= c.pageClip.Top
+		r.Bottom -= c.pageClip.Top
+	}
+	return r.Intersect(Rect{Right: c.page.Width(), Bottom: c.page.Height()})
+}
+
+// rowsHandler returns the GRDProc row callback reporting rows of seg, an
+// immediate generic region described by ri, or nil when none is needed.
+func (c *Context) rowsHandler(seg *Segment, ri RegionInfo) func(top, bottom int) {
+	if c.onRows == nil || seg.Flags.Type() == segmentTypeGenericRegion {
+		return nil
+	}
+	return func(top, bottom int) {
+		if seg.Image == nil || c.page == nil {
+			return
+		}
+		rect := c.pageRect(ri, Rect{Top: top, Right: seg.Image.Width(), Bottom: bottom})
+		if !rect.Empty() {
+			c.onRows(RowsUpdate{Segment: seg, Rect: rect, Region: seg.Image})
+		}
+	}
+}
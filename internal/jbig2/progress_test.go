@@ -0,0 +1,51 @@
+package jbig2
+
+import "testing"
+
+func TestContextProgressCallbacks(t *testing.T) {
+	first := testPattern(12, 5, 1)
+	second := testPattern(8, 7, 2)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(32, 16, 0, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(first, 2, 3, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(second, 28, 12, 0)}),
+		buildSegment(testSegment{number: 3, typ: segmentTypeEndOfPage, page: 1}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+
+	var regions []RegionUpdate
+	ctx.SetOnRegion(func(u RegionUpdate) {
+		if u.Segment.Number == 1 && !sameBitmap(u.Page.SubImage(2, 3, 12, 5), first) {
+			t.Error("page view lacks the composed region")
+		}
+		regions = append(regions, u)
+	})
+	nextRow := map[uint32]int{1: 3, 2: 12}
+	ctx.SetOnRows(func(u RowsUpdate) {
+		n := u.Segment.Number
+		if u.Rect.Top != nextRow[n] || u.Rect.Height() != 1 {
+			t.Errorf("segment %d: unexpected rows %+v, want row %d", n, u.Rect, nextRow[n])
+		}
+		nextRow[n] = u.Rect.Bottom
+	})
+	if _, _, err := ctx.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+
+	if len(regions) != 2 {
+		t.Fatalf("expected 2 region updates, got %d", len(regions))
+	}
+	if r := regions[0].Rect; r != (Rect{Left: 2, Top: 3, Right: 14, Bottom: 8}) {
+		t.Errorf("unexpected first region rect %+v", r)
+	}
+	// The second region is clipped to the page.
+	if r := regions[1].Rect; r != (Rect{Left: 28, Top: 12, Right: 32, Bottom: 16}) {
+		t.Errorf("unexpected second region rect %+v", r)
+	}
+	if nextRow[1] != 8 || nextRow[2] != 16 {
+		t.Errorf("rows not fully reported: %v", nextRow)
+	}
+}
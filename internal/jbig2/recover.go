@@ -0,0 +1,152 @@
+package jbig2
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"log/slog"
+)
+
+// Damage reports a region segment that failed to decode in recovery mode.
+type Damage struct {
+	Segment uint32 // number of the failed segment
+	Type    uint8  // segment type
+	Page    uint32 // page association of the segment
+	// Rect is the part of the region, in page coordinates, that was not
+	// composed onto the page. For text and halftone regions, whose output
+	// is not decoded row by row, it is the whole region even when the part
+	// decoded before the failure was composed. It is empty when the region
+	// information itself could not be read or is invalid.
+	Rect Rect
+	Err  error
+}
+
+// SetRecover enables recovery mode. A region segment that fails to decode
+// no longer stops decoding: the rows of a generic region, the symbols of a
+// text region or the gray levels of a halftone region decoded before the
+// failure are composed, the failure is recorded as Damage and decoding
+// resumes with the next segment, located using the data length of the
+// failed one. Failures of other segments, exceeded limits and cancellation
+// still stop decoding.
+func (c *Context) SetRecover(enabled bool) {
+	c.recover = enabled
+}
+
+// Damage returns the damage recorded so far in recovery mode.
+func (c *Context) Damage() []Damage {
+	return c.damage
+}
+
+func isRegionSegment(t uint8) bool {
+	switch t {
+	case segmentTypeTextRegionImmediate, segmentTypeTextRegionImmediateLossless, segmentTypeTextRegionRefine,
+		segmentTypeHalftoneRegion, segmentTypeHalftoneRegionImmediate, segmentTypeHalftoneRegionImmediateLossless,
+		segmentTypeGenericRegion, segmentTypeGenericRegionImmediate, segmentTypeGenericRegionImmediateLossless,
+		segmentTypeRefinementRegion, segmentTypeRefinementRegionImmediate, segmentTypeRefinementRegionImmediateLossless:
+		return true
+	}
+	return false
+}
+
+// recoverSegment salvages seg, a segment whose data starting at the context
+// offset failed with err, and positions the stream at the next segment. It
+// reports false when seg cannot be recovered from.
+func (c *Context) recoverSegment(seg *Segment, err error) bool {
+	partial := c.partial
+	c.partial = nil
+	if !c.recover || seg == nil || !isRegionSegment(seg.Flags.Type()) ||
+		errors.Is(err, ErrLimitExceeded) || errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded) || errors.Is(err, ErrNeedMoreData) {
+		return false
+	}
+	data := c.stream.Buf()[c.offset:]
+	length := seg.DataLength
+	if length == unknownDataLength {
+		n, ok := unknownLengthEnd(data)
+		if !ok {
+			return false
+		}
+		length = uint32(n)
+	}
+
+	damaged := c.salvageRegion(seg, data, partial)
+	c.damage = append(c.damage, Damage{
+		Segment: seg.Number,
+		Type:    seg.Flags.Type(),
+		Page:    seg.PageAssociation,
+		Rect:    damaged,
+		Err:     err,
+	})
+	c.warn(seg, "damaged region skipped", slog.Any("error", err))
+
+	c.grdProc = nil
+	c.gbContexts = nil
+	c.grContexts = nil
+	c.arithDecoder = nil
+	c.processing = CodecStatusReady
+	if uint64(c.offset)+uint64(length) > uint64(len(c.stream.Buf())) {
+		c.stream.SetOffset(uint32(len(c.stream.Buf())))
+	} else {
+		c.stream.SetOffset(c.offset + length)
+	}
+	c.segments = append(c.segments, seg)
+	return true
+}
+
+// partialRegion is the output of an immediate text or halftone region decoded
+// before it failed, with the region information to compose it with.
+type partialRegion struct {
+	ri  RegionInfo
+	img *Image
+}
+
+// keepPartial keeps the output render returns of an immediate text or
+// halftone region that failed, for salvageRegion to compose. Outside
+// recovery mode nothing is rendered.
+func (c *Context) keepPartial(ri RegionInfo, render func() *Image) {
+	if !c.recover {
+		return
+	}
+	if img := render(); img != nil {
+		c.partial = &partialRegion{ri: ri, img: img}
+	}
+}
+
+// salvageRegion composes the part of a region decoded before it failed: the
+// rows of an immediate generic region or partial, the output of a text or
+// halftone region. It returns the rest of the region, read from the region
+// information at the start of data, in page coordinates.
+func (c *Context) salvageRegion(seg *Segment, data []byte, partial *partialRegion) Rect {
+	if len(data) < 16 {
+		return Rect{}
+	}
+	w, h := binary.BigEndian.Uint32(data[0:]), binary.BigEndian.Uint32(data[4:])
+	if !IsValidImageSize(int32(w), int32(h)) {
+		return Rect{}
+	}
+	x := int(int32(binary.BigEndian.Uint32(data[8:])))
+	y := int(int32(binary.BigEndian.Uint32(data[12:])))
+	region := Rect{Left: x, Top: y, Right: x + int(w), Bottom: y + int(h)}
+	if !c.inPage || c.stage == StageCompose {
+		return region
+	}
+	if partial != nil {
+		// Instances and gray levels may be missing anywhere in the region,
+		// so all of it is reported whether or not it composes.
+		c.composeRegion(partial.ri, partial.img, nil)
+		return region
+	}
+	proc := c.grdProc
+	if proc == nil || proc.MMR || seg.Image == nil || isIntermediateRegion(seg.Flags.Type()) {
+		return region
+	}
+	// Rows up to the last pause have been composed already.
+	decoded := proc.DecodedRows()
+	rows := Rect{Top: proc.ReplaceRect().Bottom, Right: seg.Image.Width(), Bottom: decoded}
+	if rows.Height() > 0 && c.composeRegion(c.ri, seg.Image, &rows) != nil {
+		return region
+	}
+	seg.Image = nil
+	region.Top = min(y+decoded, region.Bottom)
+	return region
+}
@@ -0,0 +1,181 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// recoverPage decodes the first page of data in recovery mode.
+func recoverPage(t *testing.T, data []byte) (*Context, *Image) {
+	t.Helper()
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetRecover(true)
+	page, _, err := ctx.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error in recovery mode: %v", err)
+	}
+	return ctx, page
+}
+
+func TestRecoverTruncatedRegion(t *testing.T) {
+	top, bottom := testPattern(16, 8, 1), testPattern(16, 24, 2)
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 32, 0x40, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(top, 0, 0, 0)})...)
+	// Cut the second half of the arithmetic coded data of the second region,
+	// which follows the region information, the flags and four AT pixels.
+	region := genericRegionData(bottom, 0, 8, 0)
+	truncated := buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: region})
+	data = append(data, truncated[:len(truncated)-(len(region)-26)/2]...)
+
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	if _, _, err := ctx.NextPage(); err == nil {
+		t.Fatal("NextPage succeeded on a truncated region without recovery")
+	}
+
+	ctx, page := recoverPage(t, data)
+	damage := ctx.Damage()
+	if len(damage) != 1 {
+		t.Fatalf("got %d damage records, want 1", len(damage))
+	}
+	d := damage[0]
+	if d.Segment != 2 || d.Page != 1 || !errors.Is(d.Err, ErrTruncated) {
+		t.Errorf("unexpected damage %+v", d)
+	}
+	if d.Rect.Left != 0 || d.Rect.Right != 16 || d.Rect.Bottom != 32 || d.Rect.Top <= 8 || d.Rect.Top >= 32 {
+		t.Fatalf("damaged rectangle %+v, want the undecoded rows of the region", d.Rect)
+	}
+	for y := int32(0); y < 8; y++ {
+		for x := int32(0); x < 16; x++ {
+			if page.GetPixel(x, y) != top.GetPixel(x, y) {
+				t.Fatalf("intact region pixel (%d,%d) differs", x, y)
+			}
+		}
+	}
+	// The rows decoded before the data ran out are composed.
+	for y := int32(8); y < int32(d.Rect.Top)-1; y++ {
+		for x := int32(0); x < 16; x++ {
+			if page.GetPixel(x, y) != bottom.GetPixel(x, y-8) {
+				t.Fatalf("salvaged row %d differs at column %d", y, x)
+			}
+		}
+	}
+}
+
+func TestRecoverResyncsAfterFailedRegion(t *testing.T) {
+	bad := genericRegionData(testPattern(8, 8, 1), 0, 0, 0)
+	bad[16] |= 0x07 // invalid combination operator
+	good := testPattern(8, 8, 3)
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x40, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: bad})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(good, 8, 0, 0)})...)
+	data = append(data, buildSegment(testSegment{number: 3, typ: segmentTypeEndOfPage, page: 1})...)
+
+	ctx, page := recoverPage(t, data)
+	damage := ctx.Damage()
+	if len(damage) != 1 || damage[0].Segment != 1 || damage[0].Rect != (Rect{Right: 8, Bottom: 8}) {
+		t.Fatalf("unexpected damage %+v", damage)
+	}
+	want := NewImage(16, 8)
+	good.ComposeTo(want, 8, 0, ComposeOR)
+	if !sameBitmap(page, want) {
+		t.Error("region after the failed one was not decoded")
+	}
+}
+
+func TestRecoverKeepsNonRegionFailuresFatal(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0, 0)[:10]})
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetRecover(true)
+	if _, _, err := ctx.NextPage(); err == nil {
+		t.Error("NextPage recovered from a truncated page information segment")
+	}
+}
+
+func TestRecoverPartialTextRegion(t *testing.T) {
+	// An arithmetic text region with the default pixel set and no symbols:
+	// its image is allocated before the first instance fails.
+	text := regionInfoData(8, 8, 4, 2, 0)
+	text = binary.BigEndian.AppendUint16(text, 1<<9)
+	text = binary.BigEndian.AppendUint32(text, 1)
+	text = append(text, 0x12, 0x34, 0x56, 0x78, 0xff, 0xac)
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 16, 0, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeTextRegionImmediateLossless, page: 1, data: text})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+
+	ctx, page := recoverPage(t, data)
+	damage := ctx.Damage()
+	region := Rect{Left: 4, Top: 2, Right: 12, Bottom: 10}
+	if len(damage) != 1 || damage[0].Rect != region {
+		t.Fatalf("unexpected damage %+v", damage)
+	}
+	for y := int32(0); y < 16; y++ {
+		for x := int32(0); x < 16; x++ {
+			want := 0
+			if int(x) >= region.Left && int(x) < region.Right && int(y) >= region.Top && int(y) < region.Bottom {
+				want = 1
+			}
+			if got := page.GetPixel(x, y); got != want {
+				t.Fatalf("page pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestHTRDProcPartialImage(t *testing.T) {
+	proc := NewHTRDProc()
+	proc.HBWidth, proc.HBHeight = 4, 2
+	proc.HGWidth, proc.HGHeight = 2, 1
+	proc.HRX = 2 << 8
+	proc.HNumPats = 4
+	for i := range 4 {
+		pattern := NewImage(2, 2)
+		pattern.Fill(i >= 2)
+		proc.HPats = append(proc.HPats, pattern)
+	}
+	proc.planes = make([]*Image, 2)
+	if proc.PartialImage() != nil {
+		t.Error("PartialImage rendered a grid without any plane")
+	}
+	// Only the most significant plane was decoded; the first cell has gray
+	// level 2 or 3 and the second 0 or 1.
+	proc.planes[1] = NewImage(2, 1)
+	proc.planes[1].SetPixel(0, 0, 1)
+	img := proc.PartialImage()
+	if img == nil {
+		t.Fatal("PartialImage returned nil")
+	}
+	for y := int32(0); y < 2; y++ {
+		for x := int32(0); x < 4; x++ {
+			want := 0
+			if x < 2 {
+				want = 1
+			}
+			if got := img.GetPixel(x, y); got != want {
+				t.Fatalf("pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+}
+
+func TestRecoverInvalidRegionSize(t *testing.T) {
+	bad := genericRegionData(testPattern(8, 8, 1), 0, 0, 0)
+	binary.BigEndian.PutUint32(bad[0:], 0x80000000)
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0, 0)})
+	data = append(data, buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: bad})...)
+	data = append(data, buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1})...)
+
+	ctx, _ := recoverPage(t, data)
+	if damage := ctx.Damage(); len(damage) != 1 || damage[0].Rect != (Rect{}) {
+		t.Errorf("unexpected damage %+v for a region of width 2^31", damage)
+	}
+}
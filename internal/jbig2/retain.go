@@ -0,0 +1,168 @@
+package jbig2
+
+import "fmt"
+
+// release drops the decoded results of seg and returns their storage to b.
+// Its header stays in the segment list so that a stray reference to it
+// reports a useful error.
+func (seg *Segment) release(b *Budget) {
+	b.Release(seg.charged)
+	seg.charged = 0
+	seg.Image = nil
+	seg.SymbolDict = nil
+	seg.PatternDict = nil
+	seg.HuffmanTable = nil
+	seg.Palette = nil
+	seg.released = true
+}
+
+// SetRelease makes the context drop the results of decoded segments once no
+// later segment can refer to them, as shown by the retention bits or by the
+// end of the page they are associated with. By default all results are kept
+// so that Segments reports them.
+func (c *Context) SetRelease(enabled bool) {
+	c.release = enabled
+}
+
+// checkReferences rejects a segment referring to a segment whose results
+// have already been released.
+func (c *Context) checkReferences(seg *Segment) error {
+	for _, ref := range seg.ReferredToSegmentNumbers {
+		if target := c.findSegmentByNumber(ref); target != nil && target.released {
+			return fmt.Errorf("jbig2: segment %d refers to released segment %d", seg.Number, ref)
+		}
+	}
+	return nil
+}
+
+// releaseReferred frees results once seg, which has just been decoded,
+// marks them as no longer needed. A referred-to segment is released when
+// seg clears its retention bit, provided the segment set its own retention
+// bit: encoders that leave all retention bits clear are not trusted to
+// use them. A segment flagged deferred non-retain is referred to by no
+// other segment and is released straight away. Segments of the global
+// context may be shared and are never released.
+func (c *Context) releaseReferred(seg *Segment) {
+	for i, ref := range seg.ReferredToSegmentNumbers {
+		if i >= len(seg.RetainReferred) || seg.RetainReferred[i] {
+			continue
+		}
+		if target := c.ownSegment(ref); target != nil && target.RetainThis {
+			target.release(c.budget)
+		}
+	}
+	if seg.Flags.DeferredNonRetain() {
+		seg.release(c.budget)
+	}
+}
+
+// releasePage frees the results of the segments associated with page. A
+// segment may only be referred to by segments of its own page or, when it
+// is associated with no page, by any segment, so nothing can refer to them
+// once the page is complete.
+func (c *Context) releasePage(page uint32) {
+	if page == 0 {
+		return
+	}
+	for _, seg := range c.segments {
+		if seg.PageAssociation == page {
+			seg.release(c.budget)
+		}
+	}
+}
+
+// chargedPage records that n budget bytes charged by the caller back the
+// page image or its colour rendering.
+func (c *Context) chargedPage(n uint64) {
+	if c.budget != nil {
+		c.pageCharged += n
+	}
+}
+
+// releasePageCharge returns the storage of the page image and its colour
+// rendering to the budget once they are replaced or handed over.
+func (c *Context) releasePageCharge() {
+	c.budget.Release(c.pageCharged)
+	c.pageCharged = 0
+}
+
+// markSegment notes the bytes charged outside the page as a segment starts,
+// so that settleSegment can attribute the bytes charged while decoding it.
+func (c *Context) markSegment() {
+	if c.budget != nil {
+		c.segmentMark = c.budget.allocated - c.pageCharged
+	}
+}
+
+// settleSegment attributes the bytes charged while decoding seg, apart from
+// page growth, to its results. Segments that keep no results, such as
+// immediate regions once composed onto the page, return them straight away;
+// the others return them when released.
+func (c *Context) settleSegment(seg *Segment) {
+	if c.budget == nil || seg == nil {
+		return
+	}
+	held := c.budget.allocated - c.pageCharged
+	if held <= c.segmentMark {
+		return
+	}
+	held -= c.segmentMark
+	if seg.Image != nil || seg.SymbolDict != nil || seg.PatternDict != nil {
+		seg.charged += held
+		return
+	}
+	c.budget.Release(held)
+}
+
+// ownSegment is like findSegmentByNumber but ignores the global context.
+func (c *Context) ownSegment(number uint32) *Segment {
+	for _, seg := range c.segments {
+		if seg.Number == number {
+			return seg
+		}
+	}
+	return nil
+}
+
+// LiveBytes returns the bitmap storage the context currently holds: the
+// page image, its colour rendering and the retained results of decoded
+// segments, including those of the global context. Symbol dictionaries
+// cached by a DocumentContext and shared Globals are not included.
+func (c *Context) LiveBytes() uint64 {
+	var n uint64
+	if c.page != nil {
+		n += imageBytes(c.page)
+	}
+	if c.colourPage != nil {
+		n += uint64(len(c.colourPage.Pix))
+	}
+	if c.globalContext != nil && !c.sharedGlobals {
+		n += c.globalContext.segmentBytes()
+	}
+	return n + c.segmentBytes()
+}
+
+func (c *Context) segmentBytes() uint64 {
+	var n uint64
+	for _, seg := range c.segments {
+		n += imageBytes(seg.Image)
+		if seg.SymbolDict != nil {
+			for _, sym := range seg.SymbolDict.symbols {
+				n += imageBytes(sym)
+			}
+		}
+		if seg.PatternDict != nil {
+			for _, pat := range seg.PatternDict.Patterns {
+				n += imageBytes(pat)
+			}
+		}
+	}
+	return n
+}
+
+func imageBytes(img *Image) uint64 {
+	if img == nil {
+		return 0
+	}
+	return uint64(len(img.data))
+}
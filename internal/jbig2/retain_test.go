@@ -0,0 +1,116 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"strings"
+	"testing"
+)
+
+func TestParseSegmentHeaderRetainBits(t *testing.T) {
+	short := buildSegmentHeader(testSegment{number: 9, typ: segmentTypeEndOfPage, page: 1, refs: []uint32{2, 4}, retain: 0x05})
+	long := binary.BigEndian.AppendUint32(nil, 9)
+	long = append(long, segmentTypeEndOfPage)
+	long = binary.BigEndian.AppendUint32(long, 7<<29|5)
+	long = append(long, 0x25)
+	long = append(long, 1, 2, 3, 4, 5, 1)
+	long = binary.BigEndian.AppendUint32(long, 0)
+
+	tests := []struct {
+		name     string
+		header   []byte
+		refs     []uint32
+		this     bool
+		referred []bool
+	}{
+		{"short", short, []uint32{2, 4}, true, []bool{false, true}},
+		{"long", long, []uint32{1, 2, 3, 4, 5}, true, []bool{false, true, false, false, true}},
+	}
+	for _, tt := range tests {
+		c := newContext(tt.header, 0, nil, false)
+		seg := NewSegment()
+		if err := c.parseSegmentHeader(seg); err != nil {
+			t.Fatalf("%s: parseSegmentHeader returned error: %v", tt.name, err)
+		}
+		if int(c.stream.Offset()) != len(tt.header) {
+			t.Errorf("%s: header parsed to offset %d of %d", tt.name, c.stream.Offset(), len(tt.header))
+		}
+		if seg.PageAssociation != 1 || len(seg.ReferredToSegmentNumbers) != len(tt.refs) {
+			t.Fatalf("%s: unexpected header %+v", tt.name, seg)
+		}
+		for i, ref := range tt.refs {
+			if seg.ReferredToSegmentNumbers[i] != ref || seg.RetainReferred[i] != tt.referred[i] {
+				t.Errorf("%s: referred segment %d: got %d retained %v", tt.name, i, seg.ReferredToSegmentNumbers[i], seg.RetainReferred[i])
+			}
+		}
+		if seg.RetainThis != tt.this {
+			t.Errorf("%s: RetainThis = %v", tt.name, seg.RetainThis)
+		}
+	}
+}
+
+func TestContextReleasesUnretainedSegments(t *testing.T) {
+	coarse, fine := testPattern(8, 5, 2), testPattern(8, 5, 3)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x22, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegion, page: 1, retain: 0x01, data: genericRegionData(coarse, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeRefinementRegion, page: 1, refs: []uint32{1}, data: refinementRegionData(fine, coarse, 0, 0, 0)}),
+		buildSegment(testSegment{number: 3, typ: segmentTypeRefinementRegionImmediateLossless, page: 1, refs: []uint32{1}, data: refinementRegionData(fine, coarse, 0, 0, 0)}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetRelease(true)
+	_, _, err = ctx.NextPage()
+	if err == nil || !strings.Contains(err.Error(), "released segment 1") {
+		t.Fatalf("expected a reference to a released segment to fail, got %v", err)
+	}
+	if seg := ctx.findSegmentByNumber(2); seg == nil || seg.Image == nil {
+		t.Error("intermediate refinement result was not retained")
+	}
+}
+
+func TestContextReleasesPageSegments(t *testing.T) {
+	region := testPattern(16, 8, 1)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x20, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegion, page: 1, data: genericRegionData(region, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+		buildSegment(testSegment{number: 3, typ: segmentTypePageInfo, page: 2, data: pageInfoData(16, 8, 0x20, 0)}),
+		buildSegment(testSegment{number: 4, typ: segmentTypeGenericRegion, page: 2, data: genericRegionData(region, 0, 0, 0)}),
+		buildSegment(testSegment{number: 5, typ: segmentTypeEndOfPage, page: 2}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	ctx.SetRelease(true)
+	for page := 1; page <= 2; page++ {
+		img, _, err := ctx.NextPage()
+		if err != nil {
+			t.Fatalf("page %d: NextPage returned error: %v", page, err)
+		}
+		if got, want := ctx.LiveBytes(), imageBytes(img); got != want {
+			t.Errorf("page %d: LiveBytes = %d, want %d for the page alone", page, got, want)
+		}
+	}
+}
+
+func TestContextKeepsResultsByDefault(t *testing.T) {
+	region := testPattern(16, 8, 1)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x20, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegion, page: 1, data: genericRegionData(region, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+	)
+	ctx, err := CreateContext(nil, 0, data, 0, nil)
+	if err != nil {
+		t.Fatalf("CreateContext returned error: %v", err)
+	}
+	if _, _, err := ctx.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if seg := ctx.findSegmentByNumber(1); seg == nil || !sameBitmap(seg.Image, region) {
+		t.Error("intermediate region result was not kept after the page")
+	}
+}
@@ -0,0 +1,237 @@
+package jbig2
+
+import "bytes"
+
+const unknownDataLength = ^uint32(0)
+
+// SegmentInfo summarises a segment header together with the fields of its
+// data that can be read without decoding.
+type SegmentInfo struct {
+	Number     uint32
+	Flags      SegmentFlags
+	ReferredTo []uint32
+	Page       uint32
+	// DataOffset is the offset of the segment data in the scanned input.
+	DataOffset uint64
+	// DataLength is the length of the segment data. For an immediate generic
+	// region of unknown length it is resolved from the end marker.
+	DataLength    uint32
+	UnknownLength bool
+
+	Region   *RegionInfo // region segments
+	PageInfo *PageInfo   // page information segments
+
+	NumExportedSymbols uint32 // symbol dictionaries
+	NumNewSymbols      uint32 // symbol dictionaries
+	NumPatterns        uint64 // pattern dictionaries, up to 2^32
+	NumInstances       uint32 // text regions
+	StripeEndRow       uint32 // end-of-stripe segments
+}
+
+// ScanResult lists the segments of a stream and of its global data.
+type ScanResult struct {
+	Header   *FileHeader
+	Globals  []SegmentInfo
+	Segments []SegmentInfo
+}
+
+// Scan walks the segment headers of data and, when given, globals. Beyond
+// the headers only fixed-size fields at the start of the segment data are
+// read: no bitmaps are allocated and nothing is arithmetic or MMR decoded.
+func Scan(data, globals []byte) (*ScanResult, error) {
+	res := &ScanResult{}
+	if len(globals) > 0 {
+		segs, _, err := scanStream(globals)
+		if err != nil {
+			return nil, err
+		}
+		res.Globals = segs
+	}
+	segs, header, err := scanStream(data)
+	if err != nil {
+		return nil, err
+	}
+	res.Header = header
+	res.Segments = segs
+	return res, nil
+}
+
+func scanStream(data []byte) ([]SegmentInfo, *FileHeader, error) {
+	trimmed, header, err := stripJBIG2FileHeader(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	c := newContext(trimmed, 0, nil, false)
+	c.baseOffset = uint64(len(data) - len(trimmed))
+	c.fileHeader = header
+	if header != nil && header.RandomAccess() {
+		if err := c.parseSegmentHeaderTable(); err != nil {
+			return nil, nil, err
+		}
+	}
+	var segs []SegmentInfo
+	for c.hasMoreSegments() {
+		headerOffset := c.stream.Offset()
+		seg, err := c.nextSegmentHeader()
+		if err != nil {
+			return nil, nil, c.segmentError(seg, StageHeader, headerOffset, err)
+		}
+		start := c.stream.Offset()
+		rest := c.stream.Buf()[start:]
+		length := seg.DataLength
+		if length == unknownDataLength {
+			n, ok := unknownLengthEnd(rest)
+			if !ok {
+				return nil, nil, c.segmentError(seg, StageData, start, truncatedf("jbig2: end marker of segment %d not found", seg.Number))
+			}
+			length = uint32(n)
+		} else if uint64(length) > uint64(len(rest)) {
+			return nil, nil, c.segmentError(seg, StageData, start, truncatedf("jbig2: data of segment %d extends past end of input", seg.Number))
+		}
+		info := SegmentInfo{
+			Number:        seg.Number,
+			Flags:         seg.Flags,
+			ReferredTo:    seg.ReferredToSegmentNumbers,
+			Page:          seg.PageAssociation,
+			DataOffset:    c.baseOffset + uint64(start),
+			DataLength:    length,
+			UnknownLength: seg.DataLength == unknownDataLength,
+		}
+		// The fields are read from the segment data alone, so that a segment
+		// too short for them is reported as truncated rather than read into
+		// its successor.
+		data := newContext(rest[:length], 0, nil, false)
+		if err := data.scanSegmentData(seg, &info); err != nil {
+			return nil, nil, c.segmentError(seg, StageData, start, err)
+		}
+		segs = append(segs, info)
+		if seg.Flags.Type() == segmentTypeEndOfFile {
+			break
+		}
+		c.stream.SetOffset(start + length)
+	}
+	return segs, header, nil
+}
+
+// scanSegmentData reads the fixed-size fields at the start of the segment
+// data into info. The stream must hold the segment data and no more.
+func (c *Context) scanSegmentData(seg *Segment, info *SegmentInfo) error {
+	switch seg.Flags.Type() {
+	case segmentTypePageInfo:
+		pageInfo, err := c.readPageInfo(seg)
+		if err != nil {
+			return err
+		}
+		info.PageInfo = pageInfo
+	case segmentTypeEndOfStripe:
+		row, err := c.stream.ReadUint32()
+		if err != nil {
+			return err
+		}
+		info.StripeEndRow = row
+	case segmentTypeSymbolDict:
+		return c.scanSymbolDict(info)
+	case segmentTypePatternDict:
+		c.stream.AddOffset(3)
+		grayMax, err := c.stream.ReadUint32()
+		if err != nil {
+			return err
+		}
+		info.NumPatterns = uint64(grayMax) + 1
+	case segmentTypeTextRegionImmediate, segmentTypeTextRegionImmediateLossless, segmentTypeTextRegionRefine:
+		if err := c.scanRegionInfo(info); err != nil {
+			return err
+		}
+		return c.scanTextRegion(info)
+	case segmentTypeHalftoneRegion, segmentTypeHalftoneRegionImmediate, segmentTypeHalftoneRegionImmediateLossless,
+		segmentTypeGenericRegion, segmentTypeGenericRegionImmediate, segmentTypeGenericRegionImmediateLossless,
+		segmentTypeRefinementRegion, segmentTypeRefinementRegionImmediate, segmentTypeRefinementRegionImmediateLossless:
+		return c.scanRegionInfo(info)
+	}
+	return nil
+}
+
+func (c *Context) scanRegionInfo(info *SegmentInfo) error {
+	ri := &RegionInfo{}
+	if err := c.parseRegionInfo(ri); err != nil {
+		return err
+	}
+	info.Region = ri
+	return nil
+}
+
+// scanSymbolDict reads the symbol counts, skipping the AT pixels that
+// precede them.
+func (c *Context) scanSymbolDict(info *SegmentInfo) error {
+	flags, err := c.stream.ReadUint16()
+	if err != nil {
+		return err
+	}
+	sdHuff := flags&0x0001 != 0
+	sdRefAgg := flags&0x0002 != 0
+	sdTemplate := (flags >> 10) & 0x0003
+	sdRTemplate := flags&0x1000 != 0
+	if !sdHuff {
+		if sdTemplate == 0 {
+			c.stream.AddOffset(8)
+		} else {
+			c.stream.AddOffset(2)
+		}
+	}
+	if sdRefAgg && !sdRTemplate {
+		c.stream.AddOffset(4)
+	}
+	if info.NumExportedSymbols, err = c.stream.ReadUint32(); err != nil {
+		return err
+	}
+	info.NumNewSymbols, err = c.stream.ReadUint32()
+	return err
+}
+
+// scanTextRegion reads the instance count following the region information,
+// skipping the Huffman table selection and refinement AT pixels.
+func (c *Context) scanTextRegion(info *SegmentInfo) error {
+	flags, err := c.stream.ReadUint16()
+	if err != nil {
+		return err
+	}
+	if flags&0x0001 != 0 {
+		c.stream.AddOffset(2)
+	}
+	if flags&0x0002 != 0 && flags&0x8000 == 0 {
+		c.stream.AddOffset(4)
+	}
+	info.NumInstances, err = c.stream.ReadUint32()
+	return err
+}
+
+// unknownLengthEnd returns the length of the data of an immediate generic
+// region whose length is unknown, which runs up to and including the end
+// marker and the row count that follows it. Only immediate generic regions
+// may have an unknown length; the marker follows the region information
+// and the region flags.
+func unknownLengthEnd(data []byte) (int, bool) {
+	return unknownLengthEndFrom(data, 0)
+}
+
+// unknownLengthEndFrom is unknownLengthEnd with the search for the end
+// marker starting no earlier than data[from:].
+func unknownLengthEndFrom(data []byte, from int) (int, bool) {
+	flags := regionInfoSize(data)
+	if len(data) <= flags {
+		return 0, false
+	}
+	marker := []byte{0xff, 0xac}
+	if data[flags]&0x01 != 0 {
+		marker = []byte{0x00, 0x00}
+	}
+	start := max(flags+1, from)
+	if start > len(data) {
+		return 0, false
+	}
+	idx := bytes.Index(data[start:], marker)
+	if idx < 0 || start+idx+len(marker)+4 > len(data) {
+		return 0, false
+	}
+	return start + idx + len(marker) + 4, true
+}
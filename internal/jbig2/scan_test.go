@@ -0,0 +1,131 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+func TestScanSequentialFile(t *testing.T) {
+	symbolDict := binary.BigEndian.AppendUint16(nil, 0x0000)
+	symbolDict = append(symbolDict, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	symbolDict = binary.BigEndian.AppendUint32(symbolDict, 3)
+	symbolDict = binary.BigEndian.AppendUint32(symbolDict, 4)
+	symbolDict = append(symbolDict, 0xde, 0xad)
+
+	textRegion := regionInfoData(20, 10, 1, 2, 0)
+	textRegion = binary.BigEndian.AppendUint16(textRegion, 0x0001)
+	textRegion = binary.BigEndian.AppendUint16(textRegion, 0x0000)
+	textRegion = binary.BigEndian.AppendUint32(textRegion, 5)
+	textRegion = append(textRegion, 0xbe, 0xef)
+
+	region := testPattern(10, 4, 3)
+	header := buildSegmentHeader(testSegment{number: 3, typ: segmentTypeGenericRegionImmediate, page: 1})
+	binary.BigEndian.PutUint32(header[len(header)-4:], 0xffffffff)
+	regionData := genericRegionData(region, 0, 4, 0)
+	regionData = binary.BigEndian.AppendUint32(regionData, uint32(region.Height()))
+
+	pageInfo := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(20, 8, 0x04, 0)})
+	data := sequentialFile(
+		pageInfo,
+		buildSegment(testSegment{number: 1, typ: segmentTypeSymbolDict, data: symbolDict}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeTextRegionImmediateLossless, page: 1, refs: []uint32{1}, data: textRegion}),
+		append(header, regionData...),
+		buildSegment(testSegment{number: 4, typ: segmentTypeEndOfStripe, page: 1, data: binary.BigEndian.AppendUint32(nil, 7)}),
+		buildSegment(testSegment{number: 5, typ: segmentTypeEndOfPage, page: 1}),
+		buildSegment(testSegment{number: 6, typ: segmentTypeEndOfFile}),
+	)
+
+	res, err := Scan(data, nil)
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if res.Header == nil || !res.Header.Sequential() {
+		t.Fatal("expected a sequential file header")
+	}
+	if len(res.Segments) != 7 {
+		t.Fatalf("expected 7 segments, got %d", len(res.Segments))
+	}
+	segs := res.Segments
+	if info := segs[0].PageInfo; info == nil || info.Width != 20 || info.Height != 8 || !info.DefaultPixelValue {
+		t.Errorf("unexpected page info %+v", info)
+	}
+	if want := uint64(len(jbig2FileSignature) + 1 + 11); segs[0].DataOffset != want || segs[0].DataLength != 19 {
+		t.Errorf("page info data at %d+%d, want %d+19", segs[0].DataOffset, segs[0].DataLength, want)
+	}
+	if segs[1].NumExportedSymbols != 3 || segs[1].NumNewSymbols != 4 || segs[1].Page != 0 {
+		t.Errorf("unexpected symbol dictionary %+v", segs[1])
+	}
+	if r := segs[2].Region; r == nil || r.Width != 20 || r.Height != 10 || r.X != 1 || r.Y != 2 {
+		t.Errorf("unexpected text region info %+v", r)
+	}
+	if segs[2].NumInstances != 5 || len(segs[2].ReferredTo) != 1 || segs[2].ReferredTo[0] != 1 {
+		t.Errorf("unexpected text region %+v", segs[2])
+	}
+	if !segs[3].UnknownLength || segs[3].DataLength != uint32(len(regionData)) || segs[3].Region.Y != 4 {
+		t.Errorf("unexpected unknown-length region %+v", segs[3])
+	}
+	if segs[4].StripeEndRow != 7 {
+		t.Errorf("unexpected end of stripe row %d", segs[4].StripeEndRow)
+	}
+	if segs[6].Flags.Type() != segmentTypeEndOfFile {
+		t.Errorf("expected end of file last, got type %d", segs[6].Flags.Type())
+	}
+}
+
+func TestScanGlobals(t *testing.T) {
+	globals := buildSegment(testSegment{number: 0, typ: segmentTypePatternDict, data: []byte{0x00, 4, 4, 0, 0, 0, 15}})
+	data := buildSegment(testSegment{number: 1, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 8, 0, 0)})
+
+	res, err := Scan(data, globals)
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if res.Header != nil {
+		t.Error("expected no file header for an embedded stream")
+	}
+	if len(res.Globals) != 1 || res.Globals[0].NumPatterns != 16 {
+		t.Fatalf("unexpected globals %+v", res.Globals)
+	}
+	if len(res.Segments) != 1 || res.Segments[0].DataOffset != 11 {
+		t.Fatalf("unexpected segments %+v", res.Segments)
+	}
+}
+
+func TestScanTruncated(t *testing.T) {
+	seg := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 8, 0, 0)})
+	_, err := Scan(seg[:len(seg)-1], nil)
+	var de *DecodeError
+	if !errors.As(err, &de) || !errors.Is(err, ErrTruncated) || de.Stage != StageData {
+		t.Fatalf("expected a truncated data-stage *DecodeError, got %v", err)
+	}
+}
+
+func TestScanShortSegment(t *testing.T) {
+	// Each segment is too short for its fixed fields; the page information
+	// segment that follows must not be read in their place.
+	pageInfo := buildSegment(testSegment{number: 1, typ: segmentTypePageInfo, page: 1, data: pageInfoData(8, 8, 0, 0)})
+	for _, seg := range []testSegment{
+		{number: 0, typ: segmentTypeSymbolDict, data: []byte{0x00, 0x01}},
+		{number: 0, typ: segmentTypePatternDict, data: []byte{0x00, 4, 4}},
+		{number: 0, typ: segmentTypeEndOfStripe, page: 1, data: []byte{0, 0}},
+		{number: 0, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: regionInfoData(8, 8, 0, 0, 0)[:10]},
+	} {
+		_, err := Scan(append(buildSegment(seg), pageInfo...), nil)
+		var de *DecodeError
+		if !errors.As(err, &de) || !errors.Is(err, ErrTruncated) || de.Segment != 0 {
+			t.Errorf("type %d: expected a truncated *DecodeError for segment 0, got %v", seg.typ, err)
+		}
+	}
+}
+
+func TestScanLargestPatternDict(t *testing.T) {
+	data := buildSegment(testSegment{number: 0, typ: segmentTypePatternDict, data: []byte{0x00, 4, 4, 0xff, 0xff, 0xff, 0xff}})
+	res, err := Scan(data, nil)
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if got := res.Segments[0].NumPatterns; got != 1<<32 {
+		t.Errorf("NumPatterns = %d, want 2^32", got)
+	}
+}
@@ -21,6 +21,8 @@ type SDDProc struct {
 	SDHUFFAGGINST *HuffmanTable
 	SDAT          [8]int8
 	SDRAT         [4]int8
+	Cancel        CancelIndicator
+	Budget        *Budget
 }
 
 // NewSDDProc constructs an empty symbol dictionary decoder configuration.
@@ -31,6 +33,9 @@ func (p *SDDProc) DecodeArith(decoder *ArithDecoder, gbContexts, grContexts []Ar
 	if decoder == nil {
 		return nil, errors.New("jbig2: nil arithmetic decoder for symbol dictionary")
 	}
+	if err := p.checkSymbolCounts(); err != nil {
+		return nil, err
+	}
 
 	totalSymbols := p.SDNUMINSYMS + p.SDNUMNEWSYMS
 	newSymbols := make([]*Image, p.SDNUMNEWSYMS)
@@ -58,6 +63,9 @@ func (p *SDDProc) DecodeArith(decoder *ArithDecoder, gbContexts, grContexts []Ar
 	var hcHeight uint32
 	var decoded uint32
 	for decoded < p.SDNUMNEWSYMS {
+		if err := checkCancel(p.Cancel); err != nil {
+			return nil, err
+		}
 		hDelta, inBand, err := iadH.Decode(decoder)
 		if err != nil {
 			return nil, err
@@ -88,6 +96,9 @@ func (p *SDDProc) DecodeArith(decoder *ArithDecoder, gbContexts, grContexts []Ar
 				return nil, errors.New("jbig2: symbol width out of range")
 			}
 			symWidth = uint32(widthVal)
+			if err := p.Budget.AddSymbol(uint64(symWidth), uint64(hcHeight)); err != nil {
+				return nil, err
+			}
 			var symbol *Image
 			if hcHeight == 0 || symWidth == 0 {
 				symbol = nil
@@ -138,6 +149,14 @@ func (p *SDDProc) DecodeArith(decoder *ArithDecoder, gbContexts, grContexts []Ar
 	return p.buildExportedDictionary(newSymbols, exportFlags)
 }
 
+// checkSymbolCounts validates the declared symbol counts against the budget.
+func (p *SDDProc) checkSymbolCounts() error {
+	if err := p.Budget.CheckSymbolCount(p.SDNUMNEWSYMS); err != nil {
+		return err
+	}
+	return p.Budget.CheckSymbolCount(p.SDNUMEXSYMS)
+}
+
 // DecodeHuffman decodes the dictionary using Huffman coding.
 func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []ArithContext) (*SymbolDict, error) {
 	if stream == nil {
@@ -146,6 +165,9 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 	if p.SDHUFFDH == nil || p.SDHUFFDW == nil || p.SDHUFFBMSIZE == nil {
 		return nil, errors.New("jbig2: missing Huffman tables for symbol dictionary")
 	}
+	if err := p.checkSymbolCounts(); err != nil {
+		return nil, err
+	}
 
 	decoder := NewHuffmanDecoder(stream)
 	totalSymbols := p.SDNUMINSYMS + p.SDNUMNEWSYMS
@@ -155,6 +177,9 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 	var currentHeight uint32
 	var decoded uint32
 	for decoded < p.SDNUMNEWSYMS {
+		if err := checkCancel(p.Cancel); err != nil {
+			return nil, err
+		}
 		hDelta, err := decoder.Decode(p.SDHUFFDH)
 		if err != nil {
 			return nil, err
@@ -191,6 +216,9 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 			if totalWidth > uint32(JBig2MaxImageSize) {
 				return nil, errors.New("jbig2: aggregate symbol width out of range")
 			}
+			if err := p.Budget.AddSymbol(uint64(currentWidth), uint64(currentHeight)); err != nil {
+				return nil, err
+			}
 			widths[decoded] = currentWidth
 			decoded++
 		}
@@ -244,6 +272,8 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 				}
 
 				trd := NewTRDProc()
+				trd.Cancel = p.Cancel
+				trd.Budget = p.Budget
 				trd.SBHUFF = p.SDHUFF
 				trd.SBREFINE = true
 				trd.SBWidth = currentWidth
@@ -350,6 +380,7 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 
 				// Create refinement region processor
 				grrd := NewGRRDProc()
+				grrd.Cancel = p.Cancel
 				grrd.Template = p.SDRTEMPLATE
 				grrd.TPGRON = false
 				grrd.Width = currentWidth
@@ -398,12 +429,16 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 		if bmsize != 0 {
 			// Use MMR decoding for compressed bitmaps
 			grd := NewGRDProc()
+			grd.Cancel = p.Cancel
 			grd.MMR = true
 			grd.GBWidth = totalWidth
 			grd.GBHeight = currentHeight
 			var decodedImg *Image
 			status, err := grd.StartDecodeMMR(&decodedImg, stream)
-			if err != nil || status != CodecStatusFinished {
+			if err != nil {
+				return nil, err
+			}
+			if status != CodecStatusFinished {
 				return nil, errors.New("jbig2: failed to decode MMR symbol bitmap")
 			}
 			bhc = decodedImg
@@ -414,7 +449,7 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 			}
 			needed := stride * currentHeight
 			if needed > stream.BytesLeft() {
-				return nil, errors.New("jbig2: insufficient data for symbol bitmaps")
+				return nil, truncatedf("jbig2: insufficient data for symbol bitmaps")
 			}
 
 			bhc = NewImage(int32(totalWidth), int32(currentHeight))
@@ -455,6 +490,7 @@ func (p *SDDProc) DecodeHuffman(stream *BitStream, gbContexts, grContexts []Arit
 
 func (p *SDDProc) decodeGenericSymbolArith(decoder *ArithDecoder, gbContexts []ArithContext, width, height uint32) (*Image, error) {
 	proc := NewGRDProc()
+	proc.Cancel = p.Cancel
 	proc.MMR = false
 	proc.TPGDON = false
 	proc.UseSkip = false
@@ -469,6 +505,8 @@ func (p *SDDProc) decodeGenericSymbolArith(decoder *ArithDecoder, gbContexts []A
 
 func (p *SDDProc) configureTRDProcArithmetic(width, height, instances uint32, decoded uint32, newSymbols []*Image, iadt, iafs, iads, iait, iari, iardw, iardh, iardx, iardy *ArithIntDecoder, iaid *ArithIaidDecoder) (*TRDProc, *IntDecoderState, error) {
 	trd := NewTRDProc()
+	trd.Cancel = p.Cancel
+	trd.Budget = p.Budget
 	trd.SBHUFF = p.SDHUFF
 	trd.SBREFINE = true
 	trd.SBWidth = width
@@ -552,6 +590,7 @@ func (p *SDDProc) decodeRefinedSymbolArith(decoder *ArithDecoder, grContexts []A
 	}
 
 	grrd := NewGRRDProc()
+	grrd.Cancel = p.Cancel
 	grrd.Template = p.SDRTEMPLATE
 	grrd.TPGRON = false
 	grrd.Width = width
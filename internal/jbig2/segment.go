@@ -1,5 +1,7 @@
 package jbig2
 
+import "image/color"
+
 // SegmentState enumerates the parsing lifecycle for a JBIG2 segment.
 type SegmentState int
 
@@ -100,6 +102,17 @@ type Segment struct {
 	PatternDict              *PatternDict
 	Image                    *Image
 	HuffmanTable             *HuffmanTable
+	Palette                  []color.RGBA
+
+	// RetainThis is the retention bit of the segment itself; encoders set it
+	// when a later segment refers to this one.
+	RetainThis bool
+	// RetainReferred holds the retention bits of the referred-to segments. A
+	// clear bit marks this segment as the last one to refer to that segment.
+	RetainReferred []bool
+
+	released bool
+	charged  uint64 // budget bytes held by the results, returned on release
 }
 
 // NewSegment mirrors the default construction semantics from the C++ implementation.
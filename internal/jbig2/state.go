@@ -0,0 +1,795 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"hash/fnv"
+	"image"
+	"image/color"
+	"time"
+)
+
+// stateMagic and stateVersion start every serialized decoder state.
+const (
+	stateMagic   = "JB2S"
+	stateVersion = 1
+)
+
+// Kinds of global segments recorded in a serialized state.
+const (
+	stateNoGlobals = iota
+	stateGlobalData
+	stateSharedGlobals
+)
+
+var (
+	errInvalidState  = errors.New("jbig2: invalid decoder state")
+	errStateMismatch = errors.New("jbig2: decoder state does not match the data")
+)
+
+// MarshalState serializes the decoding state of c: the stream position,
+// the pages and retained segment results decoded so far and, when decoding
+// is paused inside a generic region, the arithmetic decoder registers,
+// contexts and row position. UnmarshalState restores it into a context
+// created over the same data.
+//
+// The state does not include the data itself, the results of global
+// segments, which are decoded again on restore, or the installed callbacks
+// and limits. It cannot be taken after a decode error or while global
+// segments are being decoded.
+func (c *Context) MarshalState() ([]byte, error) {
+	if c.processing == CodecStatusError {
+		return nil, errors.New("jbig2: cannot save the state of a failed decode")
+	}
+	if c.globalContext != nil && c.globalContext.currentSegment != nil {
+		return nil, errors.New("jbig2: cannot save state while decoding global segments")
+	}
+	w := &stateWriter{buf: []byte(stateMagic)}
+	w.uint(stateVersion)
+	w.uint(dataHash(c.stream.Buf()))
+	switch {
+	case c.globalContext == nil:
+		w.uint(stateNoGlobals)
+	case c.sharedGlobals:
+		w.uint(stateSharedGlobals)
+		w.uint(dataHash(c.globalContext.stream.Buf()))
+	default:
+		w.uint(stateGlobalData)
+		w.uint(dataHash(c.globalContext.stream.Buf()))
+		w.bool(c.globalContext.stream.Offset() > 0 || c.globalContext.endOfFile)
+	}
+
+	w.uint(uint64(c.stream.BitPos()))
+	w.uint(c.baseOffset)
+	w.uint(uint64(c.offset))
+	w.bool(c.inPage)
+	w.bool(c.pageReady)
+	w.bool(c.endOfFile)
+	w.bool(c.randomAccess)
+	w.bool(c.emitting)
+	w.int(int64(c.pauseStep))
+	w.int(int64(c.processing))
+	w.int(int64(c.stage))
+	w.uint(c.trace.headerSize)
+	w.int(int64(c.trace.elapsed))
+	if c.budget != nil {
+		w.uint(c.budget.allocated)
+		w.uint(c.budget.symbolBytes)
+		w.uint(uint64(c.budget.segments))
+	} else {
+		w.uint(0)
+		w.uint(0)
+		w.uint(0)
+	}
+	w.uint(c.pageCharged)
+	w.uint(c.segmentMark)
+
+	w.uint(uint64(len(c.pageInfos)))
+	for _, info := range c.pageInfos {
+		w.pageInfo(info)
+	}
+	w.image(c.page)
+	w.rgba(c.colourPage)
+	w.optRect(c.pageClip)
+	w.optRect(c.pageCrop)
+	w.uint(uint64(len(c.profiles)))
+	for _, p := range c.profiles {
+		w.uint(uint64(p))
+	}
+	w.uint(uint64(len(c.comments)))
+	for _, cm := range c.comments {
+		w.uint(uint64(cm.Segment))
+		w.uint(uint64(cm.Page))
+		w.string(cm.Name)
+		w.string(cm.Value)
+	}
+	w.uint(uint64(len(c.damage)))
+	for _, d := range c.damage {
+		w.uint(uint64(d.Segment))
+		w.uint(uint64(d.Type))
+		w.uint(uint64(d.Page))
+		w.rect(d.Rect)
+		w.error(d.Err)
+	}
+
+	w.uint(uint64(len(c.segments)))
+	for _, seg := range c.segments {
+		w.segment(seg)
+	}
+	w.uint(uint64(len(c.headerTable)))
+	for _, seg := range c.headerTable {
+		w.segment(seg)
+	}
+	w.bool(c.currentSegment != nil)
+	if c.currentSegment != nil {
+		w.segment(c.currentSegment)
+	}
+
+	w.regionInfo(c.ri)
+	w.bool(c.grdProc != nil)
+	if p := c.grdProc; p != nil {
+		w.bool(p.MMR)
+		w.bool(p.TPGDON)
+		w.bool(p.UseSkip)
+		w.uint(uint64(p.GBTemplate))
+		w.uint(uint64(p.GBWidth))
+		w.uint(uint64(p.GBHeight))
+		w.image(p.Skip)
+		for _, at := range p.GBAt {
+			w.int(int64(at))
+		}
+		w.rect(p.replaceRect)
+		w.int(int64(p.progressiveStatus))
+		w.int(int64(p.decodeType))
+		w.int(int64(p.loopIndex))
+		w.int(int64(p.ltp))
+	}
+	w.contexts(c.gbContexts)
+	w.contexts(c.grContexts)
+	w.bool(c.arithDecoder != nil)
+	if a := c.arithDecoder; a != nil {
+		w.bool(a.complete)
+		w.uint(uint64(a.state))
+		w.uint(uint64(a.b))
+		w.uint(uint64(a.c))
+		w.uint(uint64(a.a))
+		w.uint(uint64(a.ct))
+	}
+	return w.buf, nil
+}
+
+// UnmarshalState restores a state produced by MarshalState into c, which
+// must have been created over the same data and global segments and not
+// have decoded anything yet. Global segments recorded as decoded are decoded
+// again first. A state taken while a page was emitted stripe by stripe needs
+// a stripe callback set on c.
+func (c *Context) UnmarshalState(data []byte) error {
+	if len(data) < len(stateMagic) || string(data[:len(stateMagic)]) != stateMagic {
+		return errInvalidState
+	}
+	r := &stateReader{buf: data[len(stateMagic):]}
+	if r.uint() != stateVersion {
+		return errors.New("jbig2: unsupported decoder state version")
+	}
+	if r.uint() != dataHash(c.stream.Buf()) {
+		return errStateMismatch
+	}
+	switch r.uint() {
+	case stateNoGlobals:
+		if c.globalContext != nil {
+			return errStateMismatch
+		}
+	case stateSharedGlobals:
+		if c.globalContext == nil || !c.sharedGlobals || r.uint() != dataHash(c.globalContext.stream.Buf()) {
+			return errStateMismatch
+		}
+	case stateGlobalData:
+		if c.globalContext == nil || c.sharedGlobals || r.uint() != dataHash(c.globalContext.stream.Buf()) {
+			return errStateMismatch
+		}
+		if r.bool() && r.err == nil {
+			if err := c.decodeGlobals(nil); err != nil {
+				return err
+			}
+		}
+	default:
+		return errInvalidState
+	}
+
+	bitPos := r.uint()
+	if bitPos>>3 > uint64(len(c.stream.Buf())) {
+		return errInvalidState
+	}
+	c.stream.SetBitPos(uint32(bitPos))
+	c.baseOffset = r.uint()
+	c.offset = uint32(r.uint())
+	c.inPage = r.bool()
+	c.pageReady = r.bool()
+	c.endOfFile = r.bool()
+	c.randomAccess = r.bool()
+	c.emitting = r.bool()
+	if c.emitting && c.onStripe == nil {
+		return errStateMismatch
+	}
+	c.pauseStep = int(r.int())
+	c.processing = CodecStatus(r.int())
+	c.stage = ErrorStage(r.int())
+	c.trace = segmentTrace{headerSize: r.uint(), elapsed: time.Duration(r.int())}
+	allocated, symbolBytes, segments := r.uint(), r.uint(), uint32(r.uint())
+	pageCharged, segmentMark := r.uint(), r.uint()
+	if c.budget != nil {
+		c.budget.allocated = allocated
+		c.budget.symbolBytes = symbolBytes
+		c.budget.segments = segments
+		c.pageCharged = pageCharged
+		c.segmentMark = segmentMark
+	}
+
+	c.pageInfos = nil
+	for n := r.count(); n > 0; n-- {
+		c.pageInfos = append(c.pageInfos, r.pageInfo())
+	}
+	c.page = r.image()
+	c.bufSpecified = false
+	c.colourPage = r.rgba()
+	c.pageClip = r.optRect()
+	c.pageCrop = r.optRect()
+	c.profiles = nil
+	for n := r.count(); n > 0; n-- {
+		c.profiles = append(c.profiles, uint32(r.uint()))
+	}
+	c.comments = nil
+	for n := r.count(); n > 0; n-- {
+		c.comments = append(c.comments, Comment{
+			Segment: uint32(r.uint()),
+			Page:    uint32(r.uint()),
+			Name:    r.string(),
+			Value:   r.string(),
+		})
+	}
+	c.damage = nil
+	for n := r.count(); n > 0; n-- {
+		c.damage = append(c.damage, Damage{
+			Segment: uint32(r.uint()),
+			Type:    uint8(r.uint()),
+			Page:    uint32(r.uint()),
+			Rect:    r.rect(),
+			Err:     r.error(),
+		})
+	}
+
+	c.segments = nil
+	for n := r.count(); n > 0; n-- {
+		c.segments = append(c.segments, r.segment())
+	}
+	c.headerTable = nil
+	for n := r.count(); n > 0; n-- {
+		c.headerTable = append(c.headerTable, r.segment())
+	}
+	c.currentSegment = nil
+	if r.bool() {
+		c.currentSegment = r.segment()
+	}
+
+	c.ri = r.regionInfo()
+	c.grdProc = nil
+	if r.bool() {
+		p := NewGRDProc()
+		p.MMR = r.bool()
+		p.TPGDON = r.bool()
+		p.UseSkip = r.bool()
+		p.GBTemplate = uint8(r.uint())
+		p.GBWidth = uint32(r.uint())
+		p.GBHeight = uint32(r.uint())
+		p.Skip = r.image()
+		for i := range p.GBAt {
+			p.GBAt[i] = int32(r.int())
+		}
+		p.replaceRect = r.rect()
+		p.progressiveStatus = CodecStatus(r.int())
+		p.decodeType = int(r.int())
+		p.loopIndex = int(r.int())
+		p.ltp = int(r.int())
+		c.grdProc = p
+	}
+	c.gbContexts = r.contexts()
+	c.grContexts = r.contexts()
+	c.arithDecoder = nil
+	if r.bool() {
+		c.arithDecoder = &ArithDecoder{
+			stream:   c.stream,
+			complete: r.bool(),
+			state:    arithStreamState(r.uint()),
+			b:        uint8(r.uint()),
+			c:        uint32(r.uint()),
+			a:        uint32(r.uint()),
+			ct:       uint32(r.uint()),
+		}
+	}
+	if r.err != nil {
+		return r.err
+	}
+	if len(r.buf) != 0 || !c.validState() {
+		return errInvalidState
+	}
+	return nil
+}
+
+// validState checks the restored positions that the decoding loops rely on
+// without further bounds checks.
+func (c *Context) validState() bool {
+	if uint64(c.offset) > uint64(len(c.stream.Buf())) {
+		return false
+	}
+	p := c.grdProc
+	if p == nil {
+		return true
+	}
+	if c.currentSegment == nil || p.GBTemplate > 3 || p.loopIndex < 0 || p.loopIndex > int(p.GBHeight) {
+		return false
+	}
+	if img := c.currentSegment.Image; img != nil && (img.width != int(p.GBWidth) || img.height != int(p.GBHeight)) {
+		return false
+	}
+	return len(c.gbContexts) == 0 || len(c.gbContexts) == huffContextSize(p.GBTemplate)
+}
+
+// dataHash fingerprints the data a state belongs to.
+func dataHash(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// stateWriter appends the fields of a decoder state to buf.
+type stateWriter struct {
+	buf []byte
+}
+
+func (w *stateWriter) uint(v uint64) { w.buf = binary.AppendUvarint(w.buf, v) }
+
+func (w *stateWriter) int(v int64) { w.buf = binary.AppendVarint(w.buf, v) }
+
+func (w *stateWriter) bool(v bool) {
+	if v {
+		w.buf = append(w.buf, 1)
+	} else {
+		w.buf = append(w.buf, 0)
+	}
+}
+
+func (w *stateWriter) bytes(b []byte) {
+	w.uint(uint64(len(b)))
+	w.buf = append(w.buf, b...)
+}
+
+func (w *stateWriter) string(s string) { w.bytes([]byte(s)) }
+
+func (w *stateWriter) rect(r Rect) {
+	w.int(int64(r.Left))
+	w.int(int64(r.Top))
+	w.int(int64(r.Right))
+	w.int(int64(r.Bottom))
+}
+
+func (w *stateWriter) optRect(r *Rect) {
+	w.bool(r != nil)
+	if r != nil {
+		w.rect(*r)
+	}
+}
+
+// error writes the DecodeError fields of err, if it is one, its sentinel
+// kind and the message of the error underneath, so that the reader can
+// rebuild an error matching the same errors.Is and errors.As targets.
+func (w *stateWriter) error(err error) {
+	var de *DecodeError
+	w.bool(errors.As(err, &de))
+	if de != nil {
+		w.uint(uint64(de.Segment))
+		w.uint(uint64(de.Type))
+		w.uint(uint64(de.Page))
+		w.uint(de.Offset)
+		w.int(int64(de.Stage))
+		err = de.Err
+	}
+	kind := 0
+	for i, k := range errorKinds {
+		if errors.Is(err, k) {
+			kind = i + 1
+			break
+		}
+	}
+	w.uint(uint64(kind))
+	w.string(err.Error())
+}
+
+// image writes the dimensions of img followed by its rows without padding.
+func (w *stateWriter) image(img *Image) {
+	w.bool(img != nil)
+	if img == nil {
+		return
+	}
+	w.uint(uint64(img.width))
+	w.uint(uint64(img.height))
+	w.bool(img.data != nil)
+	if img.data == nil {
+		return
+	}
+	rowBytes := (img.width + 7) / 8
+	for y := 0; y < img.height; y++ {
+		w.buf = append(w.buf, img.lineUnsafe(y)[:rowBytes]...)
+	}
+}
+
+func (w *stateWriter) rgba(img *image.RGBA) {
+	w.bool(img != nil)
+	if img == nil {
+		return
+	}
+	w.rect(Rect{Left: img.Rect.Min.X, Top: img.Rect.Min.Y, Right: img.Rect.Max.X, Bottom: img.Rect.Max.Y})
+	w.bytes(img.Pix)
+}
+
+// contexts writes each context as one byte: the MPS in the top bit and the
+// state index below it.
+func (w *stateWriter) contexts(ctx []ArithContext) {
+	w.uint(uint64(len(ctx)))
+	for _, cx := range ctx {
+		b := cx.i
+		if cx.mps {
+			b |= 0x80
+		}
+		w.buf = append(w.buf, b)
+	}
+}
+
+func (w *stateWriter) pageInfo(info *PageInfo) {
+	w.uint(uint64(info.Number))
+	w.uint(uint64(info.Width))
+	w.uint(uint64(info.Height))
+	w.uint(uint64(info.ResolutionX))
+	w.uint(uint64(info.ResolutionY))
+	w.bool(info.DefaultPixelValue)
+	w.bool(info.Striped)
+	w.uint(uint64(info.MaxStripeSize))
+	w.bool(info.EventuallyLossless)
+	w.bool(info.MightContainRefinements)
+	w.uint(uint64(info.DefaultCombOp))
+	w.bool(info.RequiresAuxiliaryBuffers)
+	w.bool(info.CombOpOverridden)
+	w.bool(info.ColourExtension)
+}
+
+func (w *stateWriter) regionInfo(ri RegionInfo) {
+	w.int(int64(ri.Width))
+	w.int(int64(ri.Height))
+	w.int(int64(ri.X))
+	w.int(int64(ri.Y))
+	w.uint(uint64(ri.Flags))
+	w.bool(ri.Colour)
+	w.uint(uint64(ri.Foreground))
+	w.uint(uint64(ri.Background))
+}
+
+func (w *stateWriter) segment(seg *Segment) {
+	w.uint(uint64(seg.Number))
+	w.uint(uint64(seg.Flags))
+	w.uint(uint64(len(seg.ReferredToSegmentNumbers)))
+	for _, ref := range seg.ReferredToSegmentNumbers {
+		w.uint(uint64(ref))
+	}
+	w.uint(uint64(seg.PageAssociation))
+	w.uint(uint64(seg.DataLength))
+	w.uint(uint64(seg.HeaderLength))
+	w.uint(uint64(seg.DataOffset))
+	w.uint(seg.Key)
+	w.int(int64(seg.State))
+	w.int(int64(seg.ResultType))
+	w.bool(seg.RetainThis)
+	w.uint(uint64(len(seg.RetainReferred)))
+	for _, retain := range seg.RetainReferred {
+		w.bool(retain)
+	}
+	w.bool(seg.released)
+	w.uint(seg.charged)
+
+	w.bool(seg.SymbolDict != nil)
+	if sd := seg.SymbolDict; sd != nil {
+		w.uint(uint64(len(sd.symbols)))
+		for _, sym := range sd.symbols {
+			w.image(sym)
+		}
+		w.contexts(sd.gbContexts)
+		w.contexts(sd.grContexts)
+	}
+	w.bool(seg.PatternDict != nil)
+	if pd := seg.PatternDict; pd != nil {
+		w.uint(uint64(pd.NumPatterns))
+		w.uint(uint64(len(pd.Patterns)))
+		for _, pat := range pd.Patterns {
+			w.image(pat)
+		}
+	}
+	w.image(seg.Image)
+	w.bool(seg.HuffmanTable != nil)
+	if ht := seg.HuffmanTable; ht != nil {
+		w.bool(ht.hasOOB)
+		w.uint(uint64(len(ht.codes)))
+		for i, code := range ht.codes {
+			w.int(int64(code.CodeLength))
+			w.int(int64(code.Code))
+			w.int(int64(ht.rangeLen[i]))
+			w.int(int64(ht.rangeLow[i]))
+		}
+	}
+	w.uint(uint64(len(seg.Palette)))
+	for _, p := range seg.Palette {
+		w.buf = append(w.buf, p.R, p.G, p.B, p.A)
+	}
+}
+
+// stateReader reads the fields written by stateWriter. The first error
+// sticks: later reads return zero values.
+type stateReader struct {
+	buf []byte
+	err error
+}
+
+func (r *stateReader) fail() {
+	if r.err == nil {
+		r.err = errInvalidState
+	}
+	r.buf = nil
+}
+
+func (r *stateReader) uint() uint64 {
+	v, n := binary.Uvarint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *stateReader) int() int64 {
+	v, n := binary.Varint(r.buf)
+	if n <= 0 {
+		r.fail()
+		return 0
+	}
+	r.buf = r.buf[n:]
+	return v
+}
+
+func (r *stateReader) bool() bool {
+	b := r.next(1)
+	return b != nil && b[0] != 0
+}
+
+// next consumes n bytes.
+func (r *stateReader) next(n uint64) []byte {
+	if n > uint64(len(r.buf)) {
+		r.fail()
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+// count reads an element count. Every element takes at least one byte, so
+// counts beyond the remaining input are rejected before anything is
+// allocated for them.
+func (r *stateReader) count() int {
+	n := r.uint()
+	if n > uint64(len(r.buf)) {
+		r.fail()
+		return 0
+	}
+	return int(n)
+}
+
+func (r *stateReader) bytes() []byte {
+	b := r.next(r.uint())
+	if b == nil {
+		return nil
+	}
+	return append([]byte(nil), b...)
+}
+
+func (r *stateReader) string() string { return string(r.bytes()) }
+
+func (r *stateReader) rect() Rect {
+	return Rect{Left: int(r.int()), Top: int(r.int()), Right: int(r.int()), Bottom: int(r.int())}
+}
+
+func (r *stateReader) error() error {
+	var de *DecodeError
+	if r.bool() {
+		de = &DecodeError{
+			Segment: uint32(r.uint()),
+			Type:    uint8(r.uint()),
+			Page:    uint32(r.uint()),
+			Offset:  r.uint(),
+			Stage:   ErrorStage(r.int()),
+		}
+	}
+	kind := r.uint()
+	err := errors.New(r.string())
+	if kind > uint64(len(errorKinds)) {
+		r.fail()
+	} else if kind > 0 {
+		err = withKind(errorKinds[kind-1], err)
+	}
+	if de == nil {
+		return err
+	}
+	de.Err = err
+	return de
+}
+
+func (r *stateReader) optRect() *Rect {
+	if !r.bool() {
+		return nil
+	}
+	rect := r.rect()
+	return &rect
+}
+
+func (r *stateReader) image() *Image {
+	if !r.bool() {
+		return nil
+	}
+	w, h := r.uint(), r.uint()
+	if !r.bool() {
+		if w > uint64(maxImagePixels) || h > uint64(maxImagePixels) {
+			r.fail()
+		}
+		return &Image{width: int(w), height: int(h)}
+	}
+	if w > uint64(maxImagePixels) || h > uint64(maxImagePixels) || !IsValidImageSize(int32(w), int32(h)) ||
+		(w+7)/8*h > uint64(len(r.buf)) {
+		r.fail()
+		return nil
+	}
+	img := NewImage(int32(w), int32(h))
+	if img.data == nil {
+		r.fail()
+		return nil
+	}
+	rowBytes := uint64((img.width + 7) / 8)
+	for y := 0; y < img.height; y++ {
+		copy(img.lineUnsafe(y), r.next(rowBytes))
+	}
+	return img
+}
+
+func (r *stateReader) rgba() *image.RGBA {
+	if !r.bool() {
+		return nil
+	}
+	rect := r.rect()
+	bounds := image.Rect(rect.Left, rect.Top, rect.Right, rect.Bottom)
+	pix := r.bytes()
+	if r.err != nil || uint64(len(pix)) != 4*uint64(bounds.Dx())*uint64(bounds.Dy()) {
+		r.fail()
+		return nil
+	}
+	return &image.RGBA{Pix: pix, Stride: 4 * bounds.Dx(), Rect: bounds}
+}
+
+func (r *stateReader) contexts() []ArithContext {
+	n := r.count()
+	if n == 0 {
+		return nil
+	}
+	ctx := make([]ArithContext, n)
+	for i, b := range r.next(uint64(n)) {
+		if int(b&0x7f) >= len(arithQeTable) {
+			r.fail()
+			return nil
+		}
+		ctx[i] = ArithContext{mps: b&0x80 != 0, i: b & 0x7f}
+	}
+	return ctx
+}
+
+func (r *stateReader) pageInfo() *PageInfo {
+	return &PageInfo{
+		Number:                   uint32(r.uint()),
+		Width:                    uint32(r.uint()),
+		Height:                   uint32(r.uint()),
+		ResolutionX:              uint32(r.uint()),
+		ResolutionY:              uint32(r.uint()),
+		DefaultPixelValue:        r.bool(),
+		Striped:                  r.bool(),
+		MaxStripeSize:            uint16(r.uint()),
+		EventuallyLossless:       r.bool(),
+		MightContainRefinements:  r.bool(),
+		DefaultCombOp:            ComposeOp(r.uint()),
+		RequiresAuxiliaryBuffers: r.bool(),
+		CombOpOverridden:         r.bool(),
+		ColourExtension:          r.bool(),
+	}
+}
+
+func (r *stateReader) regionInfo() RegionInfo {
+	return RegionInfo{
+		Width:      int32(r.int()),
+		Height:     int32(r.int()),
+		X:          int32(r.int()),
+		Y:          int32(r.int()),
+		Flags:      uint8(r.uint()),
+		Colour:     r.bool(),
+		Foreground: uint16(r.uint()),
+		Background: uint16(r.uint()),
+	}
+}
+
+func (r *stateReader) segment() *Segment {
+	seg := NewSegment()
+	seg.Number = uint32(r.uint())
+	seg.Flags = SegmentFlags(r.uint())
+	if n := r.count(); n > 0 {
+		seg.ReferredToSegmentNumbers = make([]uint32, n)
+		for i := range seg.ReferredToSegmentNumbers {
+			seg.ReferredToSegmentNumbers[i] = uint32(r.uint())
+		}
+	}
+	seg.ReferredToSegmentCount = int32(len(seg.ReferredToSegmentNumbers))
+	seg.PageAssociation = uint32(r.uint())
+	seg.DataLength = uint32(r.uint())
+	seg.HeaderLength = uint32(r.uint())
+	seg.DataOffset = uint32(r.uint())
+	seg.Key = r.uint()
+	seg.State = SegmentState(r.int())
+	seg.ResultType = ResultType(r.int())
+	seg.RetainThis = r.bool()
+	if n := r.count(); n > 0 {
+		seg.RetainReferred = make([]bool, n)
+		for i := range seg.RetainReferred {
+			seg.RetainReferred[i] = r.bool()
+		}
+	}
+	seg.released = r.bool()
+	seg.charged = r.uint()
+
+	if r.bool() {
+		sd := NewSymbolDict()
+		for n := r.count(); n > 0; n-- {
+			sd.symbols = append(sd.symbols, r.image())
+		}
+		sd.gbContexts = r.contexts()
+		sd.grContexts = r.contexts()
+		seg.SymbolDict = sd
+	}
+	if r.bool() {
+		numPatterns := uint32(r.uint())
+		pd := &PatternDict{NumPatterns: numPatterns}
+		for n := r.count(); n > 0; n-- {
+			pd.Patterns = append(pd.Patterns, r.image())
+		}
+		seg.PatternDict = pd
+	}
+	seg.Image = r.image()
+	if r.bool() {
+		ht := &HuffmanTable{hasOOB: r.bool()}
+		for n := r.count(); n > 0; n-- {
+			ht.codes = append(ht.codes, HuffmanCode{CodeLength: int32(r.int()), Code: int32(r.int())})
+			ht.rangeLen = append(ht.rangeLen, int(r.int()))
+			ht.rangeLow = append(ht.rangeLow, int(r.int()))
+		}
+		seg.HuffmanTable = ht
+	}
+	if n := r.count(); n > 0 {
+		seg.Palette = make([]color.RGBA, n)
+		for i := range seg.Palette {
+			if b := r.next(4); b != nil {
+				seg.Palette[i] = color.RGBA{R: b[0], G: b[1], B: b[2], A: b[3]}
+			}
+		}
+	}
+	return seg
+}
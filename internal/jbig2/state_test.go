@@ -0,0 +1,178 @@
+package jbig2
+
+import (
+	"errors"
+	"testing"
+)
+
+// alwaysPause is a PauseIndicator that requests a pause at every chance.
+type alwaysPause struct{}
+
+func (alwaysPause) ShouldPause() bool { return true }
+
+// stateTestFile holds an intermediate region refined onto the page by a
+// later segment, so that its result has to survive a resume, followed by a
+// generic region decoded progressively.
+func stateTestFile() []byte {
+	coarse, fine := testPattern(8, 5, 2), testPattern(8, 5, 3)
+	return sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 24, 0x22, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegion, page: 1, data: genericRegionData(coarse, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeRefinementRegionImmediateLossless, page: 1, refs: []uint32{1}, data: refinementRegionData(fine, coarse, 5, 2, 0)}),
+		buildSegment(testSegment{number: 3, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(16, 12, 4), 0, 10, 0)}),
+		buildSegment(testSegment{number: 4, typ: segmentTypeEndOfPage, page: 1}),
+		buildSegment(testSegment{number: 5, typ: segmentTypeEndOfFile}),
+	)
+}
+
+func TestDecoderResumeAfterEveryPause(t *testing.T) {
+	data := stateTestFile()
+	ref, err := NewDecoder(DecoderOptions{SrcData: data})
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	want, _, err := ref.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+
+	opts := DecoderOptions{SrcData: data, Pause: alwaysPause{}}
+	d, err := NewDecoder(opts)
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	if _, err := d.GetFirstPage(make([]byte, 4*24), 16, 24, 4); err != nil {
+		t.Fatalf("GetFirstPage returned error: %v", err)
+	}
+	resumes, midRegion := 0, false
+	for d.GetProcessingStatus() == CodecStatusToBeContinued {
+		midRegion = midRegion || d.ctx.grdProc != nil
+		state, err := d.MarshalState()
+		if err != nil {
+			t.Fatalf("MarshalState returned error: %v", err)
+		}
+		if d, err = ResumeDecoder(state, opts); err != nil {
+			t.Fatalf("ResumeDecoder returned error after %d resumes: %v", resumes, err)
+		}
+		resumes++
+		if _, err := d.Continue(); err != nil {
+			t.Fatalf("Continue returned error after %d resumes: %v", resumes, err)
+		}
+	}
+	if resumes < 12 || !midRegion {
+		t.Errorf("decode resumed %d times, mid-region %v; want a resume within every row", resumes, midRegion)
+	}
+	if got := d.GetProcessingStatus(); got != CodecStatusFinished {
+		t.Fatalf("final status %v, want finished", got)
+	}
+	if !sameBitmap(d.GetPageImage(), want) {
+		t.Error("resumed decode differs from an uninterrupted one")
+	}
+}
+
+func TestResumeDecoderRejectsOtherData(t *testing.T) {
+	data := stateTestFile()
+	opts := DecoderOptions{SrcData: data, Pause: alwaysPause{}}
+	d, err := NewDecoder(opts)
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	if _, err := d.GetFirstPage(make([]byte, 4*24), 16, 24, 4); err != nil {
+		t.Fatalf("GetFirstPage returned error: %v", err)
+	}
+	state, err := d.MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState returned error: %v", err)
+	}
+
+	other := append([]byte(nil), data...)
+	other[len(other)-20] ^= 0xff
+	if _, err := ResumeDecoder(state, DecoderOptions{SrcData: other}); !errors.Is(err, errStateMismatch) {
+		t.Errorf("resume with other data returned %v, want a mismatch", err)
+	}
+	if _, err := ResumeDecoder(state, DecoderOptions{SrcData: data, GlobalData: data}); !errors.Is(err, errStateMismatch) {
+		t.Errorf("resume with added global data returned %v, want a mismatch", err)
+	}
+	for _, n := range []int{0, 3, len(state) / 2, len(state) - 1} {
+		if _, err := ResumeDecoder(state[:n], opts); err == nil {
+			t.Errorf("resume from %d of %d state bytes succeeded", n, len(state))
+		}
+	}
+}
+
+func TestResumeDecoderKeepsDamageErrors(t *testing.T) {
+	bad := genericRegionData(testPattern(8, 8, 1), 0, 0, 0)
+	bad[16] |= 0x07 // invalid combination operator
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 8, 0x40, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: bad}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(8, 8, 3), 8, 0, 0)}),
+		buildSegment(testSegment{number: 3, typ: segmentTypeEndOfPage, page: 1}),
+	)
+	opts := DecoderOptions{SrcData: data, Recover: true, Pause: alwaysPause{}}
+	d, err := NewDecoder(opts)
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	if _, err := d.GetFirstPage(make([]byte, 4*8), 16, 8, 4); err != nil {
+		t.Fatalf("GetFirstPage returned error: %v", err)
+	}
+	for len(d.Damage()) == 0 && d.GetProcessingStatus() == CodecStatusToBeContinued {
+		if _, err := d.Continue(); err != nil {
+			t.Fatalf("Continue returned error: %v", err)
+		}
+	}
+	if len(d.Damage()) != 1 {
+		t.Fatalf("got %d damage records before resuming, want 1", len(d.Damage()))
+	}
+	want := d.Damage()[0].Err
+	state, err := d.MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState returned error: %v", err)
+	}
+	if d, err = ResumeDecoder(state, opts); err != nil {
+		t.Fatalf("ResumeDecoder returned error: %v", err)
+	}
+
+	got := d.Damage()[0].Err
+	var wantDE, gotDE *DecodeError
+	if !errors.As(want, &wantDE) || !errors.As(got, &gotDE) {
+		t.Fatalf("damage error %v resumed as %v, want a *DecodeError", want, got)
+	}
+	if gotDE.Segment != wantDE.Segment || gotDE.Type != wantDE.Type || gotDE.Page != wantDE.Page ||
+		gotDE.Offset != wantDE.Offset || gotDE.Stage != wantDE.Stage || got.Error() != want.Error() {
+		t.Errorf("damage error resumed as %#v, want %#v", gotDE, wantDE)
+	}
+	if errorKind(want) == nil || errorKind(got) != errorKind(want) {
+		t.Errorf("damage error resumed with kind %v, want %v", errorKind(got), errorKind(want))
+	}
+}
+
+func TestResumeDecoderRequiresStripeCallback(t *testing.T) {
+	onStripe := func(StripeUpdate) error { return nil }
+	opts := DecoderOptions{SrcData: stripedTestFile(38), OnStripe: onStripe}
+	d, err := NewDecoder(opts)
+	if err != nil {
+		t.Fatalf("NewDecoder returned error: %v", err)
+	}
+	// Step through the page until it is being emitted stripe by stripe.
+	for !d.ctx.emitting {
+		if _, err := d.ctx.DecodeSequential(alwaysPause{}); err != nil {
+			t.Fatalf("DecodeSequential returned error: %v", err)
+		}
+	}
+	state, err := d.MarshalState()
+	if err != nil {
+		t.Fatalf("MarshalState returned error: %v", err)
+	}
+
+	if _, err := ResumeDecoder(state, DecoderOptions{SrcData: opts.SrcData}); !errors.Is(err, errStateMismatch) {
+		t.Errorf("resume of an emitting page without OnStripe returned %v, want a mismatch", err)
+	}
+	if d, err = ResumeDecoder(state, opts); err != nil {
+		t.Fatalf("ResumeDecoder returned error: %v", err)
+	}
+	if _, _, err := d.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+}
@@ -0,0 +1,230 @@
+package jbig2
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"io"
+)
+
+const streamReadSize = 32 * 1024
+
+// StreamDecoder decodes pages from a JBIG2 stream as its bytes arrive from an
+// io.Reader. Sequential streams are parsed segment by segment; random-access
+// files place every header before the data and are buffered until the reader
+// reports io.EOF. At most Limits.MaxBufferBytes are held for data that has
+// not arrived in full.
+type StreamDecoder struct {
+	r       io.Reader
+	opts    DecoderOptions
+	ctx     *Context
+	header  []byte // bytes read before the context exists
+	eof     bool
+	cancel  CancelIndicator
+	globals *Globals
+}
+
+// NewStreamDecoder creates a decoder that reads the stream from r. SrcData
+// in opts is ignored; GlobalData and Globals are used as for NewDecoder, and
+// their errors surface from the first NextPage.
+func NewStreamDecoder(r io.Reader, opts DecoderOptions) *StreamDecoder {
+	return &StreamDecoder{r: r, opts: opts}
+}
+
+// Close releases the reference the decoder holds to shared Globals; see
+// Decoder.Close.
+func (d *StreamDecoder) Close() {
+	if d.globals != nil {
+		d.globals.Release()
+		d.globals = nil
+	}
+}
+
+// bufferLimit returns the bound on bytes held for incomplete data.
+func (d *StreamDecoder) bufferLimit() uint64 {
+	if n := d.opts.Limits.MaxBufferBytes; n != 0 {
+		return n
+	}
+	return DefaultMaxBufferBytes
+}
+
+// NextPage returns the next complete page, reading from the underlying reader
+// as needed. Reads block as the reader does; a reader that returns no bytes
+// and no error makes NextPage return ErrNeedMoreData, after which it may be
+// called again once more data is available. io.EOF is returned once the
+// stream holds no further pages.
+func (d *StreamDecoder) NextPage() (*Image, *PageInfo, error) {
+	for d.ctx == nil {
+		ready, err := d.start()
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ready {
+			if err := d.fill(); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+	d.ctx.SetCancel(d.cancel)
+	defer d.ctx.SetCancel(nil)
+	if err := d.ctx.decodeGlobals(nil); err != nil {
+		return nil, nil, err
+	}
+	for {
+		img, info, err := d.ctx.NextPage()
+		if err != ErrNeedMoreData {
+			return img, info, err
+		}
+		if err := d.fill(); err != nil {
+			return nil, nil, err
+		}
+	}
+}
+
+// NextPageContext is like NextPage but stops once ctx is done, with an error
+// satisfying errors.Is(err, ctx.Err()); see Decoder.DecodeAllContext.
+// Cancellation is checked between reads and while decoding; a Read that is
+// already blocked is not interrupted.
+func (d *StreamDecoder) NextPageContext(ctx context.Context) (*Image, *PageInfo, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+	d.cancel = ctx
+	defer func() { d.cancel = nil }()
+	return d.NextPage()
+}
+
+// FileHeader returns the parsed file header. It is nil until the header has
+// been read, and for streams that have none.
+func (d *StreamDecoder) FileHeader() *FileHeader {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.FileHeader()
+}
+
+// ColourPage returns the colour rendering of the most recent page, or nil
+// for a bilevel page.
+func (d *StreamDecoder) ColourPage() *image.RGBA {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.ColourPage()
+}
+
+// Damage returns the region segments skipped so far in recovery mode.
+func (d *StreamDecoder) Damage() []Damage {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Damage()
+}
+
+// Comments returns the comment extensions decoded so far.
+func (d *StreamDecoder) Comments() []Comment {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Comments()
+}
+
+// Profiles returns the profiles declared by the stream so far.
+func (d *StreamDecoder) Profiles() []uint32 {
+	if d.ctx == nil {
+		return nil
+	}
+	return d.ctx.Profiles()
+}
+
+// LiveBytes returns the bitmap storage the decoder currently holds.
+func (d *StreamDecoder) LiveBytes() uint64 {
+	if d.ctx == nil {
+		return 0
+	}
+	return d.ctx.LiveBytes()
+}
+
+// start creates the decoding context once the file header, if any, has been
+// read. It reports false while more bytes are required.
+func (d *StreamDecoder) start() (bool, error) {
+	sigLen := len(jbig2FileSignature)
+	if !d.eof && len(d.header) < sigLen && bytes.HasPrefix(jbig2FileSignature, d.header) {
+		return false, nil
+	}
+	sequential := true
+	if bytes.HasPrefix(d.header, jbig2FileSignature) {
+		need := sigLen + 1
+		if len(d.header) > sigLen && d.header[sigLen]&0x02 == 0 {
+			need += 4
+		}
+		if !d.eof && len(d.header) < need {
+			return false, nil
+		}
+		sequential = len(d.header) > sigLen && d.header[sigLen]&0x01 != 0
+	}
+	if !sequential && !d.eof {
+		return false, nil
+	}
+	if d.eof && len(d.header) == 0 {
+		return false, errors.New("jbig2: empty source data")
+	}
+	if d.opts.Globals != nil && len(d.opts.GlobalData) > 0 {
+		return false, errors.New("jbig2: both GlobalData and Globals are set")
+	}
+	ctx, err := CreateContext(d.opts.GlobalData, d.opts.GlobalKey, d.header, d.opts.SrcKey, d.opts.documentContext())
+	if err != nil {
+		return false, err
+	}
+	d.opts.apply(ctx)
+	if d.opts.Globals != nil {
+		if err := d.opts.Globals.Acquire(); err != nil {
+			return false, err
+		}
+		if err := ctx.UseGlobals(d.opts.Globals); err != nil {
+			d.opts.Globals.Release()
+			return false, err
+		}
+		d.globals = d.opts.Globals
+	}
+	ctx.SetBufferLimit(d.bufferLimit())
+	ctx.SetAwaitingData(!d.eof)
+	d.ctx = ctx
+	d.header = nil
+	return true, nil
+}
+
+// fill performs a single read and hands the bytes to the context, or keeps
+// them until the context has been created.
+func (d *StreamDecoder) fill() error {
+	if d.eof {
+		return withKind(ErrTruncated, io.ErrUnexpectedEOF)
+	}
+	if err := checkCancel(d.cancel); err != nil {
+		return err
+	}
+	buf := make([]byte, streamReadSize)
+	n, err := d.r.Read(buf)
+	if n > 0 {
+		if d.ctx == nil {
+			d.header = append(d.header, buf[:n]...)
+			if limit := d.bufferLimit(); uint64(len(d.header)) > limit {
+				return limitError("buffering %d bytes before decoding exceeds %d bytes", len(d.header), limit)
+			}
+		} else {
+			d.ctx.AppendData(buf[:n])
+		}
+	}
+	switch {
+	case err == io.EOF:
+		d.eof = true
+		if d.ctx != nil {
+			d.ctx.SetAwaitingData(false)
+		}
+	case err != nil:
+		return err
+	case n == 0:
+		return ErrNeedMoreData
+	}
+	return nil
+}
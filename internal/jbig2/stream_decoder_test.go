@@ -0,0 +1,200 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+// chunkReader hands out queued chunks one Read at a time and reports no data,
+// without an error, while the queue is empty.
+type chunkReader struct {
+	chunks [][]byte
+	closed bool
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	if len(r.chunks) == 0 {
+		if r.closed {
+			return 0, io.EOF
+		}
+		return 0, nil
+	}
+	n := copy(p, r.chunks[0])
+	r.chunks[0] = r.chunks[0][n:]
+	if len(r.chunks[0]) == 0 {
+		r.chunks = r.chunks[1:]
+	}
+	return n, nil
+}
+
+func sequentialFile(segments ...[]byte) []byte {
+	data := append([]byte{}, jbig2FileSignature...)
+	data = append(data, 0x03)
+	for _, seg := range segments {
+		data = append(data, seg...)
+	}
+	return data
+}
+
+func TestStreamDecoderOneByteReads(t *testing.T) {
+	first := testPattern(16, 6, 0)
+	second := testPattern(9, 13, 4)
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(16, 6, 0, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(first, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+		buildSegment(testSegment{number: 3, typ: segmentTypePageInfo, page: 2, data: pageInfoData(9, 13, 0, 0)}),
+		buildSegment(testSegment{number: 4, typ: segmentTypeGenericRegionImmediateLossless, page: 2, data: genericRegionData(second, 0, 0, 0)}),
+		buildSegment(testSegment{number: 5, typ: segmentTypeEndOfPage, page: 2}),
+		buildSegment(testSegment{number: 6, typ: segmentTypeEndOfFile}),
+	)
+
+	dec := NewStreamDecoder(iotest.OneByteReader(&chunkReader{chunks: [][]byte{data}, closed: true}), DecoderOptions{})
+	for i, want := range []*Image{first, second} {
+		page, info, err := dec.NextPage()
+		if err != nil {
+			t.Fatalf("page %d: NextPage returned error: %v", i+1, err)
+		}
+		if info.Number != uint32(i+1) || !sameBitmap(page, want) {
+			t.Fatalf("page %d mismatch", i+1)
+		}
+	}
+	if _, _, err := dec.NextPage(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestStreamDecoderNeedMoreData(t *testing.T) {
+	region := testPattern(12, 7, 2)
+	pageOne := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(12, 7, 0, 0)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(region, 0, 0, 0)}),
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+	)
+	pageTwo := buildSegment(testSegment{number: 3, typ: segmentTypePageInfo, page: 2, data: pageInfoData(5, 5, 0x04, 0)})
+	pageTwo = append(pageTwo, buildSegment(testSegment{number: 4, typ: segmentTypeEndOfPage, page: 2})...)
+
+	r := &chunkReader{}
+	dec := NewStreamDecoder(r, DecoderOptions{})
+	if _, _, err := dec.NextPage(); err != ErrNeedMoreData {
+		t.Fatalf("expected ErrNeedMoreData before any data, got %v", err)
+	}
+
+	split := len(pageOne) - 20
+	r.chunks = append(r.chunks, pageOne[:split])
+	if _, _, err := dec.NextPage(); err != ErrNeedMoreData {
+		t.Fatalf("expected ErrNeedMoreData mid-segment, got %v", err)
+	}
+	r.chunks = append(r.chunks, pageOne[split:])
+	page, _, err := dec.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if !sameBitmap(page, region) {
+		t.Fatal("first page mismatch")
+	}
+
+	r.chunks = append(r.chunks, pageTwo)
+	r.closed = true
+	page, info, err := dec.NextPage()
+	if err != nil {
+		t.Fatalf("second NextPage returned error: %v", err)
+	}
+	if info.Number != 2 || page.GetPixel(4, 4) != 1 {
+		t.Fatal("second page mismatch")
+	}
+	if _, _, err := dec.NextPage(); err != io.EOF {
+		t.Fatalf("expected io.EOF, got %v", err)
+	}
+}
+
+func TestStreamDecoderUnknownLengthRegion(t *testing.T) {
+	region := testPattern(10, 4, 3)
+	header := buildSegmentHeader(testSegment{number: 1, typ: segmentTypeGenericRegionImmediate, page: 1})
+	binary.BigEndian.PutUint32(header[len(header)-4:], 0xffffffff)
+	segment := append(header, genericRegionData(region, 0, 0, 0)...)
+	segment = binary.BigEndian.AppendUint32(segment, uint32(region.Height()))
+	data := sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(10, 4, 0, 0)}),
+		segment,
+		buildSegment(testSegment{number: 2, typ: segmentTypeEndOfPage, page: 1}),
+	)
+
+	dec := NewStreamDecoder(iotest.OneByteReader(&chunkReader{chunks: [][]byte{data}, closed: true}), DecoderOptions{})
+	page, _, err := dec.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if !sameBitmap(page, region) {
+		t.Fatal("page mismatch")
+	}
+}
+
+func TestStreamDecoderRandomAccessFile(t *testing.T) {
+	region := testPattern(12, 5, 1)
+	segments := []testSegment{
+		{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(12, 5, 0, 0)},
+		{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(region, 0, 0, 0)},
+		{number: 2, typ: segmentTypeEndOfPage, page: 1},
+		{number: 3, typ: segmentTypeEndOfFile},
+	}
+	data := append([]byte{}, jbig2FileSignature...)
+	data = append(data, 0x02)
+	for _, seg := range segments {
+		data = append(data, buildSegmentHeader(seg)...)
+	}
+	for _, seg := range segments {
+		data = append(data, seg.data...)
+	}
+
+	dec := NewStreamDecoder(iotest.HalfReader(&chunkReader{chunks: [][]byte{data}, closed: true}), DecoderOptions{})
+	page, _, err := dec.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if !sameBitmap(page, region) {
+		t.Fatal("page mismatch")
+	}
+}
+
+func TestStreamDecoderBufferLimit(t *testing.T) {
+	pageInfo := buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(10, 4, 0, 0)})
+	opts := DecoderOptions{Limits: Limits{MaxBufferBytes: 4096}}
+
+	// A declared length over the limit fails before any data is read.
+	header := buildSegmentHeader(testSegment{number: 1, typ: segmentTypeGenericRegionImmediate, page: 1})
+	binary.BigEndian.PutUint32(header[len(header)-4:], 1<<30)
+	dec := NewStreamDecoder(&chunkReader{chunks: [][]byte{sequentialFile(pageInfo, header)}}, opts)
+	if _, _, err := dec.NextPage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("bogus data length returned %v, want ErrLimitExceeded", err)
+	}
+
+	// Data of unknown length is searched incrementally up to the limit.
+	header = buildSegmentHeader(testSegment{number: 1, typ: segmentTypeGenericRegionImmediate, page: 1})
+	binary.BigEndian.PutUint32(header[len(header)-4:], 0xffffffff)
+	segment := append(header, genericRegionData(testPattern(10, 4, 3), 0, 0, 0)...)
+	segment = segment[:len(segment)-2] // drop the end marker
+	r := &chunkReader{chunks: [][]byte{sequentialFile(pageInfo, segment)}}
+	dec = NewStreamDecoder(r, opts)
+	if _, _, err := dec.NextPage(); err != ErrNeedMoreData {
+		t.Fatalf("partial region returned %v, want ErrNeedMoreData", err)
+	}
+	if dec.ctx.pending.scanned == 0 {
+		t.Error("scan position not remembered between reads")
+	}
+	r.chunks = append(r.chunks, make([]byte, 4096))
+	if _, _, err := dec.NextPage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("unterminated region returned %v, want ErrLimitExceeded", err)
+	}
+
+	// Random-access files are buffered whole, within the same limit.
+	data := append(append([]byte{}, jbig2FileSignature...), 0x02)
+	data = append(data, make([]byte, 8192)...)
+	dec = NewStreamDecoder(&chunkReader{chunks: [][]byte{data}}, opts)
+	if _, _, err := dec.NextPage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("buffering a random-access file returned %v, want ErrLimitExceeded", err)
+	}
+}
@@ -0,0 +1,108 @@
+package jbig2
+
+import "errors"
+
+// StripeUpdate hands over the finished rows of a striped page in emitting
+// mode.
+type StripeUpdate struct {
+	Page *PageInfo
+	// Top is the page row of the first row of Rows.
+	Top int
+	// Rows holds the finished rows. The receiver owns the bitmap.
+	Rows *Image
+}
+
+// SetOnStripe enables emitting mode for striped pages. At each end-of-stripe
+// segment the rows above the stripe boundary are passed to fn and released,
+// so the page is held in a window of roughly one stripe instead of in full.
+// The image returned for such a page is empty. An error returned by fn stops
+// decoding. Passing nil restores whole-page decoding.
+func (c *Context) SetOnStripe(fn func(StripeUpdate) error) {
+	c.onStripe = fn
+}
+
+// startEmitting sets up the page window of a striped page in emitting mode
+// and reports whether emitting applies to the page.
+func (c *Context) startEmitting(info *PageInfo) bool {
+	c.emitting = c.onStripe != nil && info.ShouldTreatAsStriped()
+	if !c.emitting {
+		return false
+	}
+	height := max(int(info.MaxStripeSize), 1)
+	if info.Height != unboundedPageHeight {
+		height = min(height, int(info.Height))
+	}
+	c.pageClip = &Rect{Right: int(info.Width), Bottom: height}
+	return true
+}
+
+// emitRows hands the rows of the page above end, in page coordinates, to
+// the stripe callback and drops them from the page window.
+func (c *Context) emitRows(end int) error {
+	info := c.latestPageInfo()
+	if info == nil || c.page == nil {
+		return errors.New("jbig2: end of stripe outside page context")
+	}
+	if info.Height != unboundedPageHeight {
+		end = min(end, int(info.Height))
+	}
+	top := c.pageClip.Top
+	if end <= top {
+		return nil
+	}
+	if err := c.ensurePageHeight(end); err != nil {
+		return err
+	}
+	width, stride := c.page.Width(), c.page.Stride()
+	n := min(end-top, c.page.Height())
+	rows, err := NewImageFromBuffer(int32(width), int32(n), int32(stride), c.page.Data()[:n*stride])
+	if err != nil {
+		return err
+	}
+
+	windowHeight := max(max(c.page.Height()-n, int(info.MaxStripeSize)), 1)
+	if info.Height != unboundedPageHeight {
+		windowHeight = min(windowHeight, int(info.Height)-end)
+	}
+	c.releasePageCharge()
+	if err := c.budget.AllocateBitmap(uint64(width), uint64(windowHeight)); err != nil {
+		return err
+	}
+	c.chargedPage(bitmapBytes(uint64(width), uint64(windowHeight)))
+	next := NewImage(int32(width), int32(windowHeight))
+	next.Fill(info.DefaultPixelValue)
+	if next.data != nil {
+		copy(next.data, c.page.Data()[n*stride:])
+	}
+	c.page = next
+	c.pageClip.Top = top + n
+	c.pageClip.Bottom = c.pageClip.Top + windowHeight
+	return c.onStripe(StripeUpdate{Page: info, Top: top, Rows: rows})
+}
+
+// finishPage completes the current page and, when release is enabled, drops
+// the results of its segments. In emitting mode the rows of a page of known
+// height that have not been handed over yet are emitted; rows past the last
+// end-of-stripe segment of a page of unknown height are discarded.
+func (c *Context) finishPage() error {
+	c.inPage = false
+	c.pageReady = true
+	info := c.latestPageInfo()
+	if info != nil && c.release {
+		c.releasePage(info.Number)
+	}
+	if c.emitting {
+		c.emitting = false
+		if info != nil && info.Height != unboundedPageHeight {
+			if err := c.emitRows(int(info.Height)); err != nil {
+				return err
+			}
+		}
+		c.releasePageCharge()
+		c.page = NewImage(0, 0)
+	}
+	if c.observer != nil && info != nil {
+		c.observer.PageComplete(info)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+// stripedTestFile returns a striped 40-pixel-wide page of the given height
+// with stripes of at most 16 rows ending at rows 11, 27 and 37.
+func stripedTestFile(height uint32) []byte {
+	eos := func(number, row uint32) []byte {
+		return buildSegment(testSegment{number: number, typ: segmentTypeEndOfStripe, page: 1, data: binary.BigEndian.AppendUint32(nil, row)})
+	}
+	return sequentialFile(
+		buildSegment(testSegment{number: 0, typ: segmentTypePageInfo, page: 1, data: pageInfoData(40, height, 0x40, 0x8000|16)}),
+		buildSegment(testSegment{number: 1, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(40, 12, 1), 0, 0, 0)}),
+		eos(2, 11),
+		buildSegment(testSegment{number: 3, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(30, 16, 2), 5, 12, 0)}),
+		eos(4, 27),
+		buildSegment(testSegment{number: 5, typ: segmentTypeGenericRegionImmediateLossless, page: 1, data: genericRegionData(testPattern(40, 10, 3), 0, 28, 2)}),
+		eos(6, 37),
+		buildSegment(testSegment{number: 7, typ: segmentTypeEndOfPage, page: 1}),
+	)
+}
+
+func TestContextStripeEmitting(t *testing.T) {
+	for _, height := range []uint32{unboundedPageHeight, 38, 44} {
+		data := stripedTestFile(height)
+		full, err := CreateContext(nil, 0, data, 0, nil)
+		if err != nil {
+			t.Fatalf("CreateContext returned error: %v", err)
+		}
+		want, _, err := full.NextPage()
+		if err != nil {
+			t.Fatalf("%d: full decode returned error: %v", height, err)
+		}
+
+		ctx, err := CreateContext(nil, 0, data, 0, nil)
+		if err != nil {
+			t.Fatalf("CreateContext returned error: %v", err)
+		}
+		next := 0
+		ctx.SetOnStripe(func(u StripeUpdate) error {
+			if u.Top != next {
+				t.Errorf("%d: stripe starts at row %d, want %d", height, u.Top, next)
+			}
+			if !sameBitmap(u.Rows, want.SubImage(0, int32(u.Top), 40, int32(u.Rows.Height()))) {
+				t.Errorf("%d: rows %d-%d differ from the full page", height, u.Top, u.Top+u.Rows.Height())
+			}
+			if h := ctx.PageImage().Height(); h > 16 {
+				t.Errorf("%d: page window grew to %d rows", height, h)
+			}
+			next = u.Top + u.Rows.Height()
+			return nil
+		})
+		got, _, err := ctx.NextPage()
+		if err != nil {
+			t.Fatalf("%d: NextPage returned error: %v", height, err)
+		}
+		if got.Height() != 0 {
+			t.Errorf("%d: emitted page returned a %d-row image", height, got.Height())
+		}
+		if next != want.Height() {
+			t.Errorf("%d: emitted %d rows, want %d", height, next, want.Height())
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// testSegment describes a segment emitted by buildSegment.
+type testSegment struct {
+	number uint32
+	typ    uint8
+	page   uint32
+	refs   []uint32
+	retain uint8 // retention bits of the short referred-to segment form
+	data   []byte
+}
+
+// buildSegment serialises a segment header followed by its data.
+func buildSegment(seg testSegment) []byte {
+	return append(buildSegmentHeader(seg), seg.data...)
+}
+
+// buildSegmentHeader serialises a segment header using the short
+// referred-to segment form.
+func buildSegmentHeader(seg testSegment) []byte {
+	out := binary.BigEndian.AppendUint32(nil, seg.number)
+	flags := SegmentFlags(0).WithType(seg.typ)
+	if seg.page > 0xff {
+		flags = flags.WithLongPageAssociation(true)
+	}
+	out = append(out, flags.Raw(), byte(len(seg.refs))<<5|seg.retain&0x1f)
+	for _, ref := range seg.refs {
+		switch {
+		case seg.number > 65536:
+			out = binary.BigEndian.AppendUint32(out, ref)
+		case seg.number > 256:
+			out = binary.BigEndian.AppendUint16(out, uint16(ref))
+		default:
+			out = append(out, byte(ref))
+		}
+	}
+	if flags.HasLongPageAssociation() {
+		out = binary.BigEndian.AppendUint32(out, seg.page)
+	} else {
+		out = append(out, byte(seg.page))
+	}
+	return binary.BigEndian.AppendUint32(out, uint32(len(seg.data)))
+}
+
+// pageInfoData returns a page information segment payload.
+func pageInfoData(width, height uint32, flags uint8, striping uint16) []byte {
+	out := binary.BigEndian.AppendUint32(nil, width)
+	out = binary.BigEndian.AppendUint32(out, height)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = binary.BigEndian.AppendUint32(out, 0)
+	out = append(out, flags)
+	return binary.BigEndian.AppendUint16(out, striping)
+}
+
+// regionInfoData returns a region segment information field.
+func regionInfoData(width, height, x, y uint32, flags uint8) []byte {
+	out := binary.BigEndian.AppendUint32(nil, width)
+	out = binary.BigEndian.AppendUint32(out, height)
+	out = binary.BigEndian.AppendUint32(out, x)
+	out = binary.BigEndian.AppendUint32(out, y)
+	return append(out, flags)
+}
+
+// genericRegionData encodes img as an arithmetic generic region using
+// template 0 with the nominal AT pixels.
+func genericRegionData(img *Image, x, y uint32, combOp uint8) []byte {
+	out := regionInfoData(uint32(img.Width()), uint32(img.Height()), x, y, combOp)
+	out = append(out, 0x00)
+	out = append(out, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	return append(out, encodeGenericTemplate0(img)...)
+}
+
+// encodeGenericTemplate0 is the encoder counterpart of the template 0 generic
+// region decoder with nominal AT pixels and TPGDON disabled.
+func encodeGenericTemplate0(img *Image) []byte {
+	contexts := make([]ArithContext, huffContextSize(0))
+	enc := newTestArithEncoder()
+	for y := 0; y < img.Height(); y++ {
+		for x := 0; x < img.Width(); x++ {
+			px := func(dx, dy int) uint32 {
+				return uint32(img.GetPixel(int32(x+dx), int32(y+dy)))
+			}
+			ctx := px(-1, 0) | px(-2, 0)<<1 | px(-3, 0)<<2 | px(-4, 0)<<3
+			ctx |= px(3, -1) << 4
+			ctx |= px(2, -1)<<5 | px(1, -1)<<6 | px(0, -1)<<7 | px(-1, -1)<<8 | px(-2, -1)<<9
+			ctx |= px(-3, -1) << 10
+			ctx |= px(2, -2) << 11
+			ctx |= px(1, -2)<<12 | px(0, -2)<<13 | px(-1, -2)<<14
+			ctx |= px(-2, -2) << 15
+			enc.encode(&contexts[ctx], img.GetPixel(int32(x), int32(y)))
+		}
+	}
+	return enc.flush()
+}
+
+// refinementRegionData encodes img as an arithmetic refinement region of
+// reference using template 0 with AT pixels (-1, -1) and TPGRON disabled.
+func refinementRegionData(img, reference *Image, x, y uint32, combOp uint8) []byte {
+	out := regionInfoData(uint32(img.Width()), uint32(img.Height()), x, y, combOp)
+	out = append(out, 0x00, 0x00)
+	out = append(out, 0xff, 0xff, 0xff, 0xff)
+	return append(out, encodeRefinementTemplate0(img, reference)...)
+}
+
+// encodeRefinementTemplate0 is the encoder counterpart of the template 0
+// refinement decoder with AT pixels (-1, -1).
+func encodeRefinementTemplate0(img, reference *Image) []byte {
+	contexts := make([]ArithContext, refAggContextSize(false))
+	enc := newTestArithEncoder()
+	for y := 0; y < img.Height(); y++ {
+		for x := 0; x < img.Width(); x++ {
+			px := func(dx, dy int) uint32 {
+				return uint32(img.GetPixel(int32(x+dx), int32(y+dy)))
+			}
+			ref := func(dx, dy int) uint32 {
+				return uint32(reference.GetPixel(int32(x+dx), int32(y+dy)))
+			}
+			ctx := ref(1, 1) | ref(0, 1)<<1 | ref(-1, 1)<<2
+			ctx |= (ref(1, 0) | ref(0, 0)<<1 | ref(-1, 0)<<2) << 3
+			ctx |= (ref(1, -1) | ref(0, -1)<<1) << 6
+			ctx |= ref(-1, -1) << 8
+			ctx |= px(-1, 0) << 9
+			ctx |= (px(1, -1) | px(0, -1)<<1) << 10
+			ctx |= px(-1, -1) << 12
+			enc.encode(&contexts[ctx], img.GetPixel(int32(x), int32(y)))
+		}
+	}
+	return enc.flush()
+}
+
+// testArithEncoder is the MQ encoder from T.88 Annex E, used to build
+// arithmetic-coded fixtures.
+type testArithEncoder struct {
+	a   uint32
+	c   uint32
+	ct  int
+	out []byte // out[0] is the byte preceding the coded data
+}
+
+func newTestArithEncoder() *testArithEncoder {
+	return &testArithEncoder{a: 0x8000, ct: 12, out: []byte{0}}
+}
+
+func (e *testArithEncoder) encode(ctx *ArithContext, d int) {
+	qe := arithQeTable[ctx.i]
+	e.a -= uint32(qe.qe)
+	if d == ctx.MPS() {
+		if e.a&0x8000 != 0 {
+			e.c += uint32(qe.qe)
+			return
+		}
+		if e.a < uint32(qe.qe) {
+			e.a = uint32(qe.qe)
+		} else {
+			e.c += uint32(qe.qe)
+		}
+		ctx.i = qe.nmps
+	} else {
+		if e.a < uint32(qe.qe) {
+			e.c += uint32(qe.qe)
+		} else {
+			e.a = uint32(qe.qe)
+		}
+		if qe.switchM {
+			ctx.mps = !ctx.mps
+		}
+		ctx.i = qe.nlps
+	}
+	for {
+		e.a <<= 1
+		e.c <<= 1
+		e.ct--
+		if e.ct == 0 {
+			e.byteOut()
+		}
+		if e.a&0x8000 != 0 {
+			break
+		}
+	}
+}
+
+func (e *testArithEncoder) byteOut() {
+	last := len(e.out) - 1
+	if e.out[last] == 0xff {
+		e.out = append(e.out, byte(e.c>>20))
+		e.c &= 0xfffff
+		e.ct = 7
+		return
+	}
+	if e.c >= 0x8000000 {
+		e.out[last]++
+		if e.out[last] == 0xff {
+			e.c &= 0x7ffffff
+			e.out = append(e.out, byte(e.c>>20))
+			e.c &= 0xfffff
+			e.ct = 7
+			return
+		}
+	}
+	e.out = append(e.out, byte(e.c>>19))
+	e.c &= 0x7ffff
+	e.ct = 8
+}
+
+func (e *testArithEncoder) flush() []byte {
+	temp := e.c + e.a
+	e.c |= 0xffff
+	if e.c >= temp {
+		e.c -= 0x8000
+	}
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	e.c <<= uint(e.ct)
+	e.byteOut()
+	if e.out[len(e.out)-1] != 0xff {
+		e.out = append(e.out, 0xff)
+	}
+	e.out = append(e.out, 0xac)
+	return e.out[1:]
+}
+
+// testPattern returns a w×h image with a deterministic pixel pattern.
+func testPattern(w, h int32, seed int) *Image {
+	img := NewImage(w, h)
+	for y := int32(0); y < h; y++ {
+		for x := int32(0); x < w; x++ {
+			if (int(x)*3+int(y)*5+seed)%7 < 3 {
+				img.SetPixel(x, y, 1)
+			}
+		}
+	}
+	return img
+}
+
+// sameBitmap reports whether a and b hold identical pixels.
+func sameBitmap(a, b *Image) bool {
+	if a.Width() != b.Width() || a.Height() != b.Height() {
+		return false
+	}
+	for y := int32(0); y < int32(a.Height()); y++ {
+		for x := int32(0); x < int32(a.Width()); x++ {
+			if a.GetPixel(x, y) != b.GetPixel(x, y) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+var errTestCancelled = errors.New("test: cancelled")
+
+// countingCancel is a CancelIndicator that reports err once it has been
+// polled more than after times.
+type countingCancel struct {
+	after int
+	polls int
+	err   error
+}
+
+func (c *countingCancel) Err() error {
+	c.polls++
+	if c.polls > c.after {
+		return c.err
+	}
+	return nil
+}
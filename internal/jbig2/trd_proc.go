@@ -46,11 +46,25 @@ type TRDProc struct {
 	SBHUFFRDY      *HuffmanTable
 	SBHUFFRSize    *HuffmanTable
 	SBRAT          [4]int8
+	Cancel         CancelIndicator
+	Budget         *Budget
+	// Clip, when set, restricts rendering to a rectangle of the region; the
+	// decoded image then covers only that rectangle.
+	Clip *Rect
+
+	partial *Image
 }
 
 // NewTRDProc constructs a text region decoder configuration.
 func NewTRDProc() *TRDProc { return &TRDProc{} }
 
+// PartialImage returns the region image as far as it was decoded: after a
+// failure it holds the symbol instances placed before it, and nil when the
+// image was never allocated.
+func (p *TRDProc) PartialImage() *Image {
+	return p.partial
+}
+
 type composeData struct {
 	x         int64
 	y         int64
@@ -67,12 +81,16 @@ func (p *TRDProc) DecodeHuffman(stream *BitStream, contexts []ArithContext) (*Im
 		p.SBHUFFRDY == nil || p.SBHUFFRSize == nil {
 		return nil, errors.New("jbig2: missing Huffman tables for text region")
 	}
+	if err := p.Budget.CheckTextInstances(p.SBNumInstances); err != nil {
+		return nil, err
+	}
 
-	img := NewImage(int32(p.SBWidth), int32(p.SBHeight))
+	img := newRegionImage(p.SBWidth, p.SBHeight, p.Clip)
 	if img == nil || img.data == nil {
 		return nil, errors.New("jbig2: failed to allocate text region image")
 	}
 	img.Fill(p.SBDefPixel)
+	p.partial = img
 
 	decoder := NewHuffmanDecoder(stream)
 
@@ -99,6 +117,9 @@ func (p *TRDProc) DecodeHuffman(stream *BitStream, contexts []ArithContext) (*Im
 		curs := int64(0)
 		first := true
 		for {
+			if err := checkCancel(p.Cancel); err != nil {
+				return nil, err
+			}
 			if first {
 				dfs, ok, err := p.decodeHuffmanFirstS(decoder)
 				if err != nil {
@@ -216,6 +237,7 @@ func (p *TRDProc) DecodeHuffman(stream *BitStream, contexts []ArithContext) (*Im
 				}
 
 				grrd := NewGRRDProc()
+				grrd.Cancel = p.Cancel
 				grrd.Template = p.SBRTEMPLATE
 				grrd.TPGRON = false
 				grrd.Width = uint32(newWidth)
@@ -243,7 +265,7 @@ func (p *TRDProc) DecodeHuffman(stream *BitStream, contexts []ArithContext) (*Im
 			}
 
 			compose := p.getComposeData(curs, ti, wi, hi)
-			if !glyph.ComposeTo(img, compose.x, compose.y, p.SBCombOp) {
+			if !composeClipped(glyph, img, compose.x, compose.y, p.Clip, p.SBCombOp) {
 				return nil, errors.New("jbig2: failed to compose text region glyph")
 			}
 			if compose.increment != 0 {
@@ -400,6 +422,9 @@ func (p *TRDProc) DecodeArith(decoder *ArithDecoder, contexts []ArithContext, id
 	if decoder == nil {
 		return nil, errors.New("jbig2: nil arithmetic decoder for text region")
 	}
+	if err := p.Budget.CheckTextInstances(p.SBNumInstances); err != nil {
+		return nil, err
+	}
 	return p.decodeTextRegionArith(decoder, contexts, ids)
 }
 
@@ -422,11 +447,12 @@ func (p *TRDProc) decodeTextRegionArith(decoder *ArithDecoder, contexts []ArithC
 	if !IsValidImageSize(int32(p.SBWidth), int32(p.SBHeight)) {
 		return NewImage(int32(p.SBWidth), int32(p.SBHeight)), nil
 	}
-	img := NewImage(int32(p.SBWidth), int32(p.SBHeight))
+	img := newRegionImage(p.SBWidth, p.SBHeight, p.Clip)
 	if img == nil || img.data == nil {
 		return nil, errors.New("jbig2: failed to allocate text region image")
 	}
 	img.Fill(p.SBDefPixel)
+	p.partial = img
 
 	var iadt, iafs, iads, iait, iari, iardw, iardh, iardx, iardy *ArithIntDecoder
 	if ids != nil {
@@ -489,6 +515,9 @@ func (p *TRDProc) decodeTextRegionArith(decoder *ArithDecoder, contexts []ArithC
 		curs := int64(0)
 		first := true
 		for {
+			if err := checkCancel(p.Cancel); err != nil {
+				return nil, err
+			}
 			if first {
 				dfs, ok, err := iafs.Decode(decoder)
 				if err != nil {
@@ -606,6 +635,7 @@ func (p *TRDProc) decodeTextRegionArith(decoder *ArithDecoder, contexts []ArithC
 				}
 
 				grrd := NewGRRDProc()
+				grrd.Cancel = p.Cancel
 				grrd.Template = p.SBRTEMPLATE
 				grrd.TPGRON = false
 				grrd.Width = uint32(newWidth)
@@ -630,7 +660,7 @@ func (p *TRDProc) decodeTextRegionArith(decoder *ArithDecoder, contexts []ArithC
 			}
 
 			compose := p.getComposeData(curs, ti, wi, hi)
-			if !glyph.ComposeTo(img, compose.x, compose.y, p.SBCombOp) {
+			if !composeClipped(glyph, img, compose.x, compose.y, p.Clip, p.SBCombOp) {
 				return nil, errors.New("jbig2: failed to compose text region glyph")
 			}
 			if compose.increment != 0 {
@@ -0,0 +1,221 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// Bitmap is an editable bilevel image, with pixel values 0 for background
+// and 1 for foreground. Its origin is always (0, 0) and every operation
+// checks its coordinates: pixels outside the bitmap read as 0 and writes to
+// them are ignored.
+//
+// A bitmap made from a decoded page or symbol with Image.Bitmap holds a
+// copy of its pixels. Clones are copy-on-write: a bitmap made by Clone
+// shares the pixels of its source until either is first modified, unless
+// rows of the source were handed out by Row, which could modify them at any
+// time. A Bitmap is not safe for concurrent use.
+type Bitmap struct {
+	img     *jbig2.Image
+	shared  bool // img is shared and must be copied before it is modified
+	exposed bool // rows of img were handed out by Row and may change
+}
+
+var _ image.PalettedImage = (*Bitmap)(nil)
+
+// NewBitmap returns a width×height bitmap with every pixel set to 0.
+func NewBitmap(width, height int) (*Bitmap, error) {
+	if width > math.MaxInt32 || height > math.MaxInt32 || !jbig2.IsValidImageSize(int32(width), int32(height)) {
+		return nil, fmt.Errorf("jbig2: invalid bitmap size %dx%d", width, height)
+	}
+	img := jbig2.NewImage(int32(width), int32(height))
+	if img.Data() == nil {
+		return nil, fmt.Errorf("jbig2: bitmap size %dx%d too large", width, height)
+	}
+	return &Bitmap{img: img}, nil
+}
+
+// Bitmap returns an editable copy of the image, or nil when the image is
+// empty. The copy is a snapshot: later changes the decoder makes to the
+// image, such as those to the page returned by Decoder.GetPageImage while
+// decoding continues, do not show in it.
+func (img *Image) Bitmap() *Bitmap {
+	if img == nil || img.img == nil || img.img.Data() == nil {
+		return nil
+	}
+	return &Bitmap{img: img.img.Clone()}
+}
+
+// mutable returns the pixels of b after copying them if they are shared.
+func (b *Bitmap) mutable() *jbig2.Image {
+	if b.shared {
+		b.img = b.img.Clone()
+		b.shared = false
+	}
+	return b.img
+}
+
+// Clone returns a bitmap with the same pixels. The pixels are copied once
+// either bitmap is modified, or right away when rows of b were handed out
+// by Row.
+func (b *Bitmap) Clone() *Bitmap {
+	if b == nil || b.img == nil {
+		return nil
+	}
+	if b.exposed {
+		return &Bitmap{img: b.img.Clone()}
+	}
+	b.shared = true
+	return &Bitmap{img: b.img, shared: true}
+}
+
+// Width returns the bitmap width in pixels.
+func (b *Bitmap) Width() int {
+	if b == nil || b.img == nil {
+		return 0
+	}
+	return b.img.Width()
+}
+
+// Height returns the bitmap height in pixels.
+func (b *Bitmap) Height() int {
+	if b == nil || b.img == nil {
+		return 0
+	}
+	return b.img.Height()
+}
+
+// ColorModel implements image.Image using the two-entry Palette.
+func (b *Bitmap) ColorModel() color.Model { return Palette() }
+
+// Bounds implements image.Image.
+func (b *Bitmap) Bounds() image.Rectangle {
+	return image.Rect(0, 0, b.Width(), b.Height())
+}
+
+// At implements image.Image.
+func (b *Bitmap) At(x, y int) color.Color {
+	return palette[b.ColorIndexAt(x, y)]
+}
+
+// ColorIndexAt implements image.PalettedImage and returns the pixel value at
+// (x, y).
+func (b *Bitmap) ColorIndexAt(x, y int) uint8 {
+	if b == nil || b.img == nil || !(image.Point{X: x, Y: y}).In(b.Bounds()) {
+		return 0
+	}
+	return uint8(b.img.GetPixel(int32(x), int32(y)))
+}
+
+// Set implements draw.Image, storing the Palette entry closest to c.
+func (b *Bitmap) Set(x, y int, c color.Color) {
+	b.SetColorIndex(x, y, uint8(palette.Index(c)))
+}
+
+// SetColorIndex sets the pixel at (x, y) to 1 when v is nonzero and to 0
+// otherwise.
+func (b *Bitmap) SetColorIndex(x, y int, v uint8) {
+	if b == nil || b.img == nil || !(image.Point{X: x, Y: y}).In(b.Bounds()) {
+		return
+	}
+	b.mutable().SetPixel(int32(x), int32(y), int(v))
+}
+
+// Fill sets every pixel to 1 when v is nonzero and to 0 otherwise.
+func (b *Bitmap) Fill(v uint8) {
+	if b == nil || b.img == nil {
+		return
+	}
+	b.mutable().Fill(v != 0)
+}
+
+// Stride returns the length of the rows returned by Row: the width rounded
+// up to whole 32-bit words, in bytes.
+func (b *Bitmap) Stride() int {
+	if b == nil || b.img == nil {
+		return 0
+	}
+	return b.img.Stride()
+}
+
+// Row returns row y, or nil when y is outside the bitmap. Pixels are packed
+// eight to a byte with the leftmost pixel in the most significant bit; the
+// bits past the width pad the row to whole words. The row may be modified
+// in place, so Row first copies shared pixels as any other modification
+// does, and later clones copy the pixels right away. It stays valid until
+// the height of the bitmap changes.
+func (b *Bitmap) Row(y int) []byte {
+	if b == nil || b.img == nil || y < 0 || y >= b.img.Height() {
+		return nil
+	}
+	stride := b.img.Stride()
+	b.exposed = true
+	return b.mutable().Data()[y*stride : (y+1)*stride : (y+1)*stride]
+}
+
+// SubImage returns a new bitmap holding a copy of the part of b inside r,
+// or nil when r does not overlap b.
+func (b *Bitmap) SubImage(r image.Rectangle) *Bitmap {
+	r = r.Intersect(b.Bounds())
+	if r.Empty() {
+		return nil
+	}
+	return &Bitmap{img: b.img.SubImage(int32(r.Min.X), int32(r.Min.Y), int32(r.Dx()), int32(r.Dy()))}
+}
+
+// Expand grows the bitmap to height rows, setting the pixels of the added
+// rows to 1 when v is nonzero and to 0 otherwise.
+func (b *Bitmap) Expand(height int, v uint8) error {
+	if b == nil || b.img == nil {
+		return errors.New("jbig2: nil bitmap")
+	}
+	if height < b.img.Height() || height > math.MaxInt32 {
+		return fmt.Errorf("jbig2: cannot expand bitmap of height %d to %d", b.img.Height(), height)
+	}
+	if height == b.img.Height() {
+		return nil
+	}
+	img := b.mutable()
+	img.Expand(int32(height), v != 0)
+	if img.Height() != height {
+		return fmt.Errorf("jbig2: bitmap height %d too large", height)
+	}
+	return nil
+}
+
+// Compose combines src, placed with its origin at pt, into b using op.
+// Pixels of src falling outside b are ignored.
+func (b *Bitmap) Compose(src *Bitmap, pt image.Point, op CombinationOperator) error {
+	return b.ComposeRect(src, pt, src.Bounds(), op)
+}
+
+// ComposeRect is like Compose but combines only the part r of src, placing
+// its top-left corner at pt. r must lie within the bounds of src.
+func (b *Bitmap) ComposeRect(src *Bitmap, pt image.Point, r image.Rectangle, op CombinationOperator) error {
+	if b == nil || b.img == nil || src == nil || src.img == nil {
+		return errors.New("jbig2: nil bitmap")
+	}
+	if op < CombinationOR || op > CombinationReplace {
+		return fmt.Errorf("jbig2: invalid combination operator %d", int(op))
+	}
+	if r.Empty() || !r.In(src.Bounds()) {
+		return fmt.Errorf("jbig2: rectangle %v outside source bounds %v", r, src.Bounds())
+	}
+	if !r.Sub(r.Min).Add(pt).Overlaps(b.Bounds()) {
+		return nil
+	}
+	srcImg := src.img
+	if src == b {
+		srcImg = srcImg.Clone()
+	}
+	rect := jbig2.Rect{Left: r.Min.X, Top: r.Min.Y, Right: r.Max.X, Bottom: r.Max.Y}
+	if !srcImg.ComposeToWithRect(b.mutable(), int64(pt.X), int64(pt.Y), rect, jbig2.ComposeOp(op)) {
+		return fmt.Errorf("jbig2: cannot compose at %v", pt)
+	}
+	return nil
+}
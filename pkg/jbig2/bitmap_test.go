@@ -0,0 +1,158 @@
+package jbig2
+
+import (
+	"image"
+	"image/draw"
+	"testing"
+)
+
+func TestBitmapCopyOnWrite(t *testing.T) {
+	img := testImage()
+	bm := img.Bitmap()
+	if bm.Bounds() != img.Bounds() || bm.ColorIndexAt(9, 1) != 1 {
+		t.Fatalf("Bitmap does not show the image pixels")
+	}
+	clone := bm.Clone()
+
+	bm.SetColorIndex(1, 0, 1)
+	if img.ColorIndexAt(1, 0) != 0 || clone.ColorIndexAt(1, 0) != 0 {
+		t.Error("Writing a bitmap modified the image it was made from or its clone")
+	}
+	if bm.ColorIndexAt(1, 0) != 1 {
+		t.Error("SetColorIndex was not applied")
+	}
+
+	clone.Row(0)[0] = 0
+	if img.ColorIndexAt(0, 0) != 1 || bm.ColorIndexAt(0, 0) != 1 {
+		t.Error("Writing a row of a clone modified the other bitmaps")
+	}
+	if clone.ColorIndexAt(0, 0) != 0 {
+		t.Error("Row does not alias the bitmap pixels")
+	}
+}
+
+func TestBitmapCloneAfterRow(t *testing.T) {
+	img := testImage()
+	bm := img.Bitmap()
+	// The decoder keeps writing pages it has handed out; the bitmap is a
+	// snapshot.
+	img.img.SetPixel(5, 0, 1)
+	if bm.ColorIndexAt(5, 0) != 0 {
+		t.Error("Bitmap shows changes made to the image after it was taken")
+	}
+
+	row := bm.Row(0)
+	clone := bm.Clone()
+	row[0] ^= 0xff
+	if clone.ColorIndexAt(0, 0) != 1 || clone.ColorIndexAt(7, 0) != 0 {
+		t.Error("Writing a row handed out before Clone modified the clone")
+	}
+	if bm.ColorIndexAt(0, 0) != 0 {
+		t.Error("Row no longer aliases the bitmap pixels after Clone")
+	}
+	clone.SetColorIndex(9, 0, 1)
+	if bm.ColorIndexAt(9, 0) != 0 {
+		t.Error("Writing the clone modified the bitmap it was made from")
+	}
+}
+
+func TestBitmapBoundsChecks(t *testing.T) {
+	bm, err := NewBitmap(11, 3)
+	if err != nil {
+		t.Fatalf("NewBitmap returned error: %v", err)
+	}
+	bm.SetColorIndex(-1, 0, 1)
+	bm.SetColorIndex(11, 2, 1)
+	bm.SetColorIndex(0, 3, 1)
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 11; x++ {
+			if bm.ColorIndexAt(x, y) != 0 {
+				t.Fatalf("Out-of-bounds write set pixel (%d,%d)", x, y)
+			}
+		}
+	}
+	if bm.Row(-1) != nil || bm.Row(3) != nil {
+		t.Error("Row returned a row outside the bitmap")
+	}
+	if got := len(bm.Row(2)); got != bm.Stride() || got != 4 {
+		t.Errorf("Row length %d, stride %d; want 4", got, bm.Stride())
+	}
+	if bm.SubImage(image.Rect(11, 0, 20, 3)) != nil {
+		t.Error("SubImage outside the bitmap returned a bitmap")
+	}
+	for _, size := range [][2]int{{0, 3}, {3, -1}, {1 << 30, 1}} {
+		if _, err := NewBitmap(size[0], size[1]); err == nil {
+			t.Errorf("NewBitmap(%d, %d) succeeded", size[0], size[1])
+		}
+	}
+	if err := bm.Expand(2, 0); err == nil {
+		t.Error("Expand to a smaller height succeeded")
+	}
+	if err := bm.ComposeRect(bm, image.Point{}, image.Rect(0, 0, 12, 1), CombinationOR); err == nil {
+		t.Error("ComposeRect with a rectangle outside the source succeeded")
+	}
+	if err := bm.Compose(bm, image.Point{}, CombinationOperator(9)); err == nil {
+		t.Error("Compose with an invalid operator succeeded")
+	}
+	if err := bm.Compose(nil, image.Point{}, CombinationOR); err == nil {
+		t.Error("Compose with a nil source succeeded")
+	}
+}
+
+func TestBitmapCompose(t *testing.T) {
+	src := testImage().Bitmap()
+	dst, err := NewBitmap(16, 6)
+	if err != nil {
+		t.Fatalf("NewBitmap returned error: %v", err)
+	}
+	dst.Fill(1)
+	if err := dst.Compose(src, image.Pt(2, 1), CombinationAND); err != nil {
+		t.Fatalf("Compose returned error: %v", err)
+	}
+	for y := 0; y < 6; y++ {
+		for x := 0; x < 16; x++ {
+			want := uint8(1)
+			if (image.Point{X: x, Y: y}).In(image.Rect(2, 1, 13, 4)) {
+				want = src.ColorIndexAt(x-2, y-1)
+			}
+			if got := dst.ColorIndexAt(x, y); got != want {
+				t.Fatalf("Pixel (%d,%d) = %d, want %d", x, y, got, want)
+			}
+		}
+	}
+	// Composition clipped to the destination and entirely outside it.
+	if err := dst.Compose(src, image.Pt(14, 4), CombinationXOR); err != nil {
+		t.Errorf("Compose overlapping the edge returned error: %v", err)
+	}
+	if err := dst.Compose(src, image.Pt(-20, 0), CombinationXOR); err != nil {
+		t.Errorf("Compose outside the destination returned error: %v", err)
+	}
+
+	sub := dst.SubImage(image.Rect(2, 1, 13, 4))
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 11; x++ {
+			if sub.ColorIndexAt(x, y) != src.ColorIndexAt(x, y) {
+				t.Fatalf("SubImage pixel (%d,%d) differs", x, y)
+			}
+		}
+	}
+
+	if err := sub.Expand(5, 1); err != nil {
+		t.Fatalf("Expand returned error: %v", err)
+	}
+	if sub.Height() != 5 || sub.ColorIndexAt(10, 4) != 1 || sub.ColorIndexAt(0, 0) != 1 {
+		t.Error("Expand did not add rows of the requested value")
+	}
+}
+
+func TestBitmapDrawImage(t *testing.T) {
+	bm, err := NewBitmap(4, 4)
+	if err != nil {
+		t.Fatalf("NewBitmap returned error: %v", err)
+	}
+	var dst draw.Image = bm
+	draw.Draw(dst, image.Rect(1, 1, 3, 3), image.Black, image.Point{}, draw.Src)
+	if bm.ColorIndexAt(1, 1) != 1 || bm.ColorIndexAt(2, 2) != 1 || bm.ColorIndexAt(0, 0) != 0 || bm.ColorIndexAt(3, 3) != 0 {
+		t.Error("draw.Draw did not paint the expected pixels")
+	}
+}
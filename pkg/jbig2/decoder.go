@@ -1,8 +1,13 @@
 package jbig2
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"image"
+	"io"
+	"iter"
+	"log/slog"
 
 	"github.com/jdeng/gojbig2/internal/jbig2"
 )
@@ -17,6 +22,75 @@ type Options struct {
 	SrcData []byte
 	// SrcKey identifies the source data stream.
 	SrcKey uint64
+	// Limits bounds the resources the decode may use. The zero value
+	// imposes no limits.
+	Limits Limits
+	// OnRegion, when set, is called after each region segment is composed
+	// onto the page, so that a viewer can paint the page incrementally. A
+	// region decoded across several Continue calls is reported once per
+	// composed part.
+	OnRegion func(RegionEvent)
+	// OnRows, when set, is called as rows of generic regions that are
+	// composed onto the page finish decoding.
+	OnRows func(RowsEvent)
+	// OnStripe, when set, receives the finished rows of striped pages at
+	// each end-of-stripe segment, after which the decoder releases them.
+	// Such pages are held in memory one stripe at a time and NextPage
+	// returns them with an empty image. Rows of a page of unknown height
+	// that follow its last end-of-stripe segment are discarded. An error
+	// returned by OnStripe stops decoding.
+	OnStripe func(Stripe) error
+	// StripeWriter, when set, receives the rows of striped pages like
+	// OnStripe, written as packed rows of (width+7)/8 bytes with the most
+	// significant bit first and 1 for black, the raster layout of a binary
+	// PBM file. Both are called when both are set.
+	StripeWriter io.Writer
+	// Strict checks every segment against the restrictions of the profiles
+	// the stream declares in profiles segments, such as the allowed coding
+	// methods, generic templates and AT pixel positions. The first violation
+	// fails decoding with an error matching ErrProfileViolation, as does a
+	// declared profile the decoder does not know.
+	Strict bool
+	// Observer, when set, receives tracing hooks for every segment and
+	// page, for example a NewMetricsObserver feeding a metrics library.
+	Observer Observer
+	// Logger, when set, receives a warning for every non-fatal anomaly the
+	// decoder works around, such as a skipped unknown segment, a region
+	// clipped to the page or an ignored flag, with the segment number, type
+	// and data offset as attributes. Without it such anomalies are not
+	// reported; the decoder never writes to stdout or stderr.
+	Logger *slog.Logger
+	// Globals provides global segments decoded once by ParseGlobals and
+	// shared with other decoders, in place of GlobalData; setting both is
+	// an error. The decoder holds a reference to them until Close. Their
+	// decoded dictionaries count against Limits.MaxAllocBytes as those of
+	// GlobalData do, and New fails when they do not fit.
+	Globals *Globals
+	// DocumentContext, when set, shares decoded symbol dictionaries of
+	// GlobalData with the other decoders using it; see DocumentContext.
+	DocumentContext *DocumentContext
+	// Recover keeps decoding past a region segment that fails, for example
+	// because its data is corrupt or truncated. The rows of a generic
+	// region, the symbols of a text region or the coarser gray levels of
+	// a halftone region decoded before the failure are composed, the
+	// failure is recorded in Page.Damage and decoding resumes at the next
+	// segment, located using the data length of the failed one. The page
+	// is then returned as far as it could be decoded. Failures of other
+	// segments, exceeded limits and cancellation still stop decoding.
+	Recover bool
+	// Pause, when set, is polled by GetFirstPage and Continue after every
+	// segment and every generic region row of the page. Once it returns
+	// true they return early with GetProcessingStatus reporting
+	// CodecStatusToBeContinued, and a later Continue carries on. The state
+	// of a paused decoder can be saved with MarshalState.
+	Pause func() bool
+	// ReleaseResults drops the decoded results of segments once no later
+	// segment can refer to them: when the retention bits say so, and at the
+	// end of each page for the segments associated with it. This keeps
+	// LiveBytes bounded over long multi-page documents, but the Image,
+	// SymbolDict and PatternDict of released segments returned by
+	// GetSegments are nil.
+	ReleaseResults bool
 }
 
 // Decoder manages the JBIG2 decoding process.
@@ -30,17 +104,41 @@ func New(opts Options) (*Decoder, error) {
 		return nil, errors.New("jbig2: empty source data")
 	}
 
-	internalDecoder, err := jbig2.NewDecoder(jbig2.DecoderOptions{
+	internalDecoder, err := jbig2.NewDecoder(opts.internal())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Decoder{decoder: internalDecoder}, nil
+}
+
+// internal maps opts to the options of the internal decoder.
+func (opts Options) internal() jbig2.DecoderOptions {
+	return jbig2.DecoderOptions{
 		GlobalData: opts.GlobalData,
 		GlobalKey:  opts.GlobalKey,
 		SrcData:    opts.SrcData,
 		SrcKey:     opts.SrcKey,
-	})
-	if err != nil {
-		return nil, err
+		Limits:     opts.Limits.internal(),
+		OnRegion:   regionHandler(opts.OnRegion),
+		OnRows:     rowsHandler(opts.OnRows),
+		OnStripe:   stripeHandler(opts.OnStripe, opts.StripeWriter),
+		Strict:     opts.Strict,
+		Observer:   newObserver(opts.Observer),
+		Logger:     opts.Logger,
+		Globals:    opts.Globals.internal(),
+		Recover:    opts.Recover,
+		Pause:      pauseIndicator(opts.Pause),
+		Release:    opts.ReleaseResults,
+
+		DocumentContext: opts.DocumentContext.internal(),
 	}
+}
 
-	return &Decoder{decoder: internalDecoder}, nil
+// Close releases the reference the decoder holds to Options.Globals. The
+// decoder must not be used afterwards. It is a no-op without Globals.
+func (d *Decoder) Close() {
+	d.decoder.Close()
 }
 
 // DecodeAll processes all segments in the JBIG2 stream.
@@ -48,16 +146,100 @@ func (d *Decoder) DecodeAll() error {
 	return d.decoder.DecodeAll()
 }
 
+// DecodeAllContext is like DecodeAll but stops as soon as ctx is done,
+// returning an error that satisfies errors.Is(err, ctx.Err()). Cancellation
+// inside a segment is wrapped in a *DecodeError naming it. Cancellation is
+// checked between segments and within generic region rows, text region
+// instances, halftone grid rows and MMR rows, so even a single large region
+// stops promptly.
+func (d *Decoder) DecodeAllContext(ctx context.Context) error {
+	return d.decoder.DecodeAllContext(ctx)
+}
+
+// NextPage decodes the next page of the stream and returns it. Dictionaries
+// associated with page 0 or supplied through GlobalData remain available to
+// every page. NextPage returns io.EOF once all pages have been decoded.
+func (d *Decoder) NextPage() (*Page, error) {
+	img, info, err := d.decoder.NextPage()
+	if err != nil {
+		return nil, err
+	}
+	return newPage(img, d.decoder.ColourPage(), info, d.decoder.Damage()), nil
+}
+
+// DecodeRegion is like NextPage but produces only the part of the next page
+// inside rect, given in page coordinates. The returned image covers the
+// intersection of rect with the page and its pixel (0, 0) corresponds to the
+// top-left corner of that intersection; it is empty when rect misses the
+// page. Page storage and composition scale with rect: regions with a known
+// data length that lie wholly outside it are not decoded, and text and
+// halftone regions render only the part inside it. All other data is still
+// read. Pages flagged as containing refinements are decoded in full and
+// cropped.
+func (d *Decoder) DecodeRegion(rect image.Rectangle) (*Page, error) {
+	if rect.Empty() {
+		return nil, errors.New("jbig2: empty region")
+	}
+	img, info, err := d.decoder.DecodeRegion(jbig2.Rect{
+		Left:   rect.Min.X,
+		Top:    rect.Min.Y,
+		Right:  rect.Max.X,
+		Bottom: rect.Max.Y,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return newPage(img, d.decoder.ColourPage(), info, d.decoder.Damage()), nil
+}
+
+// NextPageContext is like NextPage but stops as soon as ctx is done; see
+// DecodeAllContext for the error returned.
+func (d *Decoder) NextPageContext(ctx context.Context) (*Page, error) {
+	img, info, err := d.decoder.NextPageContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(img, d.decoder.ColourPage(), info, d.decoder.Damage()), nil
+}
+
+// Pages returns an iterator over the remaining pages of the stream. Iteration
+// stops after the last page or after yielding the first decode error.
+func (d *Decoder) Pages() iter.Seq2[*Page, error] {
+	return func(yield func(*Page, error) bool) {
+		for {
+			page, err := d.NextPage()
+			if err == io.EOF {
+				return
+			}
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
 // GetFirstPage prepares the first page for rendering.
 func (d *Decoder) GetFirstPage(buf []byte, width, height, stride int) (bool, error) {
 	return d.decoder.GetFirstPage(buf, width, height, stride)
 }
 
+// GetFirstPageContext is like GetFirstPage but stops as soon as ctx is done;
+// see DecodeAllContext for the error returned.
+func (d *Decoder) GetFirstPageContext(ctx context.Context, buf []byte, width, height, stride int) (bool, error) {
+	return d.decoder.GetFirstPageContext(ctx, buf, width, height, stride)
+}
+
 // Continue resumes decoding after a pause.
 func (d *Decoder) Continue() (bool, error) {
 	return d.decoder.Continue()
 }
 
+// ContinueContext is like Continue but stops as soon as ctx is done; see
+// DecodeAllContext for the error returned.
+func (d *Decoder) ContinueContext(ctx context.Context) (bool, error) {
+	return d.decoder.ContinueContext(ctx)
+}
+
 // GetPageImage returns the current decoded page image.
 func (d *Decoder) GetPageImage() *Image {
 	internalImg := d.decoder.GetPageImage()
@@ -73,7 +255,9 @@ func (d *Decoder) GetProcessingStatus() CodecStatus {
 	return CodecStatus(d.decoder.GetProcessingStatus())
 }
 
-// GetSegments returns all decoded segments.
+// GetSegments returns all decoded segments. Their results stay available
+// unless Options.ReleaseResults is set, in which case the results of
+// segments no longer referred to have been dropped.
 func (d *Decoder) GetSegments() []*Segment {
 	internalSegments := d.decoder.GetSegments()
 	segments := make([]*Segment, len(internalSegments))
@@ -83,6 +267,51 @@ func (d *Decoder) GetSegments() []*Segment {
 	return segments
 }
 
+// FileHeader returns the file header, or nil when SrcData is an embedded
+// stream without one, as in PDF.
+func (d *Decoder) FileHeader() *FileHeader {
+	return newFileHeader(d.decoder.FileHeader())
+}
+
+// Damage returns the region segments of every page decoded so far that
+// failed with Options.Recover set, in stream order.
+func (d *Decoder) Damage() []Damage {
+	return newDamage(d.decoder.Damage(), 0)
+}
+
+// Comments returns the name/value pairs of the comment extension segments
+// decoded so far, including those of GlobalData, in stream order. Producers
+// use them to record details such as the scanner or software that created
+// the file.
+func (d *Decoder) Comments() []Comment {
+	return newComments(d.decoder.Comments())
+}
+
+// Profiles returns the profiles declared by the profiles segments decoded
+// so far, including those of GlobalData.
+func (d *Decoder) Profiles() []Profile {
+	return newProfiles(d.decoder.Profiles())
+}
+
+// LiveBytes returns the bitmap storage the decoder currently holds: the
+// page being decoded and the results of decoded segments. With
+// Options.ReleaseResults only results that later segments may still refer
+// to are held, so the figure stays bounded over long multi-page documents.
+func (d *Decoder) LiveBytes() uint64 {
+	return d.decoder.LiveBytes()
+}
+
+// PageInfos returns the page information of every page whose page
+// information segment has been parsed so far.
+func (d *Decoder) PageInfos() []*PageInfo {
+	infos := d.decoder.PageInfos()
+	out := make([]*PageInfo, len(infos))
+	for i, info := range infos {
+		out[i] = &PageInfo{info: info}
+	}
+	return out
+}
+
 // CodecStatus represents the current state of the decoder.
 type CodecStatus int
 
@@ -114,7 +343,8 @@ func (status CodecStatus) String() string {
 
 // Image represents a decoded JBIG2 image.
 type Image struct {
-	img *jbig2.Image
+	img    *jbig2.Image
+	colour *image.RGBA
 }
 
 // Width returns the image width in pixels.
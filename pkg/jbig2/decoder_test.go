@@ -1,6 +1,14 @@
 package jbig2
 
 import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"io"
+	"log/slog"
+	"strings"
 	"testing"
 )
 
@@ -128,3 +136,700 @@ func TestCodecStatusString(t *testing.T) {
 		t.Errorf("Unexpected fallback codec status string: got %q", got)
 	}
 }
+
+// segmentBytes serialises a segment with no referred-to segments and a short
+// page association.
+func segmentBytes(number uint32, typ, page byte, data []byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, number)
+	out = append(out, typ, 0x00, page)
+	out = binary.BigEndian.AppendUint32(out, uint32(len(data)))
+	return append(out, data...)
+}
+
+// pageInfoBytes returns a page information segment payload.
+func pageInfoBytes(width, height uint32, flags byte) []byte {
+	out := binary.BigEndian.AppendUint32(nil, width)
+	out = binary.BigEndian.AppendUint32(out, height)
+	out = binary.BigEndian.AppendUint32(out, 300)
+	out = binary.BigEndian.AppendUint32(out, 300)
+	return append(out, flags, 0x00, 0x00)
+}
+
+func TestDecoderPages(t *testing.T) {
+	var data []byte
+	data = append(data, segmentBytes(0, 48, 1, pageInfoBytes(10, 4, 0x00))...)
+	data = append(data, segmentBytes(1, 49, 1, nil)...)
+	data = append(data, segmentBytes(2, 48, 2, pageInfoBytes(7, 3, 0x04))...)
+	data = append(data, segmentBytes(3, 49, 2, nil)...)
+	data = append(data, segmentBytes(4, 51, 0, nil)...)
+
+	decoder, err := New(Options{SrcData: data})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+
+	var pages []*Page
+	for page, err := range decoder.Pages() {
+		if err != nil {
+			t.Fatalf("Pages yielded error: %v", err)
+		}
+		pages = append(pages, page)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(pages))
+	}
+	if pages[0].Number != 1 || pages[0].Image.Width() != 10 || pages[0].Info.Height() != 4 {
+		t.Errorf("Unexpected first page: number %d, %dx%d", pages[0].Number, pages[0].Image.Width(), pages[0].Info.Height())
+	}
+	if pages[1].Number != 2 || pages[1].Image.Width() != 7 || pages[1].Info.Width() != 7 {
+		t.Errorf("Unexpected second page: number %d, width %d", pages[1].Number, pages[1].Image.Width())
+	}
+
+	if _, err := decoder.NextPage(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last page, got %v", err)
+	}
+}
+
+func TestDecoderContextCancelled(t *testing.T) {
+	decoder, err := New(Options{SrcData: testFile()})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := decoder.DecodeAllContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	page, err := decoder.NextPageContext(context.Background())
+	if err != nil {
+		t.Fatalf("NextPageContext returned error: %v", err)
+	}
+	if page.Number != 1 {
+		t.Errorf("Unexpected page number %d", page.Number)
+	}
+}
+
+func TestDecoderContextCancelledInSegment(t *testing.T) {
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x00, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	decoder, err := New(Options{
+		SrcData: testFile(segmentBytes(1, 38, 1, region)),
+		OnRows:  func(RowsEvent) { cancel() },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	_, err = decoder.NextPageContext(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected an error matching context.Canceled, got %v", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) || de.Segment != 1 {
+		t.Errorf("Expected a DecodeError for segment 1, got %v", err)
+	}
+}
+
+func TestDecoderLimits(t *testing.T) {
+	decoder, err := New(Options{SrcData: testFile(), Limits: Limits{MaxPagePixels: 100}})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Fatalf("Expected ErrLimitExceeded, got %v", err)
+	}
+}
+
+func TestDecoderDecodeError(t *testing.T) {
+	data := testFile()
+	decoder, err := New(Options{SrcData: data[:13+11+10]})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	_, err = decoder.NextPage()
+	if !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Expected ErrTruncated, got %v", err)
+	}
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatalf("Expected a *DecodeError, got %T", err)
+	}
+	if de.Segment != 0 || de.Type != 48 || de.Stage != StageData || de.Offset != 13+11 {
+		t.Fatalf("Unexpected decode error details: %+v", de)
+	}
+}
+
+func TestDecoderPageInfoFlags(t *testing.T) {
+	var data []byte
+	data = append(data, segmentBytes(0, 48, 1, pageInfoBytes(10, 4, 0x77))...)
+	data = append(data, segmentBytes(1, 49, 1, nil)...)
+	decoder, err := New(Options{SrcData: data})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if decoder.FileHeader() != nil {
+		t.Fatal("Expected no file header for an embedded stream")
+	}
+	page, err := decoder.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	info := page.Info
+	if info.ResolutionX() != 300 || info.ResolutionY() != 300 {
+		t.Errorf("Unexpected resolution %dx%d", info.ResolutionX(), info.ResolutionY())
+	}
+	if x, y := info.DPI(); x != 7.62 || y != 7.62 {
+		t.Errorf("Unexpected DPI %vx%v", x, y)
+	}
+	if info.DefaultPixel() != 1 || info.Striped() || info.MaxStripeSize() != 0 {
+		t.Errorf("Unexpected default pixel or striping")
+	}
+	if !info.EventuallyLossless() || !info.MightContainRefinements() ||
+		!info.RequiresAuxiliaryBuffers() || !info.CombinationOperatorOverridden() {
+		t.Errorf("Expected every flag bit to be set")
+	}
+	if op := info.DefaultCombinationOperator(); op != CombinationXOR {
+		t.Errorf("Expected XOR default combination operator, got %v", op)
+	}
+	if infos := decoder.PageInfos(); len(infos) != 1 || infos[0].Width() != 10 {
+		t.Errorf("Unexpected page infos %v", infos)
+	}
+
+	var nilInfo *PageInfo
+	if nilInfo.EventuallyLossless() || nilInfo.DefaultCombinationOperator() != CombinationOR {
+		t.Error("Expected zero values from a nil PageInfo")
+	}
+}
+
+func TestDecoderFileHeader(t *testing.T) {
+	decoder, err := New(Options{SrcData: testFile()})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	header := decoder.FileHeader()
+	if !header.Sequential() || header.RandomAccess() {
+		t.Error("Expected a sequential file")
+	}
+	if n, known := header.NumPages(); !known || n != 1 {
+		t.Errorf("Expected one declared page, got %d (known %v)", n, known)
+	}
+}
+
+func TestDecoderDecodeRegion(t *testing.T) {
+	decoder, err := New(Options{SrcData: testFile()})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.DecodeRegion(image.Rectangle{}); err == nil {
+		t.Fatal("Expected an error for an empty region")
+	}
+	page, err := decoder.DecodeRegion(image.Rect(15, 3, 30, 7))
+	if err != nil {
+		t.Fatalf("DecodeRegion returned error: %v", err)
+	}
+	if page.Image.Width() != 6 || page.Image.Height() != 4 {
+		t.Fatalf("Expected a 6x4 image, got %dx%d", page.Image.Width(), page.Image.Height())
+	}
+	if page.Info.Width() != 21 || page.Info.Height() != 9 {
+		t.Errorf("Expected the page info of the whole page")
+	}
+	if got := page.Image.ColorIndexAt(5, 3); got != 1 {
+		t.Errorf("Expected the default pixel value 1, got %d", got)
+	}
+}
+
+func TestDecoderProgressCallbacks(t *testing.T) {
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x00, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+
+	var regions []RegionEvent
+	var rows int
+	decoder, err := New(Options{
+		SrcData:  testFile(segmentBytes(1, 38, 1, region)),
+		OnRegion: func(e RegionEvent) { regions = append(regions, e) },
+		OnRows:   func(e RowsEvent) { rows += e.Rect.Dy() },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if len(regions) != 1 {
+		t.Fatalf("Expected one region event, got %d", len(regions))
+	}
+	e := regions[0]
+	if e.Segment != 1 || e.Type != 38 || e.Rect != image.Rect(2, 1, 7, 4) {
+		t.Errorf("Unexpected region event %+v", e)
+	}
+	if e.Page.Bounds() != image.Rect(0, 0, 21, 9) {
+		t.Errorf("Unexpected page view bounds %v", e.Page.Bounds())
+	}
+	if rows != 3 {
+		t.Errorf("Expected 3 rows reported, got %d", rows)
+	}
+}
+
+func TestDecoderStripeWriter(t *testing.T) {
+	info := pageInfoBytes(21, 0xffffffff, 0x04)
+	binary.BigEndian.PutUint16(info[len(info)-2:], 0x8000|4)
+	var data []byte
+	data = append(data, segmentBytes(0, 48, 1, info)...)
+	data = append(data, segmentBytes(1, 50, 1, binary.BigEndian.AppendUint32(nil, 3))...)
+	data = append(data, segmentBytes(2, 50, 1, binary.BigEndian.AppendUint32(nil, 7))...)
+	data = append(data, segmentBytes(3, 49, 1, nil)...)
+	data = append(data, segmentBytes(4, 51, 0, nil)...)
+
+	var raster bytes.Buffer
+	var tops []int
+	decoder, err := New(Options{
+		SrcData:      data,
+		StripeWriter: &raster,
+		OnStripe: func(s Stripe) error {
+			tops = append(tops, s.Top)
+			if s.Image.Width() != 21 || s.Image.Height() != 4 {
+				t.Errorf("stripe at row %d is %dx%d", s.Top, s.Image.Width(), s.Image.Height())
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	page, err := decoder.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if page.Image.Height() != 0 {
+		t.Errorf("expected an empty page image, got %d rows", page.Image.Height())
+	}
+	if len(tops) != 2 || tops[0] != 0 || tops[1] != 4 {
+		t.Errorf("unexpected stripe rows %v", tops)
+	}
+	want := bytes.Repeat([]byte{0xff, 0xff, 0xf8}, 8)
+	if !bytes.Equal(raster.Bytes(), want) {
+		t.Errorf("unexpected raster % x", raster.Bytes())
+	}
+}
+
+func TestDecoderLiveBytes(t *testing.T) {
+	decoder, err := New(Options{SrcData: testFile()})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if got := decoder.LiveBytes(); got != 0 {
+		t.Errorf("expected no live bytes before decoding, got %d", got)
+	}
+	if _, err := decoder.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	// A 21x9 page with rows padded to 32 bits.
+	if got := decoder.LiveBytes(); got != 4*9 {
+		t.Errorf("expected %d live bytes, got %d", 4*9, got)
+	}
+}
+
+func TestDecoderStrictProfiles(t *testing.T) {
+	profiles := binary.BigEndian.AppendUint32(nil, 1)
+	profiles = binary.BigEndian.AppendUint32(profiles, uint32(ProfileLowComplexity))
+	// An arithmetic generic region breaks the low complexity profile.
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x00, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+	data := testFile(segmentBytes(1, 52, 0, profiles), segmentBytes(2, 38, 1, region))
+
+	for _, strict := range []bool{false, true} {
+		decoder, err := New(Options{SrcData: data, Strict: strict})
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		_, err = decoder.NextPage()
+		if strict != errors.Is(err, ErrProfileViolation) {
+			t.Errorf("strict %v: unexpected error %v", strict, err)
+		}
+		if got := decoder.Profiles(); len(got) != 1 || got[0] != ProfileLowComplexity || !got[0].Known() {
+			t.Errorf("strict %v: unexpected profiles %v", strict, got)
+		}
+	}
+}
+
+func TestDecoderComments(t *testing.T) {
+	comment := binary.BigEndian.AppendUint32(nil, 0x20000000)
+	comment = append(comment, "Software\x00scan 1.2\x00\x00"...)
+	necessary := binary.BigEndian.AppendUint32(nil, 0x80000010)
+
+	decoder, err := New(Options{SrcData: testFile(segmentBytes(1, 62, 1, comment))})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if got := decoder.Comments(); len(got) != 1 || got[0] != (Comment{Page: 1, Name: "Software", Value: "scan 1.2"}) {
+		t.Errorf("unexpected comments %+v", got)
+	}
+
+	decoder, err = New(Options{SrcData: testFile(segmentBytes(1, 62, 1, necessary))})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("expected ErrUnsupported for a necessary extension, got %v", err)
+	}
+}
+
+func TestDecoderColourPage(t *testing.T) {
+	decoder, err := New(Options{SrcData: testFile()})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	page, err := decoder.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if page.Info.ColourExtension() || page.Image.Colour() != nil {
+		t.Error("Expected no colour page for a bilevel page")
+	}
+
+	data := testFile()
+	data[13+11+16] |= 0x80 // page information flags of the first segment
+	decoder, err = New(Options{SrcData: data})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	page, err = decoder.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if !page.Info.ColourExtension() {
+		t.Error("Expected the colour extension flag")
+	}
+	colour := page.Image.Colour()
+	if colour == nil || colour.Bounds() != image.Rect(0, 0, 21, 9) {
+		t.Fatalf("Unexpected colour page %v", colour)
+	}
+	// The default pixel value 1 renders black.
+	if r, g, b, _ := colour.At(20, 8).RGBA(); r|g|b != 0 {
+		t.Errorf("Expected black pixels, got %v", colour.At(20, 8))
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if _, ok := img.(*image.RGBA); !ok {
+		t.Errorf("Expected image.Decode to return the colour page, got %T", img)
+	}
+}
+
+// recordingSink sums the measurements of a metrics observer.
+type recordingSink struct {
+	counters   map[string]float64
+	histograms map[string]int
+}
+
+func (s *recordingSink) AddCounter(name string, delta float64, labels map[string]string) {
+	s.counters[name+"/"+labels["type"]+"/"+labels["kind"]] += delta
+}
+
+func (s *recordingSink) ObserveHistogram(name string, value float64, labels map[string]string) {
+	s.histograms[name+"/"+labels["type"]]++
+}
+
+func TestDecoderMetricsObserver(t *testing.T) {
+	sink := &recordingSink{counters: map[string]float64{}, histograms: map[string]int{}}
+	decoder, err := New(Options{SrcData: testFile(), Observer: NewMetricsObserver(sink)})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if got := sink.counters[MetricSegments+"/page information/"]; got != 1 {
+		t.Errorf("Expected 1 page information segment, got %v", got)
+	}
+	if got := sink.histograms[MetricSegmentBytes+"/end of page"]; got != 1 {
+		t.Errorf("Expected 1 end of page size observation, got %d", got)
+	}
+	if got := sink.counters[MetricPages+"//"]; got != 1 {
+		t.Errorf("Expected 1 completed page, got %v", got)
+	}
+
+	data := testFile(segmentBytes(1, 62, 1, binary.BigEndian.AppendUint32(nil, 0x80000010)))
+	decoder, err = New(Options{SrcData: data, Observer: NewMetricsObserver(sink)})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); err == nil {
+		t.Fatal("Expected an error for a necessary extension")
+	}
+	if got := sink.counters[MetricSegmentErrors+"/extension/unsupported"]; got != 1 {
+		t.Errorf("Expected 1 unsupported extension error, got %v", got)
+	}
+}
+
+func TestDecoderLogger(t *testing.T) {
+	var buf bytes.Buffer
+	decoder, err := New(Options{
+		SrcData: testFile(segmentBytes(1, 33, 1, []byte{0xde, 0xad})),
+		Logger:  slog.New(slog.NewTextHandler(&buf, nil)),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if got := buf.String(); !strings.Contains(got, `msg="unknown segment type skipped" segment=1 type=33`) {
+		t.Errorf("Unexpected log output %q", got)
+	}
+}
+
+func TestDecoderSharedGlobals(t *testing.T) {
+	comment := binary.BigEndian.AppendUint32(nil, 0x20000000)
+	comment = append(comment, "Producer\x00test\x00\x00"...)
+	globals, err := ParseGlobals(segmentBytes(0, 62, 0, comment), GlobalsOptions{})
+	if err != nil {
+		t.Fatalf("ParseGlobals returned error: %v", err)
+	}
+	defer globals.Release()
+	if len(globals.Segments()) != 1 {
+		t.Fatalf("Expected 1 global segment, got %d", len(globals.Segments()))
+	}
+
+	decoders := make([]*Decoder, 3)
+	for i := range decoders {
+		decoders[i], err = New(Options{SrcData: testFile(), Globals: globals})
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+	}
+	if got := globals.Refs(); got != 4 {
+		t.Errorf("Expected 4 references, got %d", got)
+	}
+	for _, d := range decoders {
+		if _, err := d.NextPage(); err != nil {
+			t.Fatalf("NextPage returned error: %v", err)
+		}
+		if got := d.Comments(); len(got) != 1 || got[0].Name != "Producer" {
+			t.Errorf("Unexpected comments %+v", got)
+		}
+		d.Close()
+		d.Close()
+	}
+	if got := globals.Refs(); got != 1 {
+		t.Errorf("Expected 1 reference after closing the decoders, got %d", got)
+	}
+
+	if _, err := New(Options{SrcData: testFile(), GlobalData: []byte{0}, Globals: globals}); err == nil {
+		t.Error("Expected an error when both GlobalData and Globals are set")
+	}
+}
+
+func TestDecoderSharedDocumentContext(t *testing.T) {
+	// A Huffman-coded symbol dictionary without symbols.
+	globals := segmentBytes(0, 0, 0, []byte{0x00, 0x01, 0, 0, 0, 0, 0, 0, 0, 0})
+	doc := NewDocumentContext(DocumentContextOptions{MaxEntries: 8})
+
+	decode := func() error {
+		decoder, err := New(Options{SrcData: testFile(), GlobalData: globals, GlobalKey: 7, DocumentContext: doc})
+		if err != nil {
+			return err
+		}
+		_, err = decoder.NextPage()
+		return err
+	}
+	if err := decode(); err != nil {
+		t.Fatalf("Decoding failed: %v", err)
+	}
+	done := make(chan error, 3)
+	for range 3 {
+		go func() { done <- decode() }()
+	}
+	for range 3 {
+		if err := <-done; err != nil {
+			t.Fatalf("Decoding failed: %v", err)
+		}
+	}
+	if stats := doc.Stats(); stats.Hits != 3 || stats.Misses != 1 || stats.Entries != 1 {
+		t.Errorf("Unexpected cache statistics %+v", stats)
+	}
+}
+
+func TestDecoderRecover(t *testing.T) {
+	damaged := binary.BigEndian.AppendUint32(nil, 8)
+	damaged = binary.BigEndian.AppendUint32(damaged, 4)
+	damaged = binary.BigEndian.AppendUint32(damaged, 10)
+	damaged = binary.BigEndian.AppendUint32(damaged, 3)
+	damaged = append(damaged, 0x00, 0x11, 0, 0, 0, 0, 0, 0, 0, 0) // empty skip bitmap
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x00, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+	data := testFile(segmentBytes(1, 38, 1, damaged), segmentBytes(2, 38, 1, region))
+
+	decoder, err := New(Options{SrcData: data})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.NextPage(); err == nil {
+		t.Fatal("Expected an error without Recover")
+	}
+
+	var regions int
+	decoder, err = New(Options{
+		SrcData:  data,
+		Recover:  true,
+		OnRegion: func(RegionEvent) { regions++ },
+	})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	page, err := decoder.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if regions != 1 {
+		t.Errorf("Expected the intact region to be composed, got %d region events", regions)
+	}
+	if len(page.Damage) != 1 {
+		t.Fatalf("Expected one damage report, got %d", len(page.Damage))
+	}
+	d := page.Damage[0]
+	if d.Segment != 1 || d.Type != 38 || d.Page != 1 || d.Rect != image.Rect(10, 3, 18, 7) || d.Err == nil {
+		t.Errorf("Unexpected damage %+v", d)
+	}
+	if got := decoder.Damage(); len(got) != 1 || got[0].Segment != 1 {
+		t.Errorf("Unexpected decoder damage %+v", got)
+	}
+	if _, err := decoder.NextPage(); err != io.EOF {
+		t.Errorf("Expected io.EOF after the last page, got %v", err)
+	}
+}
+
+func TestDecoderMarshalStateResume(t *testing.T) {
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x00, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+	data := testFile(segmentBytes(1, 38, 1, region))
+
+	ref, err := New(Options{SrcData: data})
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	want, err := ref.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+
+	opts := Options{SrcData: data, Pause: func() bool { return true }}
+	decoder, err := New(opts)
+	if err != nil {
+		t.Fatalf("Failed to create decoder: %v", err)
+	}
+	if _, err := decoder.GetFirstPage(make([]byte, 4*9), 21, 9, 4); err != nil {
+		t.Fatalf("GetFirstPage returned error: %v", err)
+	}
+	resumes := 0
+	for decoder.GetProcessingStatus() == CodecStatusToBeContinued {
+		state, err := decoder.MarshalState()
+		if err != nil {
+			t.Fatalf("MarshalState returned error: %v", err)
+		}
+		if decoder, err = ResumeDecoder(state, opts); err != nil {
+			t.Fatalf("ResumeDecoder returned error: %v", err)
+		}
+		resumes++
+		if _, err := decoder.Continue(); err != nil {
+			t.Fatalf("Continue returned error: %v", err)
+		}
+	}
+	if resumes < 3 {
+		t.Errorf("Expected a resume within each region row, got %d resumes", resumes)
+	}
+	got := decoder.GetPageImage()
+	if got == nil || got.Bounds() != want.Image.Bounds() {
+		t.Fatalf("Unexpected resumed page %v", got)
+	}
+	for y := 0; y < 9; y++ {
+		for x := 0; x < 21; x++ {
+			if got.ColorIndexAt(x, y) != want.Image.ColorIndexAt(x, y) {
+				t.Fatalf("Resumed page differs at (%d, %d)", x, y)
+			}
+		}
+	}
+
+	if _, err := ResumeDecoder([]byte("JB2S"), opts); err == nil {
+		t.Error("Expected an error for a truncated state")
+	}
+}
+
+func TestDecoderReleaseResults(t *testing.T) {
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x00, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+	data := testFile(segmentBytes(1, 36, 1, region))
+
+	for _, release := range []bool{false, true} {
+		decoder, err := New(Options{SrcData: data, ReleaseResults: release})
+		if err != nil {
+			t.Fatalf("Failed to create decoder: %v", err)
+		}
+		if _, err := decoder.NextPage(); err != nil {
+			t.Fatalf("NextPage returned error: %v", err)
+		}
+		var img *Image
+		for _, seg := range decoder.GetSegments() {
+			if seg.Number() == 1 {
+				img = seg.Image()
+			}
+		}
+		if kept := img != nil; kept == release {
+			t.Errorf("ReleaseResults %v: intermediate region kept %v after the page", release, kept)
+		}
+	}
+}
+
+func TestParseGlobalsOptions(t *testing.T) {
+	comment := binary.BigEndian.AppendUint32(nil, 0x20000000)
+	comment = append(comment, "Producer\x00test\x00\x00"...)
+	data := append(segmentBytes(0, 62, 0, comment), segmentBytes(1, 33, 0, []byte{1, 2, 3})...)
+	if _, err := ParseGlobals(data, GlobalsOptions{Limits: Limits{MaxSegments: 1}}); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded over the segment limit, got %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ParseGlobalsContext(ctx, data, GlobalsOptions{}); !errors.Is(err, context.Canceled) {
+		t.Errorf("Expected an error matching context.Canceled, got %v", err)
+	}
+	var buf bytes.Buffer
+	globals, err := ParseGlobals(data, GlobalsOptions{Logger: slog.New(slog.NewTextHandler(&buf, nil))})
+	if err != nil {
+		t.Fatalf("ParseGlobals returned error: %v", err)
+	}
+	defer globals.Release()
+	if !strings.Contains(buf.String(), "unknown segment type skipped") {
+		t.Errorf("Unexpected log output %q", buf.String())
+	}
+}
@@ -0,0 +1,62 @@
+package jbig2
+
+import "github.com/jdeng/gojbig2/internal/jbig2"
+
+// DocumentContext is a cache of decoded symbol dictionaries shared by the
+// decoders of one document, such as the image streams of a PDF that refer
+// to the same JBIG2Globals stream. It is safe for concurrent use, so pages
+// may be decoded in parallel while sharing it through
+// Options.DocumentContext.
+//
+// Dictionaries of global data are cached when Options.GlobalKey is
+// nonzero; the key must identify the global data stream within the
+// document, for example its PDF object number. The least recently used
+// dictionaries are evicted once the entry or byte limits are exceeded.
+type DocumentContext struct {
+	dc *jbig2.DocumentContext
+}
+
+// DocumentContextOptions configures the limits of a DocumentContext.
+type DocumentContextOptions struct {
+	// MaxEntries bounds the number of cached dictionaries. Zero selects
+	// the default of two.
+	MaxEntries int
+	// MaxBytes bounds the storage of the cached symbol bitmaps and
+	// arithmetic coding contexts. Zero imposes no bound.
+	MaxBytes uint64
+}
+
+// CacheStats reports the activity of a DocumentContext.
+type CacheStats struct {
+	// Hits and Misses count the lookups that did and did not find a
+	// dictionary.
+	Hits, Misses uint64
+	// Evictions counts the dictionaries dropped to respect the limits.
+	Evictions uint64
+	// Entries and Bytes describe the current contents.
+	Entries int
+	Bytes   uint64
+}
+
+// NewDocumentContext returns an empty document context with the given
+// limits.
+func NewDocumentContext(opts DocumentContextOptions) *DocumentContext {
+	return &DocumentContext{dc: jbig2.NewDocumentContextWithLimits(opts.MaxEntries, opts.MaxBytes)}
+}
+
+// Stats returns the cache statistics accumulated so far.
+func (d *DocumentContext) Stats() CacheStats {
+	if d == nil || d.dc == nil {
+		return CacheStats{}
+	}
+	s := d.dc.Stats()
+	return CacheStats{Hits: s.Hits, Misses: s.Misses, Evictions: s.Evictions, Entries: s.Entries, Bytes: s.Bytes}
+}
+
+// internal returns the decoder-side context, nil when d is nil.
+func (d *DocumentContext) internal() *jbig2.DocumentContext {
+	if d == nil {
+		return nil
+	}
+	return d.dc
+}
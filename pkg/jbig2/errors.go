@@ -0,0 +1,40 @@
+package jbig2
+
+import "github.com/jdeng/gojbig2/internal/jbig2"
+
+// Sentinel errors classifying decode failures. Errors from the decoder are
+// usually wrapped in a *DecodeError; test for these with errors.Is.
+var (
+	// ErrTruncated reports that the data ended before a structure was
+	// complete.
+	ErrTruncated = jbig2.ErrTruncated
+	// ErrCorrupt reports data that violates the JBIG2 format.
+	ErrCorrupt = jbig2.ErrCorrupt
+	// ErrUnsupported reports a valid feature the decoder does not implement.
+	ErrUnsupported = jbig2.ErrUnsupported
+	// ErrLimitExceeded reports that the stream needs more resources than
+	// Options.Limits allow.
+	ErrLimitExceeded = jbig2.ErrLimitExceeded
+	// ErrProfileViolation reports, with Options.Strict, a stream that
+	// breaks the restrictions of a profile it declares.
+	ErrProfileViolation = jbig2.ErrProfileViolation
+)
+
+// DecodeError describes a failure while processing a segment: the segment
+// number, type and page association, the byte offset in the input, and the
+// stage that failed. Retrieve it with errors.As; it unwraps to the underlying
+// error, which matches one of the sentinel errors unless decoding was
+// cancelled.
+type DecodeError = jbig2.DecodeError
+
+// ErrorStage identifies the step of segment processing that failed.
+type ErrorStage = jbig2.ErrorStage
+
+const (
+	// StageHeader covers parsing the segment header.
+	StageHeader = jbig2.StageHeader
+	// StageData covers decoding the segment data.
+	StageData = jbig2.StageData
+	// StageCompose covers composing a decoded region onto the page.
+	StageCompose = jbig2.StageCompose
+)
@@ -0,0 +1,131 @@
+package jbig2
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+func init() {
+	image.RegisterFormat("jbig2", jbig2.FileSignature, Decode, DecodeConfig)
+}
+
+// decodeLimits are the resource limits Decode applies. Decode is reached
+// through image.Decode, typically on untrusted input, so it refuses pages
+// and dictionaries far beyond what real documents need. Callers wanting
+// other limits use New with Options.Limits.
+var decodeLimits = Limits{
+	MaxPagePixels:     1 << 28,
+	MaxRegionPixels:   1 << 28,
+	MaxSymbolsPerDict: 1 << 16,
+	MaxSymbolBytes:    64 << 20,
+	MaxTextInstances:  1 << 20,
+	MaxSegments:       1 << 16,
+	MaxAllocBytes:     256 << 20,
+	MaxBufferBytes:    64 << 20,
+}
+
+// readInput reads r to the end, failing with an error matching
+// ErrLimitExceeded once it holds more than max bytes.
+func readInput(r io.Reader, max uint64) ([]byte, error) {
+	data, err := io.ReadAll(io.LimitReader(r, int64(max)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) > max {
+		return nil, inputLimitError(max)
+	}
+	return data, nil
+}
+
+func inputLimitError(max uint64) error {
+	return fmt.Errorf("%w: input exceeds %d bytes", ErrLimitExceeded, max)
+}
+
+// Decode reads a standalone JBIG2 file from r and returns its first page,
+// as an *image.RGBA when the page announces the colour extension and as an
+// *Image otherwise, matching the colour model DecodeConfig reports.
+// It is registered with image.Decode under the format name "jbig2". Inputs
+// over 64 MiB, pages over 2^28 pixels, or decodes allocating over 256 MiB,
+// fail with an error matching ErrLimitExceeded.
+func Decode(r io.Reader) (image.Image, error) {
+	data, err := readInput(r, decodeLimits.MaxBufferBytes)
+	if err != nil {
+		return nil, err
+	}
+	decoder, err := New(Options{SrcData: data, Limits: decodeLimits})
+	if err != nil {
+		return nil, err
+	}
+	page, err := decoder.NextPage()
+	if err == io.EOF {
+		return nil, errors.New("jbig2: stream contains no pages")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if colour := page.Image.Colour(); colour != nil && page.Info.ColourExtension() {
+		return colour, nil
+	}
+	return page.Image, nil
+}
+
+// configReadSize is the first read of DecodeConfig; later reads double the
+// buffered bytes until the page information is complete.
+const configReadSize = 4096
+
+// DecodeConfig returns the colour model and dimensions of the first page in
+// the JBIG2 file read from r. The colour model is color.RGBAModel for pages
+// announcing the colour extension and Palette otherwise. Only segment
+// headers and the page information segment are parsed, and r is read no
+// further than they need, up to 64 MiB; past that DecodeConfig fails with
+// an error matching ErrLimitExceeded. The height of a striped page declared
+// of unknown height is only known once the page is decoded, so such pages
+// fail with an error matching ErrUnsupported.
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	max := decodeLimits.MaxBufferBytes
+	r = io.LimitReader(r, int64(max)+1)
+	var data []byte
+	var info *jbig2.PageInfo
+	for size := configReadSize; ; size *= 2 {
+		n := len(data)
+		data = append(data, make([]byte, min(size, int(max)+1)-n)...)
+		m, err := io.ReadFull(r, data[n:])
+		data = data[:n+m]
+		if uint64(len(data)) > max {
+			return image.Config{}, inputLimitError(max)
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if info, err = jbig2.DeclaredPageInfo(data, true); err != nil {
+				return image.Config{}, err
+			}
+			break
+		}
+		if err != nil {
+			return image.Config{}, err
+		}
+		info, err = jbig2.DeclaredPageInfo(data, false)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, ErrNeedMoreData) && !errors.Is(err, ErrTruncated) {
+			return image.Config{}, err
+		}
+	}
+	if info.Height == 0xffffffff {
+		return image.Config{}, fmt.Errorf("%w: page of unknown height", ErrUnsupported)
+	}
+	model := color.Model(Palette())
+	if info.ColourExtension {
+		model = color.RGBAModel
+	}
+	return image.Config{
+		ColorModel: model,
+		Width:      int(info.Width),
+		Height:     int(info.Height),
+	}, nil
+}
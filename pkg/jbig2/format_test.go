@@ -0,0 +1,154 @@
+package jbig2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"io"
+	"testing"
+)
+
+// testFile returns a single-page sequential file with the given segments
+// placed between the page information and end-of-page segments.
+func testFile(segments ...[]byte) []byte {
+	data := []byte("\x97JB2\r\n\x1a\n\x01\x00\x00\x00\x01")
+	data = append(data, segmentBytes(0, 48, 1, pageInfoBytes(21, 9, 0x04))...)
+	for _, seg := range segments {
+		data = append(data, seg...)
+	}
+	data = append(data, segmentBytes(10, 49, 1, nil)...)
+	return append(data, segmentBytes(11, 51, 0, nil)...)
+}
+
+func TestImageDecodeConfig(t *testing.T) {
+	// Region data after the page information must not be decoded.
+	data := testFile(segmentBytes(1, 38, 1, []byte{0xde, 0xad}))
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("DecodeConfig returned error: %v", err)
+	}
+	if format != "jbig2" {
+		t.Errorf("Unexpected format %q", format)
+	}
+	if cfg.Width != 21 || cfg.Height != 9 || cfg.ColorModel == nil {
+		t.Errorf("Unexpected config %+v", cfg)
+	}
+}
+
+// failingReader yields data and then fails, so that reading past data shows.
+type failingReader struct{ data []byte }
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		return 0, errors.New("read past the page information")
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDecodeConfigReadsIncrementally(t *testing.T) {
+	// The height of a striped page of unknown height is not known from its
+	// page information; the stripes and the large region that follows
+	// must not be read to find it.
+	info := pageInfoBytes(21, 0xffffffff, 0x00)
+	binary.BigEndian.PutUint16(info[17:], 0x8010)
+	data := []byte("\x97JB2\r\n\x1a\n\x01\x00\x00\x00\x01")
+	data = append(data, segmentBytes(0, 48, 1, info)...)
+	data = append(data, segmentBytes(1, 50, 1, binary.BigEndian.AppendUint32(nil, 15))...)
+	data = append(data, segmentBytes(2, 50, 1, binary.BigEndian.AppendUint32(nil, 31))...)
+	data = append(data, segmentBytes(3, 49, 1, nil)...)
+	data = append(data, make([]byte, 3*configReadSize)...)
+
+	if _, err := DecodeConfig(&failingReader{data: data[:configReadSize]}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("DecodeConfig of a page of unknown height returned %v, want ErrUnsupported", err)
+	}
+
+	// A page information segment split across reads is completed.
+	short := testFile()[:20]
+	cfg, err := DecodeConfig(io.MultiReader(bytes.NewReader(short), bytes.NewReader(testFile()[20:])))
+	if err != nil || cfg.Width != 21 || cfg.Height != 9 {
+		t.Errorf("DecodeConfig across reads = %+v, %v", cfg, err)
+	}
+	if _, err := DecodeConfig(bytes.NewReader(short)); !errors.Is(err, ErrTruncated) {
+		t.Errorf("DecodeConfig of a truncated file returned %v, want ErrTruncated", err)
+	}
+}
+
+// zeroReader yields zero bytes without end.
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+func TestDecodeLimitsInput(t *testing.T) {
+	// A 1 GiB segment, never ending, before the page information.
+	data := []byte("\x97JB2\r\n\x1a\n\x01\x00\x00\x00\x01")
+	data = append(data, segmentBytes(0, 38, 1, nil)...)
+	binary.BigEndian.PutUint32(data[len(data)-4:], 1<<30)
+	if _, err := DecodeConfig(io.MultiReader(bytes.NewReader(data), zeroReader{})); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("DecodeConfig of endless input returned %v, want ErrLimitExceeded", err)
+	}
+	if _, err := Decode(io.MultiReader(bytes.NewReader(data), zeroReader{})); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Decode of endless input returned %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestDecodeAppliesLimits(t *testing.T) {
+	data := []byte("\x97JB2\r\n\x1a\n\x01\x00\x00\x00\x01")
+	data = append(data, segmentBytes(0, 48, 1, pageInfoBytes(1<<15, 1<<14, 0x00))...)
+	data = append(data, segmentBytes(1, 49, 1, nil)...)
+	if _, err := Decode(bytes.NewReader(data)); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Decode of a 2^29 pixel page returned %v, want ErrLimitExceeded", err)
+	}
+}
+
+func TestImageDecode(t *testing.T) {
+	img, format, err := image.Decode(bytes.NewReader(testFile()))
+	if err != nil {
+		t.Fatalf("Decode returned error: %v", err)
+	}
+	if format != "jbig2" {
+		t.Errorf("Unexpected format %q", format)
+	}
+	if img.Bounds() != image.Rect(0, 0, 21, 9) {
+		t.Errorf("Unexpected bounds %v", img.Bounds())
+	}
+	if img.At(20, 8) != palette[1] {
+		t.Error("Expected default pixel value 1 across the page")
+	}
+}
+
+func TestDecodeMatchesDecodeConfig(t *testing.T) {
+	// A coloured region on a page not announcing the colour extension.
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x08, 0x00, 0x00, 0xff, 0xff)
+	region = append(region, 0x00, 3, 0xff, 0xfd, 0xff, 2, 0xfe, 0xfe, 0xfe)
+	region = append(region, 0x5a, 0x3c, 0x96, 0x00, 0xff, 0xac)
+	colours := []byte{0, 0, 1, 0xff, 0, 0}
+
+	for _, flags := range []byte{0x00, 0x80} {
+		data := testFile(segmentBytes(1, 54, 1, colours), segmentBytes(2, 38, 1, region))
+		data[13+11+16] |= flags
+		cfg, err := DecodeConfig(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("DecodeConfig returned error: %v", err)
+		}
+		img, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatalf("Decode returned error: %v", err)
+		}
+		_, rgba := img.(*image.RGBA)
+		if rgba != (cfg.ColorModel == color.RGBAModel) {
+			t.Errorf("page flags %#x: Decode returned %T, DecodeConfig reported %v", flags, img, cfg.ColorModel)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package jbig2
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// Globals is a JBIG2 global data stream, such as the JBIG2Globals stream of
+// a PDF, decoded once so that any number of decoders can share it through
+// Options.Globals, including decoders running concurrently. Its symbol
+// dictionaries and tables are never copied or modified by the decoders.
+//
+// Globals are reference counted. ParseGlobals returns them with one
+// reference owned by the caller, which drops it with Release, and every
+// decoder created with them holds another until its Close method is
+// called. When the last reference is gone the decoded dictionaries are
+// freed.
+type Globals struct {
+	g *jbig2.Globals
+}
+
+// GlobalsOptions configures ParseGlobals.
+type GlobalsOptions struct {
+	// Limits bounds the resources decoding the global data stream may use,
+	// as Options.Limits does for a decoder. The decoded dictionaries stay
+	// charged against MaxAllocBytes until the last reference is released.
+	Limits Limits
+	// Logger, when set, receives a warning for every non-fatal anomaly in
+	// the global data stream; see Options.Logger.
+	Logger *slog.Logger
+}
+
+// ParseGlobals decodes the global data stream data.
+func ParseGlobals(data []byte, opts GlobalsOptions) (*Globals, error) {
+	g, err := jbig2.ParseGlobals(data, opts.internal())
+	if err != nil {
+		return nil, err
+	}
+	return &Globals{g: g}, nil
+}
+
+// ParseGlobalsContext is like ParseGlobals but stops as soon as ctx is done;
+// see Decoder.DecodeAllContext for the error returned.
+func ParseGlobalsContext(ctx context.Context, data []byte, opts GlobalsOptions) (*Globals, error) {
+	g, err := jbig2.ParseGlobalsContext(ctx, data, opts.internal())
+	if err != nil {
+		return nil, err
+	}
+	return &Globals{g: g}, nil
+}
+
+// internal maps opts to the options of the internal parser.
+func (opts GlobalsOptions) internal() jbig2.GlobalsOptions {
+	return jbig2.GlobalsOptions{
+		Limits: opts.Limits.internal(),
+		Logger: opts.Logger,
+	}
+}
+
+// Release drops the reference returned by ParseGlobals. Decoders already
+// created with g keep working until they are closed.
+func (g *Globals) Release() {
+	if g != nil && g.g != nil {
+		g.g.Release()
+	}
+}
+
+// Refs returns the number of references held: the caller's reference, if
+// not yet released, plus one per open decoder.
+func (g *Globals) Refs() int {
+	if g == nil || g.g == nil {
+		return 0
+	}
+	return g.g.Refs()
+}
+
+// LiveBytes returns the bitmap storage held by the decoded dictionaries.
+// It is not included in the LiveBytes of the decoders sharing g, but it is
+// charged against the Limits of each of them.
+func (g *Globals) LiveBytes() uint64 {
+	if g == nil || g.g == nil {
+		return 0
+	}
+	return g.g.LiveBytes()
+}
+
+// Segments returns the segments of the global data stream.
+func (g *Globals) Segments() []*Segment {
+	if g == nil || g.g == nil {
+		return nil
+	}
+	internalSegments := g.g.Segments()
+	segments := make([]*Segment, len(internalSegments))
+	for i, seg := range internalSegments {
+		segments[i] = &Segment{seg: seg}
+	}
+	return segments
+}
+
+// internal returns the decoder-side globals, nil when g is nil.
+func (g *Globals) internal() *jbig2.Globals {
+	if g == nil {
+		return nil
+	}
+	return g.g
+}
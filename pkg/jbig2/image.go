@@ -0,0 +1,98 @@
+package jbig2
+
+import (
+	"image"
+	"image/color"
+)
+
+// palette maps JBIG2 pixel values to colours: 0 is white background and 1 is
+// black foreground.
+var palette = color.Palette{color.Gray{Y: 0xff}, color.Gray{Y: 0x00}}
+
+// Palette returns the two-entry palette mapping JBIG2 pixel values to
+// colours: 0 is white background and 1 is black foreground. Each call
+// returns a new copy, so callers may modify it freely.
+func Palette() color.Palette {
+	return append(color.Palette(nil), palette...)
+}
+
+var _ image.PalettedImage = (*Image)(nil)
+
+// ColorModel implements image.Image using the two-entry Palette.
+func (img *Image) ColorModel() color.Model { return Palette() }
+
+// Bounds implements image.Image. The origin is always (0, 0).
+func (img *Image) Bounds() image.Rectangle {
+	return image.Rect(0, 0, img.Width(), img.Height())
+}
+
+// At implements image.Image.
+func (img *Image) At(x, y int) color.Color {
+	return palette[img.ColorIndexAt(x, y)]
+}
+
+// ColorIndexAt implements image.PalettedImage and returns the raw pixel value
+// at (x, y); coordinates outside the image read as 0.
+func (img *Image) ColorIndexAt(x, y int) uint8 {
+	if img == nil || img.img == nil {
+		return 0
+	}
+	return uint8(img.img.GetPixel(int32(x), int32(y)))
+}
+
+// Colour returns the colour rendering of the page when the stream uses the
+// T.88 colour extension, and nil for bilevel pages. Coloured regions are
+// painted with their palette colours and other set pixels in black; the
+// image.Image methods of Image keep describing the bilevel page.
+func (img *Image) Colour() *image.RGBA {
+	if img == nil {
+		return nil
+	}
+	return img.colour
+}
+
+// ToGray converts the bitmap to an 8-bit grayscale image with white
+// background and black foreground.
+func (img *Image) ToGray() *image.Gray {
+	dst := image.NewGray(img.Bounds())
+	img.expand(dst.Pix, dst.Stride, 0xff, 0x00)
+	return dst
+}
+
+// ToPaletted converts the bitmap to a paletted image using Palette, so pixel
+// indices equal the JBIG2 pixel values.
+func (img *Image) ToPaletted() *image.Paletted {
+	dst := image.NewPaletted(img.Bounds(), Palette())
+	img.expand(dst.Pix, dst.Stride, 0, 1)
+	return dst
+}
+
+// ToAlpha converts the bitmap to an alpha mask in which foreground pixels are
+// opaque and background pixels are transparent, for use with image/draw.
+func (img *Image) ToAlpha() *image.Alpha {
+	dst := image.NewAlpha(img.Bounds())
+	img.expand(dst.Pix, dst.Stride, 0x00, 0xff)
+	return dst
+}
+
+// expand writes one byte per pixel into dst, using zero and one for the two
+// pixel values.
+func (img *Image) expand(dst []byte, dstStride int, zero, one byte) {
+	if img == nil || img.img == nil {
+		return
+	}
+	width, height := img.Width(), img.Height()
+	data := img.img.Data()
+	stride := img.img.Stride()
+	for y := 0; y < height; y++ {
+		src := data[y*stride : y*stride+stride]
+		row := dst[y*dstStride : y*dstStride+width]
+		for x := range row {
+			if src[x>>3]&(0x80>>uint(x&7)) != 0 {
+				row[x] = one
+			} else {
+				row[x] = zero
+			}
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package jbig2
+
+import (
+	"image"
+	"image/color"
+	"testing"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+func testImage() *Image {
+	img := jbig2.NewImage(11, 3)
+	img.SetPixel(0, 0, 1)
+	img.SetPixel(9, 1, 1)
+	img.SetPixel(10, 2, 1)
+	return &Image{img: img}
+}
+
+func TestImageImplementsImage(t *testing.T) {
+	var img image.Image = testImage()
+	if got := img.Bounds(); got != image.Rect(0, 0, 11, 3) {
+		t.Fatalf("Unexpected bounds %v", got)
+	}
+	if got := img.At(0, 0); got != palette[1] {
+		t.Errorf("Expected black at (0,0), got %v", got)
+	}
+	if got := img.At(1, 0); got != palette[0] {
+		t.Errorf("Expected white at (1,0), got %v", got)
+	}
+	if got := img.At(-1, 0); got != palette[0] {
+		t.Errorf("Expected white outside bounds, got %v", got)
+	}
+}
+
+func TestImageConversions(t *testing.T) {
+	img := testImage()
+	gray := img.ToGray()
+	paletted := img.ToPaletted()
+	alpha := img.ToAlpha()
+	for y := 0; y < 3; y++ {
+		for x := 0; x < 11; x++ {
+			set := img.ColorIndexAt(x, y) == 1
+			wantGray := uint8(0xff)
+			wantAlpha := uint8(0x00)
+			if set {
+				wantGray, wantAlpha = 0x00, 0xff
+			}
+			if got := gray.GrayAt(x, y); got != (color.Gray{Y: wantGray}) {
+				t.Errorf("ToGray(%d,%d) = %v, want %d", x, y, got, wantGray)
+			}
+			if got := paletted.ColorIndexAt(x, y); got != img.ColorIndexAt(x, y) {
+				t.Errorf("ToPaletted(%d,%d) = %d", x, y, got)
+			}
+			if got := alpha.AlphaAt(x, y); got.A != wantAlpha {
+				t.Errorf("ToAlpha(%d,%d) = %d, want %d", x, y, got.A, wantAlpha)
+			}
+		}
+	}
+}
+
+func TestPaletteIsACopy(t *testing.T) {
+	p := Palette()
+	p[0] = color.Gray{Y: 0x80}
+	img := testImage()
+	if got := img.At(1, 0); got != (color.Gray{Y: 0xff}) {
+		t.Errorf("Modifying a returned palette changed At to %v", got)
+	}
+	model := img.ColorModel().(color.Palette)
+	model[1] = color.Gray{Y: 0x80}
+	if got := img.At(0, 0); got != (color.Gray{Y: 0x00}) {
+		t.Errorf("Modifying the colour model changed At to %v", got)
+	}
+}
@@ -0,0 +1,45 @@
+package jbig2
+
+import "github.com/jdeng/gojbig2/internal/jbig2"
+
+// Limits bounds the resources a decode may use, for example when decoding
+// untrusted input. A zero field leaves that resource unlimited apart from the
+// decoder's built-in sanity checks.
+type Limits struct {
+	// MaxPagePixels bounds the pixel count of a page. Striped pages of
+	// unknown height are checked as they grow.
+	MaxPagePixels uint64
+	// MaxRegionPixels bounds the pixel count of a single region, and of the
+	// grid of a halftone region.
+	MaxRegionPixels uint64
+	// MaxSymbolsPerDict bounds the new and exported symbols of one symbol
+	// dictionary.
+	MaxSymbolsPerDict uint32
+	// MaxSymbolBytes bounds the bitmap storage of all decoded symbols.
+	MaxSymbolBytes uint64
+	// MaxTextInstances bounds the symbol instances of one text region.
+	MaxTextInstances uint32
+	// MaxSegments bounds the number of segments parsed.
+	MaxSegments uint32
+	// MaxAllocBytes bounds the bitmap storage the decoder holds at once,
+	// counting pages, regions, symbols, patterns and halftone planes.
+	// Storage is counted until the decoder drops it: a region once composed
+	// onto the page or its segment released, a page once the next starts.
+	MaxAllocBytes uint64
+	// MaxBufferBytes bounds the bytes a StreamDecoder holds while a segment,
+	// or a random-access file, has not fully arrived. Zero selects 256 MiB.
+	MaxBufferBytes uint64
+}
+
+func (l Limits) internal() jbig2.Limits {
+	return jbig2.Limits{
+		MaxPagePixels:     l.MaxPagePixels,
+		MaxRegionPixels:   l.MaxRegionPixels,
+		MaxSymbolsPerDict: l.MaxSymbolsPerDict,
+		MaxSymbolBytes:    l.MaxSymbolBytes,
+		MaxTextInstances:  l.MaxTextInstances,
+		MaxSegments:       l.MaxSegments,
+		MaxAllocBytes:     l.MaxAllocBytes,
+		MaxBufferBytes:    l.MaxBufferBytes,
+	}
+}
@@ -0,0 +1,24 @@
+package jbig2
+
+import "github.com/jdeng/gojbig2/internal/jbig2"
+
+// Comment is a name/value pair from an ASCII or UCS-2 comment extension
+// segment.
+type Comment struct {
+	// Page is the page association of the extension segment; 0 for
+	// comments that apply to the whole document.
+	Page  uint32
+	Name  string
+	Value string
+}
+
+func newComments(comments []jbig2.Comment) []Comment {
+	if len(comments) == 0 {
+		return nil
+	}
+	out := make([]Comment, len(comments))
+	for i, c := range comments {
+		out[i] = Comment{Page: c.Page, Name: c.Name, Value: c.Value}
+	}
+	return out
+}
@@ -0,0 +1,134 @@
+package jbig2
+
+import (
+	"errors"
+	"time"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// SegmentEvent identifies the segment an Observer hook reports on.
+type SegmentEvent struct {
+	// Number is the segment number.
+	Number uint32
+	// Type is the segment type.
+	Type uint8
+	// Page is the page association of the segment, 0 for global segments.
+	Page uint32
+}
+
+// TypeName returns the name T.88 gives the segment type, such as
+// "immediate generic region".
+func (e SegmentEvent) TypeName() string {
+	return jbig2.SegmentTypeName(e.Type)
+}
+
+// Observer receives tracing hooks as segments are decoded. Every segment
+// whose header parses is reported once by SegmentStart and once by
+// SegmentEnd, including the segments of the global data. The hooks run on
+// the decoding goroutine and should return quickly.
+type Observer interface {
+	// SegmentStart is called after the header of seg has been parsed.
+	SegmentStart(seg SegmentEvent)
+	// SegmentEnd is called when seg has been decoded, with a nil err, or
+	// has failed. The duration is the time spent decoding the segment,
+	// excluding time the decode was paused waiting for data, and
+	// bytesConsumed counts its header and data bytes.
+	SegmentEnd(seg SegmentEvent, duration time.Duration, bytesConsumed uint64, err error)
+	// PageComplete is called when the page described by info is finished.
+	PageComplete(info *PageInfo)
+}
+
+// observerAdapter forwards the internal hooks to an Observer.
+type observerAdapter struct {
+	o Observer
+}
+
+func newObserver(o Observer) jbig2.Observer {
+	if o == nil {
+		return nil
+	}
+	return observerAdapter{o: o}
+}
+
+func segmentEvent(seg *jbig2.Segment) SegmentEvent {
+	return SegmentEvent{Number: seg.Number, Type: seg.Flags.Type(), Page: seg.PageAssociation}
+}
+
+func (a observerAdapter) SegmentStart(seg *jbig2.Segment) {
+	a.o.SegmentStart(segmentEvent(seg))
+}
+
+func (a observerAdapter) SegmentEnd(seg *jbig2.Segment, d time.Duration, n uint64, err error) {
+	a.o.SegmentEnd(segmentEvent(seg), d, n, err)
+}
+
+func (a observerAdapter) PageComplete(info *jbig2.PageInfo) {
+	a.o.PageComplete(&PageInfo{info: info})
+}
+
+// MetricsSink receives the measurements of a metrics Observer. It is small
+// enough to wrap any metrics library; labels identify the series and must
+// not be retained or modified.
+type MetricsSink interface {
+	// AddCounter adds delta to the counter name.
+	AddCounter(name string, delta float64, labels map[string]string)
+	// ObserveHistogram records value in the histogram name.
+	ObserveHistogram(name string, value float64, labels map[string]string)
+}
+
+// Metric names reported by NewMetricsObserver. Segment metrics carry a
+// "type" label holding the segment type name, and the error counter a
+// "kind" label as well.
+const (
+	MetricSegments        = "jbig2_segments_total"
+	MetricSegmentErrors   = "jbig2_segment_errors_total"
+	MetricSegmentDuration = "jbig2_segment_duration_seconds"
+	MetricSegmentBytes    = "jbig2_segment_bytes"
+	MetricPages           = "jbig2_pages_total"
+)
+
+// NewMetricsObserver returns an Observer that feeds sink: a counter of
+// decoded segments, histograms of their decoding time in seconds and their
+// size in bytes, all by segment type, a counter of failed segments by type
+// and error kind, and a counter of completed pages.
+func NewMetricsObserver(sink MetricsSink) Observer {
+	return metricsObserver{sink: sink}
+}
+
+type metricsObserver struct {
+	sink MetricsSink
+}
+
+func (m metricsObserver) SegmentStart(SegmentEvent) {}
+
+func (m metricsObserver) SegmentEnd(seg SegmentEvent, d time.Duration, n uint64, err error) {
+	labels := map[string]string{"type": seg.TypeName()}
+	m.sink.AddCounter(MetricSegments, 1, labels)
+	m.sink.ObserveHistogram(MetricSegmentDuration, d.Seconds(), labels)
+	m.sink.ObserveHistogram(MetricSegmentBytes, float64(n), labels)
+	if err != nil {
+		m.sink.AddCounter(MetricSegmentErrors, 1, map[string]string{"type": seg.TypeName(), "kind": errorKind(err)})
+	}
+}
+
+func (m metricsObserver) PageComplete(*PageInfo) {
+	m.sink.AddCounter(MetricPages, 1, nil)
+}
+
+// errorKind names the class of err for the error counter.
+func errorKind(err error) string {
+	switch {
+	case errors.Is(err, ErrTruncated):
+		return "truncated"
+	case errors.Is(err, ErrCorrupt):
+		return "corrupt"
+	case errors.Is(err, ErrUnsupported):
+		return "unsupported"
+	case errors.Is(err, ErrLimitExceeded):
+		return "limit"
+	case errors.Is(err, ErrProfileViolation):
+		return "profile"
+	}
+	return "other"
+}
@@ -0,0 +1,204 @@
+package jbig2
+
+import (
+	"fmt"
+	"image"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// Page is a decoded page together with the information declared for it.
+type Page struct {
+	// Number is the page number taken from the page information segment's
+	// page association.
+	Number uint32
+	// Image holds the composed page bitmap.
+	Image *Image
+	// Info describes the page as declared by its page information segment.
+	Info *PageInfo
+	// Damage lists the region segments of the page that failed to decode
+	// with Options.Recover set, in stream order. The page is complete when
+	// it is empty.
+	Damage []Damage
+}
+
+func newPage(img *jbig2.Image, colour *image.RGBA, info *jbig2.PageInfo, damage []jbig2.Damage) *Page {
+	page := &Page{Image: &Image{img: img, colour: colour}, Info: &PageInfo{info: info}}
+	if info != nil {
+		page.Number = info.Number
+		page.Damage = newDamage(damage, info.Number)
+	}
+	return page
+}
+
+// PageInfo describes a page as declared by its page information segment.
+type PageInfo struct {
+	info *jbig2.PageInfo
+}
+
+// Width returns the declared page width in pixels.
+func (pi *PageInfo) Width() uint32 {
+	if pi == nil || pi.info == nil {
+		return 0
+	}
+	return pi.info.Width
+}
+
+// Height returns the declared page height in pixels. Striped pages of unknown
+// height report 0xffffffff.
+func (pi *PageInfo) Height() uint32 {
+	if pi == nil || pi.info == nil {
+		return 0
+	}
+	return pi.info.Height
+}
+
+// ResolutionX returns the horizontal resolution in pixels per metre, or 0
+// when unknown.
+func (pi *PageInfo) ResolutionX() uint32 {
+	if pi == nil || pi.info == nil {
+		return 0
+	}
+	return pi.info.ResolutionX
+}
+
+// ResolutionY returns the vertical resolution in pixels per metre, or 0 when
+// unknown.
+func (pi *PageInfo) ResolutionY() uint32 {
+	if pi == nil || pi.info == nil {
+		return 0
+	}
+	return pi.info.ResolutionY
+}
+
+// DPI returns the resolution converted to dots per inch. Both values are 0
+// when the page does not declare a resolution.
+func (pi *PageInfo) DPI() (x, y float64) {
+	const metresPerInch = 0.0254
+	return float64(pi.ResolutionX()) * metresPerInch, float64(pi.ResolutionY()) * metresPerInch
+}
+
+// DefaultPixel returns the value, 0 or 1, that the page is initialised with.
+func (pi *PageInfo) DefaultPixel() uint8 {
+	if pi == nil || pi.info == nil || !pi.info.DefaultPixelValue {
+		return 0
+	}
+	return 1
+}
+
+// Striped reports whether the page is coded in stripes.
+func (pi *PageInfo) Striped() bool {
+	return pi != nil && pi.info != nil && pi.info.Striped
+}
+
+// MaxStripeSize returns the maximum stripe height of a striped page.
+func (pi *PageInfo) MaxStripeSize() uint16 {
+	if pi == nil || pi.info == nil {
+		return 0
+	}
+	return pi.info.MaxStripeSize
+}
+
+// EventuallyLossless reports whether the page is eventually coded losslessly.
+func (pi *PageInfo) EventuallyLossless() bool {
+	return pi != nil && pi.info != nil && pi.info.EventuallyLossless
+}
+
+// MightContainRefinements reports whether the page may contain refinement
+// regions.
+func (pi *PageInfo) MightContainRefinements() bool {
+	return pi != nil && pi.info != nil && pi.info.MightContainRefinements
+}
+
+// DefaultCombinationOperator returns the operator used to combine regions
+// onto the page unless a region overrides it.
+func (pi *PageInfo) DefaultCombinationOperator() CombinationOperator {
+	if pi == nil || pi.info == nil {
+		return CombinationOR
+	}
+	return CombinationOperator(pi.info.DefaultCombOp)
+}
+
+// RequiresAuxiliaryBuffers reports whether the page needs auxiliary buffers
+// to hold intermediate regions.
+func (pi *PageInfo) RequiresAuxiliaryBuffers() bool {
+	return pi != nil && pi.info != nil && pi.info.RequiresAuxiliaryBuffers
+}
+
+// CombinationOperatorOverridden reports whether regions may use a
+// combination operator other than the page default.
+func (pi *PageInfo) CombinationOperatorOverridden() bool {
+	return pi != nil && pi.info != nil && pi.info.CombOpOverridden
+}
+
+// ColourExtension reports whether the page announces coloured regions
+// (flag bit 7).
+func (pi *PageInfo) ColourExtension() bool {
+	return pi != nil && pi.info != nil && pi.info.ColourExtension
+}
+
+// CombinationOperator identifies how a region is combined with the page,
+// and how Bitmap.Compose combines a source bitmap with its destination.
+type CombinationOperator int
+
+const (
+	// CombinationOR sets a pixel when either input is set.
+	CombinationOR CombinationOperator = CombinationOperator(jbig2.ComposeOR)
+	// CombinationAND sets a pixel when both inputs are set.
+	CombinationAND CombinationOperator = CombinationOperator(jbig2.ComposeAND)
+	// CombinationXOR sets a pixel when exactly one input is set.
+	CombinationXOR CombinationOperator = CombinationOperator(jbig2.ComposeXOR)
+	// CombinationXNOR sets a pixel when both inputs are equal.
+	CombinationXNOR CombinationOperator = CombinationOperator(jbig2.ComposeXNOR)
+	// CombinationReplace copies the region over the page.
+	CombinationReplace CombinationOperator = CombinationOperator(jbig2.ComposeReplace)
+)
+
+func (op CombinationOperator) String() string {
+	switch op {
+	case CombinationOR:
+		return "OR"
+	case CombinationAND:
+		return "AND"
+	case CombinationXOR:
+		return "XOR"
+	case CombinationXNOR:
+		return "XNOR"
+	case CombinationReplace:
+		return "REPLACE"
+	default:
+		return fmt.Sprintf("CombinationOperator(%d)", int(op))
+	}
+}
+
+// FileHeader describes the header of a standalone JBIG2 file.
+type FileHeader struct {
+	header *jbig2.FileHeader
+}
+
+func newFileHeader(header *jbig2.FileHeader) *FileHeader {
+	if header == nil {
+		return nil
+	}
+	return &FileHeader{header: header}
+}
+
+// Sequential reports whether each segment header is immediately followed by
+// its data.
+func (fh *FileHeader) Sequential() bool {
+	return fh != nil && fh.header != nil && fh.header.Sequential()
+}
+
+// RandomAccess reports whether all segment headers precede all segment data.
+func (fh *FileHeader) RandomAccess() bool {
+	return fh != nil && fh.header != nil && fh.header.RandomAccess()
+}
+
+// NumPages returns the declared number of pages. known is false when the
+// header leaves the page count unspecified.
+func (fh *FileHeader) NumPages() (n uint32, known bool) {
+	if fh == nil || fh.header == nil || !fh.header.HasNumPage {
+		return 0, false
+	}
+	return fh.header.NumPages, true
+}
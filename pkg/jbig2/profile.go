@@ -0,0 +1,49 @@
+package jbig2
+
+import (
+	"fmt"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// Profile identifies a T.88 profile a stream declares conformance to.
+type Profile uint32
+
+// Profiles defined by T.88 Annex A, which the decoder knows.
+const (
+	// ProfileAllCapabilities places no restrictions on the stream.
+	ProfileAllCapabilities = Profile(jbig2.ProfileAllCapabilities)
+	// ProfileMaximumCompression allows only arithmetic coding.
+	ProfileMaximumCompression = Profile(jbig2.ProfileMaximumCompression)
+	// ProfileMediumComplexityMediumCompression allows only arithmetic
+	// coding with nominal AT pixels and no refinement.
+	ProfileMediumComplexityMediumCompression = Profile(jbig2.ProfileMediumComplexityMediumCompression)
+	// ProfileLowComplexityProgressiveLossless allows only MMR and Huffman
+	// coding, plus generic refinement regions.
+	ProfileLowComplexityProgressiveLossless = Profile(jbig2.ProfileLowComplexityProgressiveLossless)
+	// ProfileLowComplexity allows only MMR and Huffman coding.
+	ProfileLowComplexity = Profile(jbig2.ProfileLowComplexity)
+)
+
+// Known reports whether the decoder can check conformance to p.
+func (p Profile) Known() bool {
+	return jbig2.ProfileName(uint32(p)) != ""
+}
+
+func (p Profile) String() string {
+	if name := jbig2.ProfileName(uint32(p)); name != "" {
+		return fmt.Sprintf("profile %d (%s)", uint32(p), name)
+	}
+	return fmt.Sprintf("profile %d", uint32(p))
+}
+
+func newProfiles(profiles []uint32) []Profile {
+	if len(profiles) == 0 {
+		return nil
+	}
+	out := make([]Profile, len(profiles))
+	for i, p := range profiles {
+		out[i] = Profile(p)
+	}
+	return out
+}
@@ -0,0 +1,88 @@
+package jbig2
+
+import (
+	"image"
+	"image/color"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// RegionEvent describes a region segment that has just been composed onto
+// the page.
+type RegionEvent struct {
+	// Segment is the number of the region segment.
+	Segment uint32
+	// Type is the segment type.
+	Type uint8
+	// Rect is the area of the page the region affected, in the coordinates
+	// of Page.
+	Rect image.Rectangle
+	// Page is a read-only view of the page being decoded. It reflects later
+	// changes to the page and must not be used after decoding resumes.
+	Page image.PalettedImage
+}
+
+// RowsEvent describes generic region rows that have finished decoding.
+type RowsEvent struct {
+	// Segment is the number of the generic region segment.
+	Segment uint32
+	// Type is the segment type.
+	Type uint8
+	// Rect is the area of the page covered by the finished rows.
+	Rect image.Rectangle
+	// Region is a read-only view of the region bitmap. Its rows up to the
+	// bottom of Rect, relative to the region, are final. It must not be used
+	// after the callback returns.
+	Region image.PalettedImage
+}
+
+// imageView is a read-only image.PalettedImage over a decoder bitmap.
+type imageView struct {
+	img *jbig2.Image
+}
+
+func (v imageView) ColorModel() color.Model { return Palette() }
+
+func (v imageView) Bounds() image.Rectangle {
+	return image.Rect(0, 0, v.img.Width(), v.img.Height())
+}
+
+func (v imageView) At(x, y int) color.Color { return palette[v.ColorIndexAt(x, y)] }
+
+func (v imageView) ColorIndexAt(x, y int) uint8 {
+	return uint8(v.img.GetPixel(int32(x), int32(y)))
+}
+
+func rectangle(r jbig2.Rect) image.Rectangle {
+	return image.Rect(r.Left, r.Top, r.Right, r.Bottom)
+}
+
+// regionHandler adapts fn to the internal region callback.
+func regionHandler(fn func(RegionEvent)) func(jbig2.RegionUpdate) {
+	if fn == nil {
+		return nil
+	}
+	return func(u jbig2.RegionUpdate) {
+		fn(RegionEvent{
+			Segment: u.Segment.Number,
+			Type:    u.Segment.Flags.Type(),
+			Rect:    rectangle(u.Rect),
+			Page:    imageView{img: u.Page},
+		})
+	}
+}
+
+// rowsHandler adapts fn to the internal rows callback.
+func rowsHandler(fn func(RowsEvent)) func(jbig2.RowsUpdate) {
+	if fn == nil {
+		return nil
+	}
+	return func(u jbig2.RowsUpdate) {
+		fn(RowsEvent{
+			Segment: u.Segment.Number,
+			Type:    u.Segment.Flags.Type(),
+			Rect:    rectangle(u.Rect),
+			Region:  imageView{img: u.Region},
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package jbig2
+
+import (
+	"image"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// Damage describes a region segment that failed to decode with
+// Options.Recover set.
+type Damage struct {
+	// Segment is the number of the failed segment.
+	Segment uint32
+	// Type is its segment type.
+	Type uint8
+	// Page is its page association.
+	Page uint32
+	// Rect is the part of the region, in page coordinates, missing from the
+	// page. Rows of a generic region decoded before the failure are
+	// composed and excluded from it; the partial output of a text or
+	// halftone region is composed too, but the whole region is reported.
+	// It is empty when the region information could not be read or is
+	// invalid.
+	Rect image.Rectangle
+	// Err is the error the segment failed with.
+	Err error
+}
+
+// TypeName returns a description of the segment type, such as
+// "immediate generic region".
+func (d Damage) TypeName() string {
+	return jbig2.SegmentTypeName(d.Type)
+}
+
+// newDamage converts the damage recorded for page, or for every page when
+// page is zero.
+func newDamage(damage []jbig2.Damage, page uint32) []Damage {
+	var out []Damage
+	for _, d := range damage {
+		if page != 0 && d.Page != page {
+			continue
+		}
+		out = append(out, Damage{
+			Segment: d.Segment,
+			Type:    d.Type,
+			Page:    d.Page,
+			Rect:    image.Rect(d.Rect.Left, d.Rect.Top, d.Rect.Right, d.Rect.Bottom),
+			Err:     d.Err,
+		})
+	}
+	return out
+}
@@ -0,0 +1,123 @@
+package jbig2
+
+import "github.com/jdeng/gojbig2/internal/jbig2"
+
+// ScanResult lists the segments found by Scan.
+type ScanResult struct {
+	// Header is the file header, or nil for an embedded stream.
+	Header *FileHeader
+	// Globals lists the segments of the global data, if any.
+	Globals []SegmentHeader
+	// Segments lists the segments of the stream in decoding order.
+	Segments []SegmentHeader
+}
+
+// SegmentHeader describes a segment header together with the fixed-size
+// fields at the start of its data. Fields that do not apply to the segment
+// type are zero.
+type SegmentHeader struct {
+	Number uint32
+	Type   uint8
+	// Flags is the raw segment header flags byte.
+	Flags      uint8
+	ReferredTo []uint32
+	Page       uint32
+	// DataOffset is the offset of the segment data in the scanned input.
+	DataOffset uint64
+	// DataLength is the length of the segment data. For an immediate generic
+	// region of unknown length it is resolved from the end marker.
+	DataLength uint32
+	// UnknownLength reports whether the header left the data length
+	// unspecified.
+	UnknownLength bool
+
+	// Region holds the region segment information of region segments.
+	Region *RegionInfo
+	// PageInfo holds the contents of page information segments.
+	PageInfo *PageInfo
+
+	// NumExportedSymbols and NumNewSymbols are the symbol counts of a symbol
+	// dictionary.
+	NumExportedSymbols uint32
+	NumNewSymbols      uint32
+	// NumPatterns is the pattern count of a pattern dictionary.
+	NumPatterns uint64
+	// NumInstances is the symbol instance count of a text region.
+	NumInstances uint32
+	// StripeEndRow is the last row of the stripe ended by an end-of-stripe
+	// segment.
+	StripeEndRow uint32
+}
+
+// RegionInfo is the region segment information field of a region segment.
+type RegionInfo struct {
+	Width, Height int
+	X, Y          int
+	// Flags is the raw region segment flags byte.
+	Flags uint8
+	// Colour reports a coloured region, whose 1 pixels take the palette
+	// colour Foreground and 0 pixels the palette colour Background, or stay
+	// transparent when Background is 0xffff.
+	Colour                 bool
+	Foreground, Background uint16
+}
+
+// CombinationOperator returns the operator used to combine the region with
+// the page.
+func (ri RegionInfo) CombinationOperator() CombinationOperator {
+	return CombinationOperator(ri.Flags & 0x07)
+}
+
+// Scan walks the segment headers of data and, when given, globals without
+// decoding any region: no bitmaps are allocated and no arithmetic or MMR
+// decoding runs, so it is cheap enough for indexing and triage of large
+// archives. Errors are reported as for decoding, usually as a *DecodeError.
+func Scan(data, globals []byte) (*ScanResult, error) {
+	res, err := jbig2.Scan(data, globals)
+	if err != nil {
+		return nil, err
+	}
+	return &ScanResult{
+		Header:   newFileHeader(res.Header),
+		Globals:  newSegmentHeaders(res.Globals),
+		Segments: newSegmentHeaders(res.Segments),
+	}, nil
+}
+
+func newSegmentHeaders(infos []jbig2.SegmentInfo) []SegmentHeader {
+	out := make([]SegmentHeader, len(infos))
+	for i, info := range infos {
+		out[i] = SegmentHeader{
+			Number:             info.Number,
+			Type:               info.Flags.Type(),
+			Flags:              info.Flags.Raw(),
+			ReferredTo:         info.ReferredTo,
+			Page:               info.Page,
+			DataOffset:         info.DataOffset,
+			DataLength:         info.DataLength,
+			UnknownLength:      info.UnknownLength,
+			NumExportedSymbols: info.NumExportedSymbols,
+			NumNewSymbols:      info.NumNewSymbols,
+			NumPatterns:        info.NumPatterns,
+			NumInstances:       info.NumInstances,
+			StripeEndRow:       info.StripeEndRow,
+		}
+		if ri := info.Region; ri != nil {
+			out[i].Region = &RegionInfo{
+				Width:  int(ri.Width),
+				Height: int(ri.Height),
+				X:      int(ri.X),
+				Y:      int(ri.Y),
+				Flags:  ri.Flags,
+
+				Colour:     ri.Colour,
+				Foreground: ri.Foreground,
+				Background: ri.Background,
+			}
+		}
+		if info.PageInfo != nil {
+			out[i].PageInfo = &PageInfo{info: info.PageInfo}
+		}
+	}
+	return out
+}
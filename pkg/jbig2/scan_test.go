@@ -0,0 +1,40 @@
+package jbig2
+
+import (
+	"encoding/binary"
+	"testing"
+)
+
+func TestScan(t *testing.T) {
+	region := binary.BigEndian.AppendUint32(nil, 5)
+	region = binary.BigEndian.AppendUint32(region, 3)
+	region = binary.BigEndian.AppendUint32(region, 2)
+	region = binary.BigEndian.AppendUint32(region, 1)
+	region = append(region, 0x02, 0x00, 0xde, 0xad)
+	data := testFile(segmentBytes(1, 38, 1, region))
+
+	res, err := Scan(data, nil)
+	if err != nil {
+		t.Fatalf("Scan returned error: %v", err)
+	}
+	if n, _ := res.Header.NumPages(); n != 1 {
+		t.Errorf("Expected one declared page, got %d", n)
+	}
+	if len(res.Segments) != 4 {
+		t.Fatalf("Expected 4 segments, got %d", len(res.Segments))
+	}
+	if info := res.Segments[0].PageInfo; info.Width() != 21 || info.Height() != 9 {
+		t.Errorf("Unexpected page size %dx%d", info.Width(), info.Height())
+	}
+	seg := res.Segments[1]
+	if seg.Number != 1 || seg.Type != 38 || seg.Page != 1 || seg.DataLength != uint32(len(region)) {
+		t.Errorf("Unexpected segment header %+v", seg)
+	}
+	ri := seg.Region
+	if ri == nil || ri.Width != 5 || ri.Height != 3 || ri.X != 2 || ri.Y != 1 {
+		t.Fatalf("Unexpected region info %+v", ri)
+	}
+	if op := ri.CombinationOperator(); op != CombinationXOR {
+		t.Errorf("Expected XOR combination operator, got %v", op)
+	}
+}
@@ -0,0 +1,55 @@
+package jbig2
+
+import (
+	"errors"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// MarshalState serializes the state of the decoder so that ResumeDecoder can
+// continue decoding later, possibly in another process. It is typically
+// called once Options.Pause has paused GetFirstPage or Continue, but any
+// point between calls is fine, such as after NextPage.
+//
+// The state records the stream position, the pages and retained segment
+// results decoded so far and, within a paused generic region, the
+// arithmetic decoder registers, contexts and row position. It does not
+// include the source data, the global segments, which are decoded again
+// on resume, or any option such as callbacks and limits. The buffer passed
+// to GetFirstPage is not part of it either: a resumed decoder composes the
+// page into a buffer of its own, returned by GetPageImage. The state of a
+// decoder that failed cannot be saved.
+func (d *Decoder) MarshalState() ([]byte, error) {
+	return d.decoder.MarshalState()
+}
+
+// ResumeDecoder creates a decoder that continues from a state returned by
+// MarshalState. opts must provide the same SrcData and the same GlobalData
+// or Globals as the decoder the state was taken from; state that does not
+// match them is rejected. If that decoder had OnStripe or StripeWriter set,
+// opts must set one of them too, or a state taken while a page was emitted
+// stripe by stripe is rejected. A state taken within DecodeRegion must be
+// resumed with DecodeRegion and the same rect, since the clip itself is not
+// saved. The other options may differ.
+func ResumeDecoder(state []byte, opts Options) (*Decoder, error) {
+	if len(opts.SrcData) == 0 {
+		return nil, errors.New("jbig2: empty source data")
+	}
+	internalDecoder, err := jbig2.ResumeDecoder(state, opts.internal())
+	if err != nil {
+		return nil, err
+	}
+	return &Decoder{decoder: internalDecoder}, nil
+}
+
+// pauseFunc adapts a function to the internal pause indicator.
+type pauseFunc func() bool
+
+func (f pauseFunc) ShouldPause() bool { return f() }
+
+func pauseIndicator(fn func() bool) jbig2.PauseIndicator {
+	if fn == nil {
+		return nil
+	}
+	return pauseFunc(fn)
+}
@@ -0,0 +1,108 @@
+package jbig2
+
+import (
+	"context"
+	"io"
+	"iter"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// ErrNeedMoreData is returned by StreamDecoder.NextPage when the reader has
+// no further bytes available yet. Decoding stops at a segment boundary and
+// resumes on the next call.
+var ErrNeedMoreData = jbig2.ErrNeedMoreData
+
+// StreamDecoder decodes pages while the stream is still arriving. Segment
+// headers are parsed as soon as their bytes are read and each page is
+// returned once it completes, so only the undecoded tail of a sequential
+// stream is held in memory. Random-access files list every segment header
+// before the data and are therefore buffered until the reader is exhausted.
+type StreamDecoder struct {
+	decoder *jbig2.StreamDecoder
+}
+
+// NewStreamDecoder creates a decoder that reads a JBIG2 stream from r with
+// default options.
+func NewStreamDecoder(r io.Reader) *StreamDecoder {
+	return NewStreamDecoderOptions(r, Options{})
+}
+
+// NewStreamDecoderOptions creates a decoder that reads a JBIG2 stream from r
+// with opts. SrcData is ignored. Limits.MaxBufferBytes bounds the bytes held
+// while a segment, or a random-access file, has not fully arrived; it
+// defaults to 256 MiB. Errors in opts, such as setting both GlobalData and
+// Globals, are returned by the first NextPage.
+func NewStreamDecoderOptions(r io.Reader, opts Options) *StreamDecoder {
+	return &StreamDecoder{decoder: jbig2.NewStreamDecoder(r, opts.internal())}
+}
+
+// Close releases the reference the decoder holds to Options.Globals. The
+// decoder must not be used afterwards.
+func (d *StreamDecoder) Close() {
+	d.decoder.Close()
+}
+
+// NextPage returns the next complete page. It reads from the underlying
+// reader as needed and blocks whenever the reader blocks. If the reader
+// returns no bytes and no error, NextPage returns ErrNeedMoreData and may be
+// called again later. io.EOF is returned once all pages have been decoded.
+func (d *StreamDecoder) NextPage() (*Page, error) {
+	img, info, err := d.decoder.NextPage()
+	if err != nil {
+		return nil, err
+	}
+	return newPage(img, d.decoder.ColourPage(), info, d.decoder.Damage()), nil
+}
+
+// NextPageContext is like NextPage but stops as soon as ctx is done,
+// returning an error that satisfies errors.Is(err, ctx.Err()); see
+// Decoder.DecodeAllContext. Cancellation is checked between reads and while
+// decoding; a Read that is already blocked is not interrupted.
+func (d *StreamDecoder) NextPageContext(ctx context.Context) (*Page, error) {
+	img, info, err := d.decoder.NextPageContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return newPage(img, d.decoder.ColourPage(), info, d.decoder.Damage()), nil
+}
+
+// Pages returns an iterator over the remaining pages of the stream. Iteration
+// stops after the last page or after yielding the first error, including
+// ErrNeedMoreData.
+func (d *StreamDecoder) Pages() iter.Seq2[*Page, error] {
+	return func(yield func(*Page, error) bool) {
+		for {
+			page, err := d.NextPage()
+			if err == io.EOF {
+				return
+			}
+			if !yield(page, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Comments returns the comment extensions decoded so far; see
+// Decoder.Comments.
+func (d *StreamDecoder) Comments() []Comment {
+	return newComments(d.decoder.Comments())
+}
+
+// Profiles returns the profiles declared by the stream so far.
+func (d *StreamDecoder) Profiles() []Profile {
+	return newProfiles(d.decoder.Profiles())
+}
+
+// LiveBytes returns the bitmap storage the decoder currently holds; see
+// Decoder.LiveBytes.
+func (d *StreamDecoder) LiveBytes() uint64 {
+	return d.decoder.LiveBytes()
+}
+
+// FileHeader returns the file header. It is nil until the header has been
+// read, and for streams that have none.
+func (d *StreamDecoder) FileHeader() *FileHeader {
+	return newFileHeader(d.decoder.FileHeader())
+}
@@ -0,0 +1,70 @@
+package jbig2
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+	"testing/iotest"
+)
+
+func TestStreamDecoderPages(t *testing.T) {
+	dec := NewStreamDecoder(iotest.OneByteReader(bytes.NewReader(testFile())))
+	count := 0
+	for page, err := range dec.Pages() {
+		if err != nil {
+			t.Fatalf("Pages yielded error: %v", err)
+		}
+		if page.Number != 1 || page.Image.Width() != 21 || page.Image.Height() != 9 {
+			t.Errorf("Unexpected page %d: %dx%d", page.Number, page.Image.Width(), page.Image.Height())
+		}
+		count++
+	}
+	if count != 1 {
+		t.Errorf("Expected 1 page, got %d", count)
+	}
+}
+
+// pausingReader reports no data, without an error, until resumed.
+type pausingReader struct {
+	r      io.Reader
+	paused bool
+}
+
+func (r *pausingReader) Read(p []byte) (int, error) {
+	if r.paused {
+		return 0, nil
+	}
+	return r.r.Read(p)
+}
+
+func TestStreamDecoderNeedMoreData(t *testing.T) {
+	r := &pausingReader{r: bytes.NewReader(testFile()), paused: true}
+	dec := NewStreamDecoder(r)
+	if _, err := dec.NextPage(); err != ErrNeedMoreData {
+		t.Fatalf("Expected ErrNeedMoreData, got %v", err)
+	}
+	r.paused = false
+	page, err := dec.NextPage()
+	if err != nil {
+		t.Fatalf("NextPage returned error: %v", err)
+	}
+	if page.Number != 1 {
+		t.Errorf("Unexpected page number %d", page.Number)
+	}
+	if _, err := dec.NextPage(); err != io.EOF {
+		t.Errorf("Expected io.EOF, got %v", err)
+	}
+}
+
+func TestStreamDecoderOptions(t *testing.T) {
+	region := segmentBytes(1, 38, 1, nil)
+	binary.BigEndian.PutUint32(region[len(region)-4:], 1<<20)
+	r := &pausingReader{r: bytes.NewReader(testFile(region))}
+	dec := NewStreamDecoderOptions(r, Options{Limits: Limits{MaxBufferBytes: 1 << 16}})
+	defer dec.Close()
+	if _, err := dec.NextPage(); !errors.Is(err, ErrLimitExceeded) {
+		t.Errorf("Expected ErrLimitExceeded for an oversized segment, got %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+package jbig2
+
+import (
+	"io"
+
+	"github.com/jdeng/gojbig2/internal/jbig2"
+)
+
+// Stripe holds finished rows of a striped page.
+type Stripe struct {
+	// Page describes the page the rows belong to.
+	Page *PageInfo
+	// Top is the page row of the first row of Image.
+	Top int
+	// Image holds the rows. It is owned by the receiver.
+	Image *Image
+}
+
+// stripeHandler adapts fn and w to the internal stripe callback.
+func stripeHandler(fn func(Stripe) error, w io.Writer) func(jbig2.StripeUpdate) error {
+	if fn == nil && w == nil {
+		return nil
+	}
+	return func(u jbig2.StripeUpdate) error {
+		if w != nil {
+			if err := writeRows(w, u.Rows); err != nil {
+				return err
+			}
+		}
+		if fn != nil {
+			return fn(Stripe{Page: &PageInfo{info: u.Page}, Top: u.Top, Image: &Image{img: u.Rows}})
+		}
+		return nil
+	}
+}
+
+// writeRows writes the rows of img packed to whole bytes, clearing the
+// padding bits of the last byte of each row.
+func writeRows(w io.Writer, img *jbig2.Image) error {
+	rowBytes := (img.Width() + 7) / 8
+	pad := byte(0xff) << ((8 - img.Width()%8) % 8)
+	buf := make([]byte, 0, rowBytes*img.Height())
+	for y := 0; y < img.Height(); y++ {
+		row := img.Data()[y*img.Stride():]
+		buf = append(buf, row[:rowBytes]...)
+		buf[len(buf)-1] &= pad
+	}
+	_, err := w.Write(buf)
+	return err
+}